@@ -1,11 +1,115 @@
 const API_BASE = (import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080').replace(/\/$/, '');
 
+export type WorkoutPayload = {
+  user_id: string;
+  route_id: string;
+  name?: string;
+  exercises?: { name: string; sets?: number; reps?: number; weight_kg?: number; duration_seconds?: number }[];
+  date?: string;
+  duration: number;
+  calories: number;
+};
+
+export type RouteDifficulty = 'easy' | 'moderate' | 'hard' | 'expert';
+export type RouteSurface = 'paved' | 'gravel' | 'dirt' | 'rocky' | 'mixed';
+export type RouteType = 'loop' | 'out_and_back' | 'point_to_point';
+// public: todos; unlisted: solo con el enlace; private: solo el dueño;
+// shared: el dueño y los usuarios de shared_with.
+export type RouteVisibility = 'public' | 'unlisted' | 'private' | 'shared';
+
+// Ruta tal como la devuelve el gateway (nombres del proto). Los enums llegan
+// como "ROUTE_DIFFICULTY_HARD", "ROUTE_TYPE_LOOP"...; *_UNSPECIFIED = sin
+// clasificar.
+export type Route = {
+  id: string;
+  name: string;
+  user_id: string;
+  description: string;
+  distance_m: number;
+  elevation_gain_m: number;
+  elevation_loss_m: number;
+  estimated_duration_min: number;
+  difficulty: string;
+  surface: string;
+  route_type: string;
+  region: string;
+  tags: string[];
+  created_at: string;
+  updated_at: string;
+  rating_avg: number;
+  rating_count: number;
+  workout_count: number;
+  visibility: string;
+  shared_with: string[]; // solo lo ve el dueño
+  star_count: number;
+};
+
+export type Collection = {
+  id: string;
+  user_id: string;
+  title: string;
+  description: string;
+  visibility: string;
+  route_ids: string[]; // en orden; sin las rutas que el viewer no ve
+  routes?: Route[]; // solo en getCollection
+  created_at: string;
+  updated_at: string;
+};
+
+export type CollectionPayload = {
+  title?: string;
+  description?: string;
+  visibility?: Exclude<RouteVisibility, 'shared'>;
+  routeIds?: string[]; // solo al crear
+};
+
+export type RoutePayload = {
+  name: string;
+  description?: string;
+  distanceM?: number;
+  elevationGainM?: number;
+  elevationLossM?: number;
+  estimatedDurationMin?: number;
+  difficulty?: RouteDifficulty;
+  surface?: RouteSurface;
+  routeType?: RouteType;
+  region?: string;
+  tags?: string[];
+  visibility?: RouteVisibility; // sin valor: public al crear, sin cambios al editar
+  geoJson?: string;
+};
+
+// enumLabel pasa "ROUTE_TYPE_OUT_AND_BACK" a "out and back"; vacío si no
+// está clasificado.
+export function enumLabel(value: string, prefix: string): string {
+  const v = (value || '').replace(prefix, '');
+  return v === 'UNSPECIFIED' ? '' : v.toLowerCase().replace(/_/g, ' ');
+}
+
+export type POIPayload = {
+  type: 'water' | 'viewpoint' | 'hazard' | 'parking' | 'shelter' | 'other';
+  lat: number;
+  lon: number;
+  name?: string;
+  description?: string;
+  photoRef?: string;
+};
+
 type RequestInitWithBody = RequestInit & { body?: BodyInit | null };
 
+// Usuario activo; el gateway lo usa para decidir si aplica las zonas de
+// privacidad del dueño de un track.
+let viewerId = '';
+
+export function setViewer(userId: string) {
+  viewerId = userId;
+}
+
 async function request<T>(path: string, init: RequestInitWithBody = {}): Promise<T> {
   const res = await fetch(`${API_BASE}${path}`, {
     headers: {
       'Content-Type': 'application/json',
+      ...(viewerId ? { 'X-User-ID': viewerId } : {}),
       ...(init.headers || {}),
     },
     ...init,
@@ -22,13 +126,101 @@ async function request<T>(path: string, init: RequestInitWithBody = {}): Promise
   return data as T;
 }
 
+// Subida multipart: el navegador arma el Content-Type con el boundary.
+async function upload<T>(path: string, form: FormData): Promise<T> {
+  const res = await fetch(`${API_BASE}${path}`, { method: 'POST', body: form });
+  const data = await res.json().catch(() => null);
+  if (!res.ok) {
+    throw new Error(data?.error || res.statusText);
+  }
+  return data as T;
+}
+
 export const api = {
   listUsers: () => request('/api/users'),
   getUser: (id: string) => request(`/api/users/${id}`),
-  listRoutes: () => request('/api/routes'),
+  // q usa el lenguaje de búsqueda de rutas, p. ej. 'laguna distance:5..20 sort:rating'
+  listRoutes: (opts: { q?: string; pageSize?: number; pageToken?: string } = {}) => {
+    const params = new URLSearchParams();
+    if (opts.q) params.set('q', opts.q);
+    if (opts.pageSize) params.set('pageSize', String(opts.pageSize));
+    if (opts.pageToken) params.set('pageToken', opts.pageToken);
+    const qs = params.toString();
+    return request(`/api/routes${qs ? `?${qs}` : ''}`);
+  },
   getRoute: (id: string) => request(`/api/routes/${id}`),
-  listWorkouts: () => request('/api/workouts'),
+  // Publicar y editar rutas a nombre del usuario activo (setViewer); con
+  // geoJson se guarda también la geometría
+  createRoute: (payload: RoutePayload) =>
+    request('/api/routes', { method: 'POST', body: JSON.stringify(payload) }),
+  updateRoute: (id: string, payload: RoutePayload) =>
+    request(`/api/routes/${id}`, { method: 'PUT', body: JSON.stringify(payload) }),
+  deleteRoute: (id: string) => request(`/api/routes/${id}`, { method: 'DELETE' }),
+  // Accesos de una ruta shared; solo el dueño
+  shareRoute: (id: string, userId: string) =>
+    request(`/api/routes/${id}/shares`, { method: 'POST', body: JSON.stringify({ userId }) }),
+  unshareRoute: (id: string, userId: string) =>
+    request(`/api/routes/${id}/shares/${userId}`, { method: 'DELETE' }),
+  // Favoritas del usuario activo; listRoutes({ q: 'starred:true' }) las lista
+  starRoute: (id: string) => request(`/api/routes/${id}/star`, { method: 'POST' }),
+  unstarRoute: (id: string) => request(`/api/routes/${id}/star`, { method: 'DELETE' }),
+  listCollections: (opts: { owner?: string; pageSize?: number; pageToken?: string } = {}) => {
+    const params = new URLSearchParams();
+    if (opts.owner) params.set('owner', opts.owner);
+    if (opts.pageSize) params.set('pageSize', String(opts.pageSize));
+    if (opts.pageToken) params.set('pageToken', opts.pageToken);
+    const qs = params.toString();
+    return request(`/api/collections${qs ? `?${qs}` : ''}`);
+  },
+  getCollection: (id: string) => request(`/api/collections/${id}`),
+  createCollection: (payload: CollectionPayload) =>
+    request('/api/collections', { method: 'POST', body: JSON.stringify(payload) }),
+  updateCollection: (id: string, payload: CollectionPayload) =>
+    request(`/api/collections/${id}`, { method: 'PUT', body: JSON.stringify(payload) }),
+  deleteCollection: (id: string) => request(`/api/collections/${id}`, { method: 'DELETE' }),
+  addCollectionRoute: (id: string, routeId: string) =>
+    request(`/api/collections/${id}/routes`, { method: 'POST', body: JSON.stringify({ routeId }) }),
+  removeCollectionRoute: (id: string, routeId: string) =>
+    request(`/api/collections/${id}/routes/${routeId}`, { method: 'DELETE' }),
+  reorderCollection: (id: string, routeIds: string[]) =>
+    request(`/api/collections/${id}/routes`, { method: 'PUT', body: JSON.stringify({ routeIds }) }),
+  listWorkouts: (params: Record<string, string> = {}) => {
+    const qs = new URLSearchParams(params).toString();
+    return request(`/api/workouts${qs ? `?${qs}` : ''}`);
+  },
+  // id es el ID del workout; los de un usuario salen de listUserWorkouts (pasar
+  // un user ID todavía funciona, pero está deprecado)
   getWorkout: (id: string) => request(`/api/workouts/${id}`),
+  listUserWorkouts: (userId: string, order: 'asc' | 'desc' = 'desc') =>
+    request(`/api/users/${userId}/workouts?order=${order}`),
+  getUserStats: (userId: string, period: 'week' | 'month' = 'week') =>
+    request(`/api/users/${userId}/stats?period=${period}`),
+  // Zonas de privacidad: solo las ve y edita el propio usuario (setViewer)
+  listPrivacyZones: (userId: string) => request(`/api/users/${userId}/privacy-zones`),
+  createPrivacyZone: (userId: string, payload: { name?: string; lat: number; lon: number; radiusM: number }) =>
+    request(`/api/users/${userId}/privacy-zones`, { method: 'POST', body: JSON.stringify(payload) }),
+  deletePrivacyZone: (userId: string, zoneId: string) =>
+    request(`/api/users/${userId}/privacy-zones/${zoneId}`, { method: 'DELETE' }),
+  // Descargas: se usan como href de un enlace, no pasan por request().
+  routeExportUrl: (routeId: string, format: 'gpx' | 'geojson' | 'kml' = 'gpx') =>
+    `${API_BASE}/api/routes/${routeId}/export?format=${format}`,
+  workoutsExportUrl: (userId: string) => `${API_BASE}/api/users/${userId}/workouts/export`,
+  // Progreso en vivo por SSE: new EventSource(api.liveWorkoutUrl(id))
+  liveWorkoutUrl: (userId: string) => `${API_BASE}/api/users/${userId}/live`,
+  createWorkout: (payload: WorkoutPayload) =>
+    request('/api/workouts', { method: 'POST', body: JSON.stringify(payload) }),
+  updateWorkout: (id: string, payload: WorkoutPayload) =>
+    request(`/api/workouts/${id}`, { method: 'PUT', body: JSON.stringify(payload) }),
+  deleteWorkout: (id: string) => request(`/api/workouts/${id}`, { method: 'DELETE' }),
+  getWorkoutTrack: (id: string) => request(`/api/workouts/${id}/track`),
+  importWorkout: (file: File, fields: { userId: string; routeId?: string; name?: string }) => {
+    const form = new FormData();
+    form.append('file', file);
+    form.append('user_id', fields.userId);
+    if (fields.routeId) form.append('route_id', fields.routeId);
+    if (fields.name) form.append('name', fields.name);
+    return upload('/api/imports', form);
+  },
   getReviews: (routeId?: string) => request(`/api/reviews${routeId ? `?routeId=${routeId}` : ''}`),
   createReview: (payload: { userId: string; routeId: string; rating: number; comment: string }) =>
     request('/api/reviews', { method: 'POST', body: JSON.stringify(payload) }),
@@ -38,7 +230,62 @@ export const api = {
   getNotifications: (userId: string) => request(`/api/notifications/${userId}`),
   sendNotification: (payload: { userId: string; message: string }) =>
     request('/api/notifications', { method: 'POST', body: JSON.stringify(payload) }),
-  getMap: (routeId: string) => request(`/api/maps/${routeId}`),
-  setMap: (payload: { routeId: string; geoJson: string }) =>
+  // zoom/tolerance simplifican la línea; sin opciones llega la geometría completa
+  getMap: (routeId: string, opts: { zoom?: number; tolerance?: number; format?: 'geojson' | 'polyline' } = {}) => {
+    const params = new URLSearchParams();
+    if (opts.zoom !== undefined) params.set('zoom', String(opts.zoom));
+    if (opts.tolerance !== undefined) params.set('tolerance', String(opts.tolerance));
+    if (opts.format) params.set('format', opts.format);
+    const qs = params.toString();
+    return request(`/api/maps/${routeId}${qs ? `?${qs}` : ''}`);
+  },
+  getMapStats: (routeId: string) => request(`/api/maps/${routeId}/stats`),
+  // Miniatura para <img src>; no pasa por request()
+  routePreviewUrl: (routeId: string, opts: { width?: number; height?: number; style?: 'plain' | 'elevation' | 'grade' } = {}) => {
+    const params = new URLSearchParams();
+    if (opts.width) params.set('w', String(opts.width));
+    if (opts.height) params.set('h', String(opts.height));
+    if (opts.style) params.set('style', opts.style);
+    const qs = params.toString();
+    return `${API_BASE}/api/maps/${routeId}/preview.png${qs ? `?${qs}` : ''}`;
+  },
+  searchRoutesNear: (lat: number, lon: number, radius = 5000) =>
+    request(`/api/maps/search?lat=${lat}&lon=${lon}&radius=${radius}`),
+  // bbox en orden GeoJSON: [minLon, minLat, maxLon, maxLat]
+  searchRoutesInBBox: (bbox: [number, number, number, number]) =>
+    request(`/api/maps/search?bbox=${bbox.join(',')}`),
+  // Camino nuevo sobre los senderos de las rutas guardadas; devuelve geo_json,
+  // distancia, desnivel y las rutas usadas
+  planRoute: (payload: {
+    start: { lat: number; lon: number };
+    end: { lat: number; lon: number };
+    via?: { lat: number; lon: number }[];
+    optimize?: 'distance' | 'elevation';
+  }) => request('/api/maps/plan', { method: 'POST', body: JSON.stringify(payload) }),
+  // Plantilla para fuentes vectoriales de MapLibre/Leaflet; capa "routes"
+  tileUrlTemplate: () => `${API_BASE}/api/tiles/{z}/{x}/{y}.mvt`,
+  // Capa raster del heatmap; con userId, solo los tracks de ese usuario
+  heatmapUrlTemplate: (userId?: string) =>
+    `${API_BASE}/api/heatmap/{z}/{x}/{y}.png${userId ? `?userId=${userId}` : ''}`,
+  // Puntos de interés; type: water | viewpoint | hazard | parking | shelter | other
+  listRoutePOIs: (routeId: string, opts: { within?: number; types?: string[] } = {}) => {
+    const params = new URLSearchParams();
+    if (opts.within !== undefined) params.set('within', String(opts.within));
+    if (opts.types?.length) params.set('type', opts.types.join(','));
+    const qs = params.toString();
+    return request(`/api/maps/${routeId}/pois${qs ? `?${qs}` : ''}`);
+  },
+  createPOI: (payload: POIPayload & { createdBy?: string }) =>
+    request('/api/pois', { method: 'POST', body: JSON.stringify(payload) }),
+  updatePOI: (id: string, payload: POIPayload) =>
+    request(`/api/pois/${id}`, { method: 'PUT', body: JSON.stringify(payload) }),
+  deletePOI: (id: string) => request(`/api/pois/${id}`, { method: 'DELETE' }),
+  // Guarda una versión nueva; el autor es el usuario activo
+  setMap: (payload: { routeId: string; geoJson: string; name?: string }) =>
     request('/api/maps', { method: 'POST', body: JSON.stringify(payload) }),
+  // Historial de la geometría; revertir crea una versión nueva
+  listMapVersions: (routeId: string) => request(`/api/maps/${routeId}/versions`),
+  getMapVersion: (routeId: string, version: number) => request(`/api/maps/${routeId}/versions/${version}`),
+  revertMap: (routeId: string, payload: { version: number }) =>
+    request(`/api/maps/${routeId}/revert`, { method: 'POST', body: JSON.stringify(payload) }),
 };
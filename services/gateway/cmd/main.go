@@ -12,6 +12,7 @@ import (
 
 	aggcontroller "trailbox/services/gateway/internal/aggregator/controller"
 	gatewayclients "trailbox/services/gateway/internal/clients"
+	exportcontroller "trailbox/services/gateway/internal/exports/controller"
 	gatewayleaderboard "trailbox/services/gateway/internal/gateway/leaderboard/grpc"
 	gatewaymaps "trailbox/services/gateway/internal/gateway/maps/grpc"
 	gatewaynotifications "trailbox/services/gateway/internal/gateway/notifications/grpc"
@@ -20,9 +21,16 @@ import (
 	gatewayusers "trailbox/services/gateway/internal/gateway/users/grpc"
 	gatewayworkouts "trailbox/services/gateway/internal/gateway/workouts/grpc"
 	gatewayhttp "trailbox/services/gateway/internal/http/handler"
+	importcontroller "trailbox/services/gateway/internal/imports/controller"
+	"trailbox/services/gateway/internal/privacy"
+	statscontroller "trailbox/services/gateway/internal/routestats/controller"
 )
 
-const defaultPort = "8080"
+const (
+	defaultPort           = "8080"
+	defaultStatsReconcile = 6 * time.Hour
+	defaultZonesSync      = time.Hour
+)
 
 func main() {
 	mux := http.NewServeMux()
@@ -108,6 +116,9 @@ func main() {
 	usersClient := mustDialUsers("USERS_SERVICE_ADDR", defaultSvcAddr("users"))
 	routesClient := mustDialRoutes("ROUTES_SERVICE_ADDR", defaultSvcAddr("routes"))
 	workoutsClient := mustDialWorkouts("WORKOUTS_SERVICE_ADDR", defaultSvcAddr("workouts"))
+	// Sin WORKOUTS_LIVE_SERVICE_ADDR (docker compose, una sola instancia) las
+	// grabaciones usan el mismo servicio.
+	workoutsLiveClient := mustDialWorkouts("WORKOUTS_LIVE_SERVICE_ADDR", getenvOr("WORKOUTS_SERVICE_ADDR", defaultSvcAddr("workouts")))
 	reviewsClient := mustDialReviews("REVIEWS_SERVICE_ADDR", defaultSvcAddr("reviews"))
 	leaderboardClient := mustDialLeaderboard("LEADERBOARD_SERVICE_ADDR", defaultSvcAddr("leaderboard"))
 	notificationsClient := mustDialNotifications("NOTIFICATIONS_SERVICE_ADDR", defaultSvcAddr("notifications"))
@@ -117,6 +128,7 @@ func main() {
 		Users:         usersClient.API(),
 		Routes:        routesClient.API(),
 		Workouts:      workoutsClient.API(),
+		WorkoutsLive:  workoutsLiveClient.API(),
 		Reviews:       reviewsClient.API(),
 		Leaderboard:   leaderboardClient.API(),
 		Notifications: notificationsClient.API(),
@@ -124,14 +136,43 @@ func main() {
 	}
 
 	aggregatorController := aggcontroller.New(clientSet)
-	gatewayhttp.New(clientSet, aggregatorController).Register(mux)
+	importController := importcontroller.New(clientSet)
+	privacyGuard := privacy.New(clientSet)
+	exportController := exportcontroller.New(clientSet, privacyGuard)
+	statsController := statscontroller.New(clientSet)
+	gatewayhttp.New(clientSet, aggregatorController, importController, exportController, privacyGuard, statsController).Register(mux)
+
+	// Los totales de las rutas se reconcilian al arrancar (backfill de las
+	// columnas) y cada ROUTE_STATS_RECONCILE.
+	reconcile := getenvDuration("ROUTE_STATS_RECONCILE", defaultStatsReconcile)
+	go func() {
+		for {
+			if err := statsController.Reconcile(context.Background()); err != nil {
+				log.Printf("[gateway] route stats reconcile failed: %v", err)
+			}
+			time.Sleep(reconcile)
+		}
+	}()
+
+	// El heatmap global del servicio de mapas necesita una copia de las
+	// zonas de privacidad: se envía entera al arrancar y cada
+	// PRIVACY_ZONES_SYNC, además de tras cada cambio.
+	zonesSync := getenvDuration("PRIVACY_ZONES_SYNC", defaultZonesSync)
+	go func() {
+		for {
+			if err := privacyGuard.SyncAllZones(context.Background()); err != nil {
+				log.Printf("[gateway] privacy zones sync failed: %v", err)
+			}
+			time.Sleep(zonesSync)
+		}
+	}()
 
 	port := getenvOr("PORT", defaultPort)
 	srv := &http.Server{
 		Addr:         ":" + port,
 		Handler:      loggingMiddleware(corsMiddleware(mux)),
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 45 * time.Second,
 		IdleTimeout:  30 * time.Second,
 	}
 
@@ -168,8 +209,8 @@ func loggingMiddleware(next http.Handler) http.Handler {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -185,6 +226,13 @@ func getenvOr(k, def string) string {
 	return def
 }
 
+func getenvDuration(k string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(k)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
 func defaultSvcAddr(name string) string {
 	if strings.Contains(name, ".") {
 		return name
@@ -18,7 +18,10 @@ import (
 	"trailbox/services/gateway/internal/clients"
 )
 
-const requestTimeout = 5 * time.Second
+const (
+	requestTimeout   = 5 * time.Second
+	workoutsPageSize = 200
+)
 
 type Controller struct {
 	clients clients.Clients
@@ -28,7 +31,9 @@ func New(cl clients.Clients) *Controller {
 	return &Controller{clients: cl}
 }
 
-func (c *Controller) GetUserProfile(ctx context.Context, userID string) (*model.UserProfile, error) {
+// GetUserProfile junta los datos de userID. Rutas, reseñas y mapas se
+// limitan a las rutas que viewerID puede ver.
+func (c *Controller) GetUserProfile(ctx context.Context, userID, viewerID string) (*model.UserProfile, error) {
 	if userID == "" {
 		return nil, errors.New("user id is required")
 	}
@@ -60,11 +65,14 @@ func (c *Controller) GetUserProfile(ctx context.Context, userID string) (*model.
 		profile.AggregatedFrom = append(profile.AggregatedFrom, "workouts")
 	}
 
-	if routes, err := c.fetchRoutes(ctx, routeIDs); err == nil {
-		profile.Routes = routes
-		if len(routes) > 0 {
-			profile.AggregatedFrom = append(profile.AggregatedFrom, "routes")
-		}
+	routes := c.fetchRoutes(ctx, routeIDs, viewerID)
+	profile.Routes = routes
+	if len(routes) > 0 {
+		profile.AggregatedFrom = append(profile.AggregatedFrom, "routes")
+	}
+	routeIDs = routeIDs[:0]
+	for _, rt := range routes {
+		routeIDs = append(routeIDs, rt.GetId())
 	}
 
 	if reviews, err := c.fetchReviews(ctx, userID, routeIDs); err == nil {
@@ -97,22 +105,26 @@ func (c *Controller) GetUserProfile(ctx context.Context, userID string) (*model.
 }
 
 func (c *Controller) fetchWorkouts(ctx context.Context, userID string) ([]*workoutpb.Workout, []string, error) {
-	ctxList, cancel := context.WithTimeout(ctx, requestTimeout)
-	defer cancel()
-
-	resp, err := c.clients.Workouts.ListWorkouts(ctxList, &workoutpb.ListWorkoutsRequest{})
-	if err != nil {
-		return nil, nil, fmt.Errorf("list workouts: %w", err)
-	}
 	var workouts []*workoutpb.Workout
 	routeIDs := make(map[string]struct{})
-	for _, w := range resp.Workouts {
-		if w.GetUserId() == userID {
+	req := &workoutpb.ListWorkoutsRequest{UserId: userID, PageSize: workoutsPageSize}
+	for {
+		ctxList, cancel := context.WithTimeout(ctx, requestTimeout)
+		resp, err := c.clients.Workouts.ListWorkouts(ctxList, req)
+		cancel()
+		if err != nil {
+			return nil, nil, fmt.Errorf("list workouts: %w", err)
+		}
+		for _, w := range resp.GetWorkouts() {
 			workouts = append(workouts, w)
 			if w.GetRouteId() != "" {
 				routeIDs[w.GetRouteId()] = struct{}{}
 			}
 		}
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
 	}
 	var ids []string
 	for id := range routeIDs {
@@ -121,17 +133,19 @@ func (c *Controller) fetchWorkouts(ctx context.Context, userID string) ([]*worko
 	return workouts, ids, nil
 }
 
-func (c *Controller) fetchRoutes(ctx context.Context, ids []string) ([]*routespb.Route, error) {
-	var routes []*routespb.Route
+// fetchRoutes trae las rutas que viewerID puede ver; las demás se omiten
+// como si no existieran.
+func (c *Controller) fetchRoutes(ctx context.Context, ids []string, viewerID string) []*routespb.Route {
+	routes := []*routespb.Route{}
 	for _, id := range ids {
 		ctxRoute, cancel := context.WithTimeout(ctx, requestTimeout)
-		route, err := c.clients.Routes.GetRoute(ctxRoute, &commonpb.RouteId{Id: id})
+		route, err := c.clients.Routes.GetRoute(ctxRoute, &routespb.GetRouteRequest{Id: id, ViewerId: viewerID})
 		cancel()
 		if err == nil {
 			routes = append(routes, route)
 		}
 	}
-	return routes, nil
+	return routes
 }
 
 func (c *Controller) fetchReviews(ctx context.Context, userID string, routeIDs []string) ([]*reviewpb.Review, error) {
@@ -12,9 +12,12 @@ import (
 
 // Clients encapsulates all gRPC clients needed by the gateway.
 type Clients struct {
-	Users         userpb.UsersClient
-	Routes        routespb.RoutesClient
-	Workouts      workoutpb.WorkoutsClient
+	Users    userpb.UsersClient
+	Routes   routespb.RoutesClient
+	Workouts workoutpb.WorkoutsClient
+	// WorkoutsLive apunta a la única réplica que guarda las grabaciones en
+	// vivo; RecordWorkout y WatchWorkout tienen que ir siempre aquí.
+	WorkoutsLive  workoutpb.WorkoutsClient
 	Reviews       reviewpb.ReviewsClient
 	Leaderboard   lbpb.LeaderboardClient
 	Notifications notifpb.NotificationsClient
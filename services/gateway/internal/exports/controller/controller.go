@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	mapspb "trailbox/gen/maps"
+	routespb "trailbox/gen/routes"
+	workoutpb "trailbox/gen/workouts"
+
+	"trailbox/services/gateway/internal/clients"
+	"trailbox/services/gateway/internal/exports/writer"
+	"trailbox/services/gateway/internal/imports/parser"
+	"trailbox/services/gateway/internal/privacy"
+)
+
+const (
+	requestTimeout   = 5 * time.Second
+	workoutsPageSize = 200
+)
+
+// ErrNoGeometry indica que la ruta todavía no tiene mapa guardado.
+var ErrNoGeometry = errors.New("route has no map geometry")
+
+// File es un archivo exportado listo para enviar.
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Archive es el export completo de un usuario. Se arma entero antes de
+// escribir para poder devolver errores de los servicios con su status HTTP.
+type Archive struct {
+	UserID   string
+	Workouts []*workoutpb.Workout
+	tracks   map[string][][]parser.Point
+}
+
+type Controller struct {
+	clients clients.Clients
+	privacy *privacy.Guard
+}
+
+func New(cl clients.Clients, guard *privacy.Guard) *Controller {
+	return &Controller{clients: cl, privacy: guard}
+}
+
+// ExportRoute arma el archivo de una ruta con la geometría del servicio de
+// mapas y los metadatos del servicio de rutas. Si viewerID no es el dueño del
+// track se recortan sus zonas de privacidad.
+func (c *Controller) ExportRoute(ctx context.Context, routeID, format, viewerID string) (*File, error) {
+	if format == "" {
+		format = writer.FormatGPX
+	}
+	if !writer.Supported(format) {
+		return nil, writer.ErrUnsupportedFormat
+	}
+
+	ctxRoute, cancel := context.WithTimeout(ctx, requestTimeout)
+	route, err := c.privacy.Route(ctxRoute, routeID, viewerID)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("get route: %w", err)
+	}
+
+	ctxMap, cancel := context.WithTimeout(ctx, requestTimeout)
+	m, err := c.privacy.GetRoute(ctxMap, &mapspb.GetRouteRequest{RouteId: routeID}, viewerID)
+	cancel()
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNoGeometry
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get map: %w", err)
+	}
+	segments, err := parser.LinesFromGeoJSON(m.GetGeoJson())
+	if err != nil || len(segments) == 0 {
+		return nil, ErrNoGeometry
+	}
+
+	doc := writer.Doc{
+		Name:        route.GetName(),
+		Segments:    segments,
+		Description: routeDescription(route),
+		Properties: map[string]interface{}{
+			"route_id":         route.GetId(),
+			"distance_m":       route.GetDistanceM(),
+			"elevation_gain_m": route.GetElevationGainM(),
+			"elevation_loss_m": route.GetElevationLossM(),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writer.Write(&buf, format, doc); err != nil {
+		return nil, err
+	}
+	return &File{
+		Name:        fileName(route.GetName(), route.GetId()) + "." + format,
+		ContentType: writer.ContentType(format),
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+// CollectUserWorkouts trae todos los workouts del usuario y sus tracks, con
+// las zonas de privacidad aplicadas si viewerID no es el propio usuario.
+func (c *Controller) CollectUserWorkouts(ctx context.Context, userID, viewerID string) (*Archive, error) {
+	a := &Archive{UserID: userID, tracks: map[string][][]parser.Point{}}
+	req := &workoutpb.ListUserWorkoutsRequest{
+		UserId:   userID,
+		Order:    workoutpb.SortOrder_SORT_ORDER_DATE_ASC,
+		PageSize: workoutsPageSize,
+	}
+	for {
+		ctxList, cancel := context.WithTimeout(ctx, requestTimeout)
+		resp, err := c.clients.Workouts.ListUserWorkouts(ctxList, req)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("list workouts: %w", err)
+		}
+		a.Workouts = append(a.Workouts, resp.GetWorkouts()...)
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+
+	// Las zonas son las mismas para todos los tracks: se piden una vez.
+	ctxZones, cancel := context.WithTimeout(ctx, requestTimeout)
+	zones, err := c.privacy.Zones(ctxZones, userID, viewerID)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	// Los workouts cargados a mano no tienen track; solo van en el índice.
+	for _, w := range a.Workouts {
+		ctxTrack, cancel := context.WithTimeout(ctx, requestTimeout)
+		t, err := c.clients.Maps.GetWorkoutTrack(ctxTrack, &mapspb.GetWorkoutTrackRequest{WorkoutId: w.GetId(), PrivacyZones: zones})
+		cancel()
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get track %s: %w", w.GetId(), err)
+		}
+		if segments, err := parser.LinesFromGeoJSON(t.GetGeoJson()); err == nil && len(segments) > 0 {
+			a.tracks[w.GetId()] = segments
+		}
+	}
+	return a, nil
+}
+
+// FileName es el nombre sugerido para el zip.
+func (a *Archive) FileName() string {
+	return "trailbox-workouts-" + a.UserID + ".zip"
+}
+
+// WriteZip escribe un GPX por workout con track y un workouts.json con todos
+// los workouts, tengan track o no.
+func (a *Archive) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	used := map[string]int{}
+
+	for _, wk := range a.Workouts {
+		segments, ok := a.tracks[wk.GetId()]
+		if !ok {
+			continue
+		}
+		date, _ := time.Parse(time.RFC3339, wk.GetDate())
+		base := fileName(wk.GetName(), wk.GetId())
+		if !date.IsZero() {
+			base = date.UTC().Format("2006-01-02") + "_" + base
+		}
+		if n := used[base]; n > 0 {
+			used[base] = n + 1
+			base = fmt.Sprintf("%s_%d", base, n+1)
+		} else {
+			used[base] = 1
+		}
+
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     base + ".gpx",
+			Method:   zip.Deflate,
+			Modified: date,
+		})
+		if err != nil {
+			return err
+		}
+		if err := writer.GPX(f, writer.Doc{
+			Name:        wk.GetName(),
+			Description: fmt.Sprintf("%.0f min, %.0f kcal", wk.GetDuration(), wk.GetCalories()),
+			Time:        date,
+			Segments:    segments,
+		}); err != nil {
+			return err
+		}
+	}
+
+	f, err := zw.Create("workouts.json")
+	if err != nil {
+		return err
+	}
+	out, err := protojson.MarshalOptions{
+		UseProtoNames:   true,
+		EmitUnpopulated: true,
+		Multiline:       true,
+	}.Marshal(&workoutpb.ListWorkoutsResponse{Workouts: a.Workouts})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(out); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// routeDescription resume distancia y desnivel, seguido de la descripción
+// de la ruta si tiene.
+func routeDescription(r *routespb.Route) string {
+	d := fmt.Sprintf("%.1f km, %.0f m D+, %.0f m D-",
+		r.GetDistanceM()/1000, r.GetElevationGainM(), r.GetElevationLossM())
+	if r.GetDescription() != "" {
+		d += "\n\n" + r.GetDescription()
+	}
+	return d
+}
+
+var unsafeChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// fileName genera un nombre seguro a partir del nombre visible; si queda
+// vacío usa el ID.
+func fileName(name, id string) string {
+	s := strings.Trim(unsafeChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(s) > 60 {
+		s = strings.TrimRight(s[:60], "-")
+	}
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	if s == "" {
+		return id
+	}
+	return s + "_" + id
+}
@@ -0,0 +1,274 @@
+package writer
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"trailbox/services/gateway/internal/imports/parser"
+)
+
+// Formatos de exportación soportados.
+const (
+	FormatGPX     = "gpx"
+	FormatGeoJSON = "geojson"
+	FormatKML     = "kml"
+)
+
+// ErrUnsupportedFormat se devuelve para cualquier formato que no sea gpx,
+// geojson o kml.
+var ErrUnsupportedFormat = errors.New("unsupported export format (expected gpx, geojson or kml)")
+
+// Doc es lo que se escribe: una línea con sus metadatos. Segments son los
+// tramos de la línea; hay más de uno cuando las zonas de privacidad la
+// cortan y no se unen para no dibujar el hueco. Properties solo se usa en
+// GeoJSON.
+type Doc struct {
+	Name        string
+	Description string
+	Sport       string
+	Time        time.Time
+	Segments    [][]parser.Point
+	Properties  map[string]interface{}
+}
+
+// Supported indica si el formato se puede exportar.
+func Supported(format string) bool {
+	switch format {
+	case FormatGPX, FormatGeoJSON, FormatKML:
+		return true
+	}
+	return false
+}
+
+// ContentType devuelve el MIME de cada formato.
+func ContentType(format string) string {
+	switch format {
+	case FormatGPX:
+		return "application/gpx+xml"
+	case FormatKML:
+		return "application/vnd.google-earth.kml+xml"
+	case FormatGeoJSON:
+		return "application/geo+json"
+	}
+	return "application/octet-stream"
+}
+
+// Write codifica el documento en el formato pedido.
+func Write(w io.Writer, format string, d Doc) error {
+	switch format {
+	case FormatGPX:
+		return GPX(w, d)
+	case FormatKML:
+		return KML(w, d)
+	case FormatGeoJSON:
+		return GeoJSON(w, d)
+	}
+	return ErrUnsupportedFormat
+}
+
+type gpxDoc struct {
+	XMLName  xml.Name    `xml:"gpx"`
+	Version  string      `xml:"version,attr"`
+	Creator  string      `xml:"creator,attr"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Metadata gpxMetadata `xml:"metadata"`
+	Track    gpxTrack    `xml:"trk"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Desc string `xml:"desc,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+type gpxTrack struct {
+	Name     string       `xml:"name,omitempty"`
+	Type     string       `xml:"type,omitempty"`
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat  string `xml:"lat,attr"`
+	Lon  string `xml:"lon,attr"`
+	Ele  string `xml:"ele,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+// GPX escribe un GPX 1.1 con un único trk, que es lo que los relojes cargan
+// como curso, y un trkseg por tramo.
+func GPX(w io.Writer, d Doc) error {
+	doc := gpxDoc{
+		Version: "1.1",
+		Creator: "Trailbox",
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+		Metadata: gpxMetadata{
+			Name: d.Name,
+			Desc: d.Description,
+		},
+		Track: gpxTrack{Name: d.Name, Type: d.Sport},
+	}
+	if !d.Time.IsZero() {
+		doc.Metadata.Time = d.Time.UTC().Format(time.RFC3339)
+	}
+	doc.Track.Segments = make([]gpxSegment, 0, len(d.Segments))
+	for _, seg := range d.Segments {
+		out := gpxSegment{Points: make([]gpxPoint, 0, len(seg))}
+		for _, p := range seg {
+			pt := gpxPoint{Lat: coord(p.Lat), Lon: coord(p.Lon)}
+			if p.HasEle {
+				pt.Ele = elevation(p.Ele)
+			}
+			if !p.Time.IsZero() {
+				pt.Time = p.Time.UTC().Format(time.RFC3339)
+			}
+			out.Points = append(out.Points, pt)
+		}
+		doc.Track.Segments = append(doc.Track.Segments, out)
+	}
+	return writeXML(w, doc)
+}
+
+type kmlDoc struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name      string       `xml:"name,omitempty"`
+	Placemark kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string          `xml:"name,omitempty"`
+	Description string          `xml:"description,omitempty"`
+	Lines       []kmlLineString `xml:"MultiGeometry>LineString"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Mode        string `xml:"altitudeMode"`
+	Coordinates string `xml:"coordinates"`
+}
+
+// KML escribe un Placemark con una LineString por tramo; las alturas se
+// marcan como absolutas solo si todos los puntos la traen.
+func KML(w io.Writer, d Doc) error {
+	withEle := len(d.Segments) > 0
+	for _, seg := range d.Segments {
+		for _, p := range seg {
+			withEle = withEle && p.HasEle
+		}
+	}
+
+	mode := "clampToGround"
+	if withEle {
+		mode = "absolute"
+	}
+	lines := make([]kmlLineString, 0, len(d.Segments))
+	for _, seg := range d.Segments {
+		var sb strings.Builder
+		for i, p := range seg {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(coord(p.Lon))
+			sb.WriteByte(',')
+			sb.WriteString(coord(p.Lat))
+			if withEle {
+				sb.WriteByte(',')
+				sb.WriteString(elevation(p.Ele))
+			}
+		}
+		lines = append(lines, kmlLineString{Tessellate: 1, Mode: mode, Coordinates: sb.String()})
+	}
+	return writeXML(w, kmlDoc{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		Document: kmlDocument{
+			Name: d.Name,
+			Placemark: kmlPlacemark{
+				Name:        d.Name,
+				Description: d.Description,
+				Lines:       lines,
+			},
+		},
+	})
+}
+
+// GeoJSON escribe un Feature LineString, o MultiLineString si hay varios
+// tramos, con los metadatos en properties.
+func GeoJSON(w io.Writer, d Doc) error {
+	lines := make([][][]float64, 0, len(d.Segments))
+	for _, seg := range d.Segments {
+		coords := make([][]float64, 0, len(seg))
+		for _, p := range seg {
+			c := []float64{round(p.Lon, 6), round(p.Lat, 6)}
+			if p.HasEle {
+				c = append(c, round(p.Ele, 1))
+			}
+			coords = append(coords, c)
+		}
+		lines = append(lines, coords)
+	}
+	geometry := map[string]interface{}{"type": "MultiLineString", "coordinates": lines}
+	if len(lines) == 1 {
+		geometry = map[string]interface{}{"type": "LineString", "coordinates": lines[0]}
+	}
+
+	props := map[string]interface{}{}
+	for k, v := range d.Properties {
+		props[k] = v
+	}
+	if d.Name != "" {
+		props["name"] = d.Name
+	}
+	if d.Description != "" {
+		props["description"] = d.Description
+	}
+	if !d.Time.IsZero() {
+		props["time"] = d.Time.UTC().Format(time.RFC3339)
+	}
+
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":       "Feature",
+		"properties": props,
+		"geometry":   geometry,
+	})
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("encode xml: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func coord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 6, 64)
+}
+
+func elevation(v float64) string {
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
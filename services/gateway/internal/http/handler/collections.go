@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	routespb "trailbox/gen/routes"
+)
+
+// collectionPayload es el cuerpo de POST /api/collections y PUT
+// /api/collections/{id}. visibility es public, unlisted o private; vacío =
+// public al crear y sin cambios al editar. routeIds solo se usa al crear.
+type collectionPayload struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Visibility  string   `json:"visibility"`
+	RouteIDs    []string `json:"routeIds"`
+}
+
+func (p *collectionPayload) fields() (*routespb.CollectionFields, error) {
+	visibility, err := parseRouteEnum(routespb.RouteVisibility_value, "ROUTE_VISIBILITY_", "visibility", p.Visibility)
+	if err != nil {
+		return nil, err
+	}
+	return &routespb.CollectionFields{
+		Title:       p.Title,
+		Description: p.Description,
+		Visibility:  routespb.RouteVisibility(visibility),
+	}, nil
+}
+
+// collectionRoutesPayload es el cuerpo de POST /api/collections/{id}/routes
+// (routeId) y PUT /api/collections/{id}/routes (routeIds en el orden nuevo).
+type collectionRoutesPayload struct {
+	RouteID  string   `json:"routeId"`
+	RouteIDs []string `json:"routeIds"`
+}
+
+// handleCollections lista (GET, ?owner=&pageSize=&pageToken=) o crea (POST)
+// colecciones. El listado trae las públicas y las de quien pide.
+func (h *Handler) handleCollections(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		h.handleCreateCollection(w, r)
+		return
+	default:
+		methodNotAllowed(w)
+		return
+	}
+
+	q := r.URL.Query()
+	req := &routespb.ListCollectionsRequest{
+		OwnerId:   q.Get("owner"),
+		ViewerId:  viewerID(r),
+		PageToken: q.Get("pageToken"),
+	}
+	if v, err := strconv.Atoi(q.Get("pageSize")); err == nil && v > 0 {
+		req.PageSize = int32(v)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.clients.Routes.ListCollections(ctx, req)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleCreateCollection(w http.ResponseWriter, r *http.Request) {
+	userID := viewerID(r)
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, errViewerRequired)
+		return
+	}
+	var body collectionPayload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	fields, err := body.fields()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.clients.Routes.CreateCollection(ctx, &routespb.CreateCollectionRequest{
+		UserId:     userID,
+		Collection: fields,
+		RouteIds:   body.RouteIDs,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeProto(w, http.StatusCreated, resp)
+}
+
+// handleCollectionByID atiende /api/collections/{id} (GET, PUT, DELETE),
+// /api/collections/{id}/routes (POST agrega, PUT reordena) y
+// /api/collections/{id}/routes/{routeId} (DELETE). Solo el dueño modifica.
+func (h *Handler) handleCollectionByID(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/collections/")
+	id, sub, _ := strings.Cut(rest, "/")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+	userID := viewerID(r)
+	if r.Method != http.MethodGet && userID == "" {
+		writeError(w, http.StatusUnauthorized, errViewerRequired)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	var (
+		resp proto.Message
+		err  error
+	)
+	routeID, hasRouteID := strings.CutPrefix(sub, "routes/")
+	switch {
+	case sub == "" && r.Method == http.MethodGet:
+		resp, err = h.clients.Routes.GetCollection(ctx, &routespb.GetCollectionRequest{Id: id, ViewerId: userID})
+	case sub == "" && r.Method == http.MethodPut:
+		var body collectionPayload
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		fields, ferr := body.fields()
+		if ferr != nil {
+			writeError(w, http.StatusBadRequest, ferr)
+			return
+		}
+		resp, err = h.clients.Routes.UpdateCollection(ctx, &routespb.UpdateCollectionRequest{Id: id, UserId: userID, Collection: fields})
+	case sub == "" && r.Method == http.MethodDelete:
+		resp, err = h.clients.Routes.DeleteCollection(ctx, &routespb.DeleteCollectionRequest{Id: id, UserId: userID})
+	case sub == "routes" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		var body collectionRoutesPayload
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if r.Method == http.MethodPost {
+			resp, err = h.clients.Routes.AddCollectionRoute(ctx, &routespb.CollectionRouteRequest{Id: id, UserId: userID, RouteId: body.RouteID})
+		} else {
+			resp, err = h.clients.Routes.ReorderCollection(ctx, &routespb.ReorderCollectionRequest{Id: id, UserId: userID, RouteIds: body.RouteIDs})
+		}
+	case hasRouteID && routeID != "" && r.Method == http.MethodDelete:
+		resp, err = h.clients.Routes.RemoveCollectionRoute(ctx, &routespb.CollectionRouteRequest{Id: id, UserId: userID, RouteId: routeID})
+	case sub == "" || sub == "routes" || hasRouteID:
+		methodNotAllowed(w)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, resp)
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -18,24 +21,48 @@ import (
 	userpb "trailbox/gen/users"
 	workoutpb "trailbox/gen/workouts"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 
 	aggcontroller "trailbox/services/gateway/internal/aggregator/controller"
 	"trailbox/services/gateway/internal/clients"
+	exportcontroller "trailbox/services/gateway/internal/exports/controller"
+	"trailbox/services/gateway/internal/exports/writer"
+	importcontroller "trailbox/services/gateway/internal/imports/controller"
+	"trailbox/services/gateway/internal/privacy"
+	statscontroller "trailbox/services/gateway/internal/routestats/controller"
 )
 
-const requestTimeout = 5 * time.Second
+const (
+	requestTimeout = 5 * time.Second
+	importTimeout  = 30 * time.Second
+	exportTimeout  = 30 * time.Second
+	maxImportBytes = 32 << 20
+
+	// Máximo de rutas por ListRoutes (el page_size máximo del servicio).
+	listRoutesBatch = 100
+)
 
 type Handler struct {
 	clients    clients.Clients
 	aggregator *aggcontroller.Controller
+	importer   *importcontroller.Controller
+	exporter   *exportcontroller.Controller
+	privacy    *privacy.Guard
+	stats      *statscontroller.Controller
 }
 
-func New(cl clients.Clients, agg *aggcontroller.Controller) *Handler {
+func New(cl clients.Clients, agg *aggcontroller.Controller, imp *importcontroller.Controller, exp *exportcontroller.Controller, guard *privacy.Guard, stats *statscontroller.Controller) *Handler {
 	return &Handler{
 		clients:    cl,
 		aggregator: agg,
+		importer:   imp,
+		exporter:   exp,
+		privacy:    guard,
+		stats:      stats,
 	}
 }
 
@@ -45,9 +72,12 @@ func (h *Handler) Register(mux *http.ServeMux) {
 
 	mux.HandleFunc("/api/routes", h.handleRoutes)
 	mux.HandleFunc("/api/routes/", h.handleRouteByID)
+	mux.HandleFunc("/api/collections", h.handleCollections)
+	mux.HandleFunc("/api/collections/", h.handleCollectionByID)
 
 	mux.HandleFunc("/api/workouts", h.handleWorkouts)
 	mux.HandleFunc("/api/workouts/", h.handleWorkoutByID)
+	mux.HandleFunc("/api/workouts/record", h.handleRecordWorkout)
 
 	mux.HandleFunc("/api/reviews", h.handleReviews)
 	mux.HandleFunc("/api/leaderboard", h.handleLeaderboard)
@@ -57,7 +87,15 @@ func (h *Handler) Register(mux *http.ServeMux) {
 
 	mux.HandleFunc("/api/maps", h.handleMaps)
 	mux.HandleFunc("/api/maps/", h.handleMapByRoute)
+	mux.HandleFunc("/api/maps/search", h.handleMapSearch)
+	mux.HandleFunc("/api/maps/plan", h.handleMapPlan)
+	mux.HandleFunc("/api/tiles/", h.handleTile)
+	mux.HandleFunc("/api/heatmap/", h.handleHeatmapTile)
+	mux.HandleFunc("/api/pois", h.handlePOIs)
+	mux.HandleFunc("/api/pois/", h.handlePOIByID)
 	mux.HandleFunc("/api/aggregate/users/", h.handleAggregateUserByID)
+
+	mux.HandleFunc("/api/imports", h.handleImports)
 }
 
 func (h *Handler) handleUsers(w http.ResponseWriter, r *http.Request) {
@@ -78,14 +116,38 @@ func (h *Handler) handleUsers(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleUserByID(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		methodNotAllowed(w)
+	rest := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	id, sub, _ := strings.Cut(rest, "/")
+	if id == "" {
+		http.NotFound(w, r)
 		return
 	}
 
-	id := strings.TrimPrefix(r.URL.Path, "/api/users/")
-	if id == "" {
+	switch sub {
+	case "":
+		h.handleGetUser(w, r, id)
+	case "workouts":
+		h.handleUserWorkouts(w, r, id)
+	case "workouts/export":
+		h.handleUserWorkoutsExport(w, r, id)
+	case "stats":
+		h.handleUserStats(w, r, id)
+	case "live":
+		h.handleUserLive(w, r, id)
+	case "privacy-zones":
+		h.handlePrivacyZones(w, r, id)
+	default:
+		if zoneID, ok := strings.CutPrefix(sub, "privacy-zones/"); ok && zoneID != "" {
+			h.handlePrivacyZoneByID(w, r, id, zoneID)
+			return
+		}
 		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) handleGetUser(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
 		return
 	}
 
@@ -100,90 +162,374 @@ func (h *Handler) handleUserByID(w http.ResponseWriter, r *http.Request) {
 	writeProto(w, http.StatusOK, resp)
 }
 
-func (h *Handler) handleRoutes(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleUserWorkouts(w http.ResponseWriter, r *http.Request, userID string) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
 		return
 	}
 
+	q := r.URL.Query()
+	req := &workoutpb.ListUserWorkoutsRequest{
+		UserId:    userID,
+		PageToken: q.Get("pageToken"),
+	}
+	if q.Get("order") == "asc" {
+		req.Order = workoutpb.SortOrder_SORT_ORDER_DATE_ASC
+	}
+	if v, err := strconv.Atoi(q.Get("pageSize")); err == nil && v > 0 {
+		req.PageSize = int32(v)
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
 	defer cancel()
 
-	resp, err := h.clients.Routes.ListRoutes(ctx, &routespb.ListRoutesRequest{})
+	resp, err := h.clients.Workouts.ListUserWorkouts(ctx, req)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, err)
+		writeGRPCError(w, err)
 		return
 	}
 	writeProto(w, http.StatusOK, resp)
 }
 
-func (h *Handler) handleRouteByID(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+func (h *Handler) handleRoutes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		h.handleCreateRoute(w, r)
+		return
+	default:
 		methodNotAllowed(w)
 		return
 	}
 
-	id := strings.TrimPrefix(r.URL.Path, "/api/routes/")
+	// q usa el lenguaje de búsqueda del servicio de rutas, por ejemplo
+	// ?q=laguna distance:5..20 sort:rating
+	q := r.URL.Query()
+	req := &routespb.ListRoutesRequest{
+		Query:     q.Get("q"),
+		PageToken: q.Get("pageToken"),
+		ViewerId:  viewerID(r),
+	}
+	if v, err := strconv.Atoi(q.Get("pageSize")); err == nil && v > 0 {
+		req.PageSize = int32(v)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.clients.Routes.ListRoutes(ctx, req)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleRouteByID(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/routes/")
+	id, sub, _ := strings.Cut(rest, "/")
 	if id == "" {
 		http.NotFound(w, r)
 		return
 	}
+	switch {
+	case sub == "shares" || strings.HasPrefix(sub, "shares/"):
+		h.handleRouteShares(w, r, id, strings.TrimPrefix(strings.TrimPrefix(sub, "shares"), "/"))
+		return
+	case sub == "star":
+		h.handleRouteStar(w, r, id)
+		return
+	case sub == "" && r.Method == http.MethodPut:
+		h.handleUpdateRoute(w, r, id)
+		return
+	case sub == "" && r.Method == http.MethodDelete:
+		h.handleDeleteRoute(w, r, id)
+		return
+	case r.Method != http.MethodGet:
+		methodNotAllowed(w)
+		return
+	}
+	switch sub {
+	case "":
+	case "export":
+		h.handleRouteExport(w, r, id)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
 	defer cancel()
 
-	resp, err := h.clients.Routes.GetRoute(ctx, &commonpb.RouteId{Id: id})
+	resp, err := h.privacy.Route(ctx, id, viewerID(r))
 	if err != nil {
-		writeError(w, http.StatusBadGateway, err)
+		writeGRPCError(w, err)
 		return
 	}
 	writeProto(w, http.StatusOK, resp)
 }
 
+// handleRouteExport devuelve la ruta como gpx (por defecto), geojson o kml.
+func (h *Handler) handleRouteExport(w http.ResponseWriter, r *http.Request, id string) {
+	if h.exporter == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("exporter not configured"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	file, err := h.exporter.ExportRoute(ctx, id, r.URL.Query().Get("format"), viewerID(r))
+	switch {
+	case errors.Is(err, writer.ErrUnsupportedFormat):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, exportcontroller.ErrNoGeometry):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeGRPCError(w, err)
+	default:
+		writeAttachment(w, file.Name, file.ContentType)
+		_, _ = w.Write(file.Data)
+	}
+}
+
 func (h *Handler) handleWorkouts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+		defer cancel()
+
+		q := r.URL.Query()
+		req := &workoutpb.ListWorkoutsRequest{
+			UserId:    q.Get("userId"),
+			RouteId:   q.Get("routeId"),
+			From:      q.Get("from"),
+			To:        q.Get("to"),
+			PageToken: q.Get("pageToken"),
+		}
+		if v, err := strconv.Atoi(q.Get("pageSize")); err == nil && v > 0 {
+			req.PageSize = int32(v)
+		}
+
+		resp, err := h.clients.Workouts.ListWorkouts(ctx, req)
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		writeProto(w, http.StatusOK, resp)
+	case http.MethodPost:
+		var req workoutpb.CreateWorkoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+		defer cancel()
+
+		resp, err := h.clients.Workouts.CreateWorkout(ctx, &req)
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		h.stats.Refresh(resp.GetRouteId())
+		writeProto(w, http.StatusCreated, resp)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (h *Handler) handleWorkoutByID(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/workouts/")
+	id, sub, _ := strings.Cut(rest, "/")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+	switch sub {
+	case "":
+	case "track":
+		h.handleWorkoutTrack(w, r, id)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+		defer cancel()
+
+		// {id} es el ID del workout. Si no existe puede ser un cliente viejo
+		// que pasa un user ID: se atiende con la ruta deprecada.
+		resp, err := h.clients.Workouts.GetWorkout(ctx, &commonpb.WorkoutId{Id: id})
+		if status.Code(err) == codes.NotFound {
+			h.getWorkoutByUserDeprecated(w, r, id)
+			return
+		}
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		writeProto(w, http.StatusOK, resp)
+	case http.MethodPut:
+		var req workoutpb.UpdateWorkoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		req.Id = id
+
+		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+		defer cancel()
+
+		// La ruta anterior también cambia de popularidad si el workout se
+		// mueve a otra.
+		prev, _ := h.clients.Workouts.GetWorkout(ctx, &commonpb.WorkoutId{Id: id})
+		resp, err := h.clients.Workouts.UpdateWorkout(ctx, &req)
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		h.stats.Refresh(prev.GetRouteId(), resp.GetRouteId())
+		writeProto(w, http.StatusOK, resp)
+	case http.MethodDelete:
+		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+		defer cancel()
+
+		prev, _ := h.clients.Workouts.GetWorkout(ctx, &commonpb.WorkoutId{Id: id})
+		resp, err := h.clients.Workouts.DeleteWorkout(ctx, &workoutpb.DeleteWorkoutRequest{Id: id})
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		h.stats.Refresh(prev.GetRouteId())
+		writeProto(w, http.StatusOK, resp)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (h *Handler) handleUserStats(w http.ResponseWriter, r *http.Request, userID string) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
 		return
 	}
 
+	q := r.URL.Query()
+	req := &workoutpb.GetUserStatsRequest{UserId: userID}
+	switch q.Get("period") {
+	case "", "week":
+	case "month":
+		req.Period = workoutpb.StatsPeriod_STATS_PERIOD_MONTH
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("period must be week or month"))
+		return
+	}
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 {
+		req.Limit = int32(v)
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
 	defer cancel()
 
-	resp, err := h.clients.Workouts.ListWorkouts(ctx, &workoutpb.ListWorkoutsRequest{})
+	// Los workouts sin distancia propia usan la de su ruta, que vive en el
+	// servicio de rutas. Solo se piden esas rutas, de a lotes y con el
+	// usuario como viewer; si algo falla esos workouts salen sin distancia.
+	if ids, err := h.clients.Workouts.ListStatsRouteIds(ctx, &commonpb.UserId{Id: userID}); err == nil {
+		all := ids.GetRouteIds()
+		req.RouteDistancesM = make(map[string]float64, len(all))
+		for start := 0; start < len(all); start += listRoutesBatch {
+			batch := all[start:min(start+listRoutesBatch, len(all))]
+			routes, err := h.clients.Routes.ListRoutes(ctx, &routespb.ListRoutesRequest{Ids: batch, PageSize: int32(len(batch)), ViewerId: userID})
+			if err != nil {
+				break
+			}
+			for _, rt := range routes.GetRoutes() {
+				req.RouteDistancesM[rt.GetId()] = rt.GetDistanceM()
+			}
+		}
+	}
+
+	resp, err := h.clients.Workouts.GetUserStats(ctx, req)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, err)
+		writeGRPCError(w, err)
 		return
 	}
 	writeProto(w, http.StatusOK, resp)
 }
 
-func (h *Handler) handleWorkoutByID(w http.ResponseWriter, r *http.Request) {
+// handleUserWorkoutsExport descarga un zip con un GPX por workout con track
+// y un workouts.json con todos los workouts del usuario.
+func (h *Handler) handleUserWorkoutsExport(w http.ResponseWriter, r *http.Request, userID string) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
 		return
 	}
+	if h.exporter == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("exporter not configured"))
+		return
+	}
 
-	id := strings.TrimPrefix(r.URL.Path, "/api/workouts/")
-	if id == "" {
-		http.NotFound(w, r)
+	ctx, cancel := context.WithTimeout(r.Context(), exportTimeout)
+	defer cancel()
+
+	archive, err := h.exporter.CollectUserWorkouts(ctx, userID, viewerID(r))
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeAttachment(w, archive.FileName(), "application/zip")
+	_ = archive.WriteZip(w)
+}
+
+func (h *Handler) handleWorkoutTrack(w http.ResponseWriter, r *http.Request, workoutID string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
 	defer cancel()
 
-	resp, err := h.clients.Workouts.GetWorkout(ctx, &commonpb.UserId{Id: id})
+	resp, err := h.privacy.GetWorkoutTrack(ctx, workoutID, viewerID(r))
 	if err != nil {
-		writeError(w, http.StatusBadGateway, err)
+		writeGRPCError(w, err)
 		return
 	}
 	writeProto(w, http.StatusOK, resp)
 }
 
+// getWorkoutByUserDeprecated mantiene funcionando a los clientes que pasaban
+// un user ID a /api/workouts/{id}: responde con el workout más reciente del
+// usuario y apunta al endpoint nuevo en las cabeceras Deprecation y Link.
+func (h *Handler) getWorkoutByUserDeprecated(w http.ResponseWriter, r *http.Request, userID string) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.clients.Workouts.ListUserWorkouts(ctx, &workoutpb.ListUserWorkoutsRequest{
+		UserId:   userID,
+		Order:    workoutpb.SortOrder_SORT_ORDER_DATE_DESC,
+		PageSize: 1,
+	})
+	if err != nil || len(resp.GetWorkouts()) == 0 {
+		writeError(w, http.StatusNotFound, errors.New("workout not found"))
+		return
+	}
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", "</api/users/"+userID+"/workouts>; rel=\"successor-version\"")
+	writeProto(w, http.StatusOK, resp.GetWorkouts()[0])
+}
+
 func (h *Handler) handleReviews(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		routeID := r.URL.Query().Get("routeId")
+		if !h.checkRouteAccess(w, r, routeID) {
+			return
+		}
 		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
 		defer cancel()
 
@@ -199,6 +545,9 @@ func (h *Handler) handleReviews(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, err)
 			return
 		}
+		if !h.checkRouteAccess(w, r, req.RouteId) {
+			return
+		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
 		defer cancel()
@@ -208,6 +557,7 @@ func (h *Handler) handleReviews(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadGateway, err)
 			return
 		}
+		h.stats.Refresh(resp.GetRouteId())
 		writeProto(w, http.StatusCreated, resp)
 	default:
 		methodNotAllowed(w)
@@ -300,52 +650,464 @@ func (h *Handler) handleNotificationsByUser(w http.ResponseWriter, r *http.Reque
 	writeProto(w, http.StatusOK, resp)
 }
 
+// handleMaps guarda una versión nueva de la geometría de una ruta. Pueden
+// hacerlo quienes pueden editar el mapa (ver canEditMap), que quedan como
+// autores de la versión.
 func (h *Handler) handleMaps(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		methodNotAllowed(w)
 		return
 	}
+	userID := viewerID(r)
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, errViewerRequired)
+		return
+	}
 
 	var req mapspb.SetRouteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
+	route, ok := h.visibleRoute(w, r, req.GetRouteId())
+	if !ok {
+		return
+	}
+	if !canEditMap(route, userID) {
+		writeError(w, http.StatusForbidden, errMapEditDenied)
+		return
+	}
+	req.AuthorId = userID
+	if req.Name == "" {
+		req.Name = route.GetName()
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
 	defer cancel()
 
 	resp, err := h.clients.Maps.SetRoute(ctx, &req)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, err)
+		writeGRPCError(w, err)
 		return
 	}
+	h.syncRouteMapStats(ctx, route)
 	writeProto(w, http.StatusCreated, resp)
 }
 
 func (h *Handler) handleMapByRoute(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/maps/")
+	routeID, sub, _ := strings.Cut(rest, "/")
+	if routeID == "" {
+		http.NotFound(w, r)
+		return
+	}
+	// Todo lo que cuelga de /api/maps/{id} sigue la visibilidad de la ruta.
+	route, ok := h.visibleRoute(w, r, routeID)
+	if !ok {
+		return
+	}
+	switch {
+	case sub == "revert":
+		h.handleMapRevert(w, r, route)
+		return
+	case r.Method != http.MethodGet:
+		methodNotAllowed(w)
+		return
+	case sub == "":
+	case sub == "stats":
+		h.handleMapStats(w, r, routeID)
+		return
+	case sub == "pois":
+		h.handleRoutePOIs(w, r, routeID)
+		return
+	case sub == "preview.png":
+		h.handleMapPreview(w, r, route)
+		return
+	case sub == "versions" || strings.HasPrefix(sub, "versions/"):
+		h.handleMapVersions(w, r, routeID, strings.TrimPrefix(strings.TrimPrefix(sub, "versions"), "/"))
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	// ?zoom= o ?tolerance= (metros) simplifican la línea; ?format=polyline
+	// devuelve polilíneas codificadas en lugar de GeoJSON.
+	q := r.URL.Query()
+	req := &mapspb.GetRouteRequest{RouteId: routeID}
+	if v, err := strconv.Atoi(q.Get("zoom")); err == nil {
+		req.Zoom = int32(v)
+	}
+	if v, err := strconv.ParseFloat(q.Get("tolerance"), 64); err == nil {
+		req.ToleranceM = v
+	}
+	switch q.Get("format") {
+	case "", "geojson":
+	case "polyline":
+		req.Format = mapspb.GeometryFormat_GEOMETRY_FORMAT_POLYLINE
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("format must be geojson or polyline"))
+		return
+	}
+
+	resp, err := h.privacy.GetRoute(ctx, req, viewerID(r))
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, resp)
+}
+
+// handleMapStats devuelve distancia, desnivel, bbox y perfil de altura
+// calculados por el servicio de mapas, sin las zonas de privacidad del dueño
+// del track.
+func (h *Handler) handleMapStats(w http.ResponseWriter, r *http.Request, routeID string) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.privacy.GetRouteStats(ctx, &mapspb.GetRouteStatsRequest{RouteId: routeID}, viewerID(r))
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, resp)
+}
+
+// handleTile sirve /api/tiles/{z}/{x}/{y}.mvt. Una tesela sin rutas se
+// responde con 200 y cuerpo vacío, como esperan los clientes de mapas.
+func (h *Handler) handleTile(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
 		return
 	}
 
-	routeID := strings.TrimPrefix(r.URL.Path, "/api/maps/")
-	if routeID == "" {
+	zxy, ok := parseTilePath(w, r, "/api/tiles/", ".mvt")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	tile, err := h.clients.Maps.GetTile(ctx, &mapspb.GetTileRequest{Z: zxy[0], X: zxy[1], Y: zxy[2]})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(tile.GetData())
+}
+
+// handleHeatmapTile sirve /api/heatmap/{z}/{x}/{y}.png: el heatmap global o,
+// con ?userId=, el de un usuario. Si quien pide no es ese usuario se
+// enmascaran sus zonas de privacidad.
+func (h *Handler) handleHeatmapTile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	zxy, ok := parseTilePath(w, r, "/api/heatmap/", ".png")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	req := &mapspb.GetHeatmapTileRequest{Z: zxy[0], X: zxy[1], Y: zxy[2], UserId: r.URL.Query().Get("userId")}
+	zones, err := h.privacy.Zones(ctx, req.UserId, viewerID(r))
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	req.PrivacyZones = zones
+
+	tile, err := h.clients.Maps.GetHeatmapTile(ctx, req)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	if req.UserId != "" {
+		// Depende de quién pide; no se comparte entre usuarios.
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		w.Header().Set("Vary", "X-User-ID")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(tile.GetPng())
+}
+
+// parseTilePath lee {z}/{x}/{y}<ext> después de prefix. Si no puede, ya
+// respondió con 404 o 400.
+func parseTilePath(w http.ResponseWriter, r *http.Request, prefix, ext string) ([3]int32, bool) {
+	var zxy [3]int32
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if len(parts) != 3 || !strings.HasSuffix(parts[2], ext) {
 		http.NotFound(w, r)
+		return zxy, false
+	}
+	parts[2] = strings.TrimSuffix(parts[2], ext)
+	for i, p := range parts {
+		v, err := strconv.ParseInt(p, 10, 32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("tile path must be {z}/{x}/{y}%s", ext))
+			return zxy, false
+		}
+		zxy[i] = int32(v)
+	}
+	return zxy, true
+}
+
+// handleMapPreview devuelve la miniatura PNG de la ruta: ?w=&h= en píxeles y
+// ?style=plain|elevation|grade. El ETag cambia con la versión del mapa.
+func (h *Handler) handleMapPreview(w http.ResponseWriter, r *http.Request, route *routespb.Route) {
+	routeID := route.GetId()
+	q := r.URL.Query()
+	req := &mapspb.RenderRoutePreviewRequest{RouteId: routeID}
+	for _, p := range []struct {
+		name string
+		dst  *int32
+	}{{"w", &req.Width}, {"h", &req.Height}} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("%s must be a number of pixels", p.name))
+				return
+			}
+			*p.dst = int32(n)
+		}
+	}
+	switch q.Get("style") {
+	case "", "plain":
+	case "elevation":
+		req.Style = mapspb.PreviewStyle_PREVIEW_STYLE_ELEVATION
+	case "grade":
+		req.Style = mapspb.PreviewStyle_PREVIEW_STYLE_GRADE
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("style must be plain, elevation or grade"))
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
 	defer cancel()
 
-	resp, err := h.clients.Maps.GetRoute(ctx, &mapspb.GetRouteRequest{RouteId: routeID})
+	resp, err := h.privacy.RenderRoutePreview(ctx, req, viewerID(r))
 	if err != nil {
-		writeError(w, http.StatusBadGateway, err)
+		writeGRPCError(w, err)
+		return
+	}
+	// El dueño del track la ve sin recortar: su ETag es otro y no se
+	// comparte.
+	owner := resp.GetOwnerId() != "" && resp.GetOwnerId() == viewerID(r)
+	suffix := ""
+	if owner {
+		suffix = "-owner"
+	}
+	etag := fmt.Sprintf(`"%s-v%d-%dx%d-%d%s"`, routeID, resp.GetVersion(), resp.GetWidth(), resp.GetHeight(), req.Style, suffix)
+	w.Header().Set("ETag", etag)
+	if route.GetVisibility() == routespb.RouteVisibility_ROUTE_VISIBILITY_PUBLIC && !owner {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	} else {
+		// Solo la ven algunos usuarios; un cache compartido no puede guardarla.
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		w.Header().Set("Vary", "X-User-ID")
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(resp.GetPng())
+}
+
+// handleMapVersions lista el historial de la geometría o, con número,
+// devuelve una versión con su GeoJSON sin las zonas de privacidad de su
+// dueño.
+func (h *Handler) handleMapVersions(w http.ResponseWriter, r *http.Request, routeID, version string) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	if version == "" {
+		resp, err := h.clients.Maps.ListRouteMapVersions(ctx, &mapspb.ListRouteMapVersionsRequest{RouteId: routeID})
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		writeProto(w, http.StatusOK, resp)
+		return
+	}
+
+	n, err := strconv.Atoi(version)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("version must be a number"))
+		return
+	}
+	resp, err := h.privacy.GetRouteMapVersion(ctx, &mapspb.GetRouteMapVersionRequest{RouteId: routeID, Version: int32(n)}, viewerID(r))
+	if err != nil {
+		writeGRPCError(w, err)
 		return
 	}
 	writeProto(w, http.StatusOK, resp)
 }
 
+// handleMapRevert restaura una versión anterior; body {"version": n}. Pueden
+// hacerlo quienes pueden editar el mapa y quedan como autores de la versión
+// nueva.
+func (h *Handler) handleMapRevert(w http.ResponseWriter, r *http.Request, route *routespb.Route) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	userID := viewerID(r)
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, errViewerRequired)
+		return
+	}
+	if !canEditMap(route, userID) {
+		writeError(w, http.StatusForbidden, errMapEditDenied)
+		return
+	}
+
+	var body struct {
+		Version int32 `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	req := &mapspb.RevertRouteMapRequest{RouteId: route.GetId(), Version: body.Version, AuthorId: userID}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.clients.Maps.RevertRouteMap(ctx, req)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	h.syncRouteMapStats(ctx, route)
+	writeProto(w, http.StatusCreated, resp)
+}
+
+type routeSearchResult struct {
+	Route     *routespb.Route     `json:"route"`
+	DistanceM float64             `json:"distance_m"`
+	Nearest   *mapspb.LatLon      `json:"nearest"`
+	BBox      *mapspb.BoundingBox `json:"bbox"`
+	LengthM   float64             `json:"length_m"`
+}
+
+// handleMapSearch busca rutas cerca de un punto (?lat=&lon=&radius= en
+// metros) o dentro de una caja (?bbox=minLon,minLat,maxLon,maxLat) y une
+// cada resultado con los datos del servicio de rutas.
+func (h *Handler) handleMapSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := 0
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	var (
+		resp *mapspb.SearchRoutesResponse
+		err  error
+	)
+	if bbox := q.Get("bbox"); bbox != "" {
+		parts := strings.Split(bbox, ",")
+		if len(parts) != 4 {
+			writeError(w, http.StatusBadRequest, errors.New("bbox must be minLon,minLat,maxLon,maxLat"))
+			return
+		}
+		vals := make([]float64, 4)
+		for i, p := range parts {
+			if vals[i], err = strconv.ParseFloat(strings.TrimSpace(p), 64); err != nil {
+				writeError(w, http.StatusBadRequest, errors.New("bbox must be minLon,minLat,maxLon,maxLat"))
+				return
+			}
+		}
+		resp, err = h.clients.Maps.SearchRoutesInBBox(ctx, &mapspb.SearchRoutesInBBoxRequest{
+			Bbox: &mapspb.BoundingBox{
+				MinLon: vals[0],
+				MinLat: vals[1],
+				MaxLon: vals[2],
+				MaxLat: vals[3],
+			},
+			Limit: int32(limit),
+		})
+	} else {
+		lat, errLat := strconv.ParseFloat(q.Get("lat"), 64)
+		lon, errLon := strconv.ParseFloat(q.Get("lon"), 64)
+		if errLat != nil || errLon != nil {
+			writeError(w, http.StatusBadRequest, errors.New("lat and lon (or bbox) are required"))
+			return
+		}
+		radius := 5000.0
+		if v, err := strconv.ParseFloat(q.Get("radius"), 64); err == nil {
+			radius = v
+		}
+		resp, err = h.clients.Maps.SearchRoutesNear(ctx, &mapspb.SearchRoutesNearRequest{
+			Lat:     lat,
+			Lon:     lon,
+			RadiusM: radius,
+			Limit:   int32(limit),
+		})
+	}
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	ids := make([]string, 0, len(resp.GetRoutes()))
+	for _, m := range resp.GetRoutes() {
+		ids = append(ids, m.GetRouteId())
+	}
+	routes := &routespb.ListRoutesResponse{}
+	if len(ids) > 0 {
+		routes, err = h.clients.Routes.ListRoutes(ctx, &routespb.ListRoutesRequest{Ids: ids, PageSize: int32(len(ids)), ViewerId: viewerID(r)})
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+	}
+	byID := make(map[string]*routespb.Route, len(routes.GetRoutes()))
+	for _, rt := range routes.GetRoutes() {
+		byID[rt.GetId()] = rt
+	}
+
+	// Los mapas sin ruta en el servicio de rutas (huérfanos) o que quien pide
+	// no puede ver se omiten.
+	results := make([]routeSearchResult, 0, len(resp.GetRoutes()))
+	for _, m := range resp.GetRoutes() {
+		rt, ok := byID[m.GetRouteId()]
+		if !ok {
+			continue
+		}
+		results = append(results, routeSearchResult{
+			Route:     rt,
+			DistanceM: m.GetDistanceM(),
+			Nearest:   m.GetNearest(),
+			BBox:      m.GetBbox(),
+			LengthM:   m.GetLengthM(),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
 func (h *Handler) handleAggregateUserByID(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
@@ -365,7 +1127,7 @@ func (h *Handler) handleAggregateUserByID(w http.ResponseWriter, r *http.Request
 	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
 	defer cancel()
 
-	profile, err := h.aggregator.GetUserProfile(ctx, id)
+	profile, err := h.aggregator.GetUserProfile(ctx, id, viewerID(r))
 	if err != nil {
 		writeError(w, http.StatusBadGateway, err)
 		return
@@ -373,6 +1135,64 @@ func (h *Handler) handleAggregateUserByID(w http.ResponseWriter, r *http.Request
 	writeJSON(w, http.StatusOK, profile)
 }
 
+// handleImports recibe un multipart con el archivo (campo "file") y los
+// campos user_id, route_id, name, duration y calories.
+func (h *Handler) handleImports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	if h.importer == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("importer not configured"))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	if err := r.ParseMultipartForm(maxImportBytes); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("file is required"))
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	in := importcontroller.Input{
+		UserID:   r.FormValue("user_id"),
+		RouteID:  r.FormValue("route_id"),
+		Name:     r.FormValue("name"),
+		Filename: header.Filename,
+		Data:     data,
+	}
+	if v, err := strconv.Atoi(r.FormValue("duration")); err == nil {
+		in.Duration = v
+	}
+	if v, err := strconv.Atoi(r.FormValue("calories")); err == nil {
+		in.Calories = v
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), importTimeout)
+	defer cancel()
+
+	res, err := h.importer.Import(ctx, in)
+	switch {
+	case errors.Is(err, importcontroller.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, err)
+	case err != nil:
+		writeGRPCError(w, err)
+	default:
+		h.stats.Refresh(res.Workout.GetRouteId())
+		writeJSON(w, http.StatusCreated, res)
+	}
+}
+
 func writeProto(w http.ResponseWriter, status int, msg proto.Message) {
 	out, err := protojson.MarshalOptions{
 		UseProtoNames:   true,
@@ -393,6 +1213,37 @@ func writeError(w http.ResponseWriter, status int, err error) {
 	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 }
 
+// writeGRPCError traduce el código gRPC del servicio a un status HTTP.
+func writeGRPCError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	code := http.StatusBadGateway
+	switch st.Code() {
+	case codes.InvalidArgument:
+		code = http.StatusBadRequest
+	case codes.NotFound:
+		code = http.StatusNotFound
+	case codes.PermissionDenied:
+		code = http.StatusForbidden
+	case codes.FailedPrecondition:
+		code = http.StatusConflict
+	}
+
+	body := map[string]string{"error": st.Message()}
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok && len(br.GetFieldViolations()) > 0 {
+			body["field"] = br.GetFieldViolations()[0].GetField()
+			break
+		}
+	}
+	writeJSON(w, code, body)
+}
+
+func writeAttachment(w http.ResponseWriter, filename, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.WriteHeader(http.StatusOK)
+}
+
 func methodNotAllowed(w http.ResponseWriter) {
 	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 }
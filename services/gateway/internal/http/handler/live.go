@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	mapspb "trailbox/gen/maps"
+	workoutpb "trailbox/gen/workouts"
+
+	"trailbox/services/gateway/internal/privacy"
+)
+
+// Comentario SSE periódico para que proxies y balanceadores no corten la
+// conexión mientras no hay puntos nuevos.
+const sseKeepAlive = 15 * time.Second
+
+type recordResult struct {
+	Workout      *workoutpb.Workout `json:"workout"`
+	Points       int32              `json:"points"`
+	PaceMinPerKm float64            `json:"pace_min_per_km"`
+	TrackSaved   bool               `json:"track_saved"`
+}
+
+// handleRecordWorkout recibe los puntos de una grabación en vivo como NDJSON
+// (un TrackPoint por línea) en un cuerpo chunked y los reenvía al stream
+// RecordWorkout. Al cerrar el cuerpo se guarda el workout y su track.
+func (h *Handler) handleRecordWorkout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	// Una grabación dura lo que dure el entrenamiento: se quitan los
+	// timeouts del servidor solo para esta petición.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stream, err := h.clients.WorkoutsLive.RecordWorkout(ctx)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	dec := json.NewDecoder(r.Body)
+	for {
+		var pt workoutpb.TrackPoint
+		err := dec.Decode(&pt)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		// Si el servicio cerró el stream, el motivo llega en CloseAndRecv.
+		if err := stream.Send(&pt); err != nil {
+			break
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	res := recordResult{
+		Workout:      resp.GetWorkout(),
+		Points:       resp.GetPoints(),
+		PaceMinPerKm: resp.GetPaceMinPerKm(),
+	}
+	ctxTrack, cancelTrack := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancelTrack()
+	_, err = h.clients.Maps.SetWorkoutTrack(ctxTrack, &mapspb.SetWorkoutTrackRequest{
+		WorkoutId: resp.GetWorkout().GetId(),
+		UserId:    resp.GetWorkout().GetUserId(),
+		GeoJson:   resp.GetGeoJson(),
+	})
+	if err != nil {
+		log.Printf("[gateway] save track for workout %s: %v", resp.GetWorkout().GetId(), err)
+	}
+	res.TrackSaved = err == nil
+	h.stats.Refresh(resp.GetWorkout().GetRouteId())
+	writeJSON(w, http.StatusCreated, res)
+}
+
+// handleUserLive retransmite por SSE el progreso de la grabación en curso
+// del usuario. Emite eventos "progress", un "finished" al terminar y "error"
+// si el servicio corta el stream. Para quien no es el dueño, los puntos
+// dentro de sus zonas de privacidad salen sin posición ni altura; las zonas
+// se leen al abrir el stream.
+func (h *Handler) handleUserLive(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	zones, err := h.privacy.Zones(ctx, userID, viewerID(r))
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	stream, err := h.clients.WorkoutsLive.WatchWorkout(ctx, &workoutpb.WatchWorkoutRequest{UserId: userID})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	type result struct {
+		msg *workoutpb.WorkoutProgress
+		err error
+	}
+	updates := make(chan result)
+	go func() {
+		defer close(updates)
+		for {
+			msg, err := stream.Recv()
+			select {
+			case updates <- result{msg, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case u, ok := <-updates:
+			if !ok {
+				return
+			}
+			if u.err == io.EOF {
+				return
+			}
+			if u.err != nil {
+				writeSSE(w, "error", map[string]string{"error": status.Convert(u.err).Message()})
+				_ = rc.Flush()
+				return
+			}
+			event := "progress"
+			if u.msg.GetFinished() {
+				event = "finished"
+			}
+			msg := u.msg
+			if len(zones) > 0 && privacy.Inside(msg.GetLat(), msg.GetLon(), zones) {
+				msg = proto.Clone(msg).(*workoutpb.WorkoutProgress)
+				msg.Lat, msg.Lon, msg.Elevation = 0, 0, 0
+			}
+			if err := writeSSE(w, event, msg); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeSSE escribe un evento; protojson y encoding/json generan una sola
+// línea, así que cabe en un único campo data.
+func writeSSE(w io.Writer, event string, payload interface{}) error {
+	var (
+		data []byte
+		err  error
+	)
+	if msg, ok := payload.(proto.Message); ok {
+		data, err = protojson.MarshalOptions{
+			UseProtoNames:   true,
+			EmitUnpopulated: true,
+		}.Marshal(msg)
+	} else {
+		data, err = json.Marshal(payload)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
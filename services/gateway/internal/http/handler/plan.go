@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	mapspb "trailbox/gen/maps"
+)
+
+type latLonPayload struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// planPayload es el cuerpo de POST /api/maps/plan. optimize es "distance"
+// (por defecto) o "elevation".
+type planPayload struct {
+	Start    *latLonPayload  `json:"start"`
+	End      *latLonPayload  `json:"end"`
+	Via      []latLonPayload `json:"via"`
+	Optimize string          `json:"optimize"`
+}
+
+var planOptimize = map[string]mapspb.PlanOptimize{
+	"":          mapspb.PlanOptimize_PLAN_OPTIMIZE_DISTANCE,
+	"distance":  mapspb.PlanOptimize_PLAN_OPTIMIZE_DISTANCE,
+	"elevation": mapspb.PlanOptimize_PLAN_OPTIMIZE_ELEVATION,
+}
+
+// handleMapPlan arma un camino nuevo con tramos de las rutas guardadas.
+func (h *Handler) handleMapPlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	var body planPayload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.Start == nil || body.End == nil {
+		writeError(w, http.StatusBadRequest, errors.New("start and end are required"))
+		return
+	}
+	opt, ok := planOptimize[body.Optimize]
+	if !ok {
+		writeError(w, http.StatusBadRequest, errors.New("optimize must be distance or elevation"))
+		return
+	}
+	req := &mapspb.PlanRouteRequest{
+		Start:    &mapspb.LatLon{Lat: body.Start.Lat, Lon: body.Start.Lon},
+		End:      &mapspb.LatLon{Lat: body.End.Lat, Lon: body.End.Lon},
+		Optimize: opt,
+	}
+	for _, v := range body.Via {
+		req.Via = append(req.Via, &mapspb.LatLon{Lat: v.Lat, Lon: v.Lon})
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.clients.Maps.PlanRoute(ctx, req)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, resp)
+}
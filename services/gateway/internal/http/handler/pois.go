@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	mapspb "trailbox/gen/maps"
+)
+
+// poiPayload es el cuerpo de POST /api/pois y PUT /api/pois/{id}. El tipo
+// viaja como texto ("water", "hazard"...) en lugar del número del enum.
+type poiPayload struct {
+	Type        string  `json:"type"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	PhotoRef    string  `json:"photoRef"`
+	CreatedBy   string  `json:"createdBy"`
+}
+
+func parsePOIType(s string) (mapspb.POIType, error) {
+	v, ok := mapspb.POIType_value["POI_TYPE_"+strings.ToUpper(strings.TrimSpace(s))]
+	if !ok || v == int32(mapspb.POIType_POI_TYPE_UNSPECIFIED) {
+		return 0, fmt.Errorf("unknown poi type %q", s)
+	}
+	return mapspb.POIType(v), nil
+}
+
+func (h *Handler) handlePOIs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	var body poiPayload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	typ, err := parsePOIType(body.Type)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.clients.Maps.CreatePOI(ctx, &mapspb.CreatePOIRequest{
+		Type:        typ,
+		Lat:         body.Lat,
+		Lon:         body.Lon,
+		Name:        body.Name,
+		Description: body.Description,
+		PhotoRef:    body.PhotoRef,
+		CreatedBy:   body.CreatedBy,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeProto(w, http.StatusCreated, resp)
+}
+
+func (h *Handler) handlePOIByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/pois/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		resp, err := h.clients.Maps.GetPOI(ctx, &mapspb.GetPOIRequest{Id: id})
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		writeProto(w, http.StatusOK, resp)
+	case http.MethodPut:
+		var body poiPayload
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		typ, err := parsePOIType(body.Type)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		resp, err := h.clients.Maps.UpdatePOI(ctx, &mapspb.UpdatePOIRequest{
+			Id:          id,
+			Type:        typ,
+			Lat:         body.Lat,
+			Lon:         body.Lon,
+			Name:        body.Name,
+			Description: body.Description,
+			PhotoRef:    body.PhotoRef,
+		})
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		writeProto(w, http.StatusOK, resp)
+	case http.MethodDelete:
+		resp, err := h.clients.Maps.DeletePOI(ctx, &mapspb.DeletePOIRequest{Id: id})
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		writeProto(w, http.StatusOK, resp)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// handleRoutePOIs lista los POIs cerca de la ruta: ?within= en metros y
+// ?type=water,hazard para filtrar.
+func (h *Handler) handleRoutePOIs(w http.ResponseWriter, r *http.Request, routeID string) {
+	q := r.URL.Query()
+	req := &mapspb.ListPOIsForRouteRequest{RouteId: routeID}
+	if v := q.Get("within"); v != "" {
+		within, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("within must be a number of meters"))
+			return
+		}
+		req.WithinM = within
+	}
+	if v := q.Get("type"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			typ, err := parsePOIType(s)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			req.Types = append(req.Types, typ)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.clients.Maps.ListPOIsForRoute(ctx, req)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, resp)
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	userpb "trailbox/gen/users"
+)
+
+// viewerHeader identifica a quien hace la petición. Todavía no hay
+// autenticación: el frontend lo manda con el ID del usuario activo y sin él
+// se trata como un visitante anónimo. Cualquiera puede mandar otro ID, así
+// que la visibilidad y los permisos que se apoyan en él no son control de
+// acceso; hace falta un proxy que autentique y fije la cabecera (ver
+// docs/cluster-specs.md).
+const viewerHeader = "X-User-ID"
+
+func viewerID(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get(viewerHeader))
+}
+
+// privacyZonePayload es el cuerpo de POST /api/users/{id}/privacy-zones.
+type privacyZonePayload struct {
+	Name    string  `json:"name"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	RadiusM float64 `json:"radiusM"`
+}
+
+var errNotOwner = errors.New("privacy zones are only visible to their owner")
+
+// handlePrivacyZones lista (GET) o crea (POST) las zonas de un usuario. Solo
+// el propio usuario puede verlas: revelarían justo lo que esconden.
+func (h *Handler) handlePrivacyZones(w http.ResponseWriter, r *http.Request, userID string) {
+	if viewerID(r) != userID {
+		writeError(w, http.StatusForbidden, errNotOwner)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		resp, err := h.clients.Users.ListPrivacyZones(ctx, &userpb.ListPrivacyZonesRequest{UserId: userID})
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		writeProto(w, http.StatusOK, resp)
+	case http.MethodPost:
+		var body privacyZonePayload
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		resp, err := h.clients.Users.CreatePrivacyZone(ctx, &userpb.CreatePrivacyZoneRequest{
+			UserId:  userID,
+			Name:    body.Name,
+			Lat:     body.Lat,
+			Lon:     body.Lon,
+			RadiusM: body.RadiusM,
+		})
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		h.syncZones(userID)
+		writeProto(w, http.StatusCreated, resp)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (h *Handler) handlePrivacyZoneByID(w http.ResponseWriter, r *http.Request, userID, zoneID string) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w)
+		return
+	}
+	if viewerID(r) != userID {
+		writeError(w, http.StatusForbidden, errNotOwner)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.clients.Users.DeletePrivacyZone(ctx, &userpb.DeletePrivacyZoneRequest{Id: zoneID, UserId: userID})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	h.syncZones(userID)
+	writeProto(w, http.StatusOK, resp)
+}
+
+// syncZones pasa las zonas de userID al servicio de mapas para el heatmap
+// global. Si falla la zona ya está guardada; la recupera la sincronización
+// periódica.
+func (h *Handler) syncZones(userID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if err := h.privacy.SyncZones(ctx, userID); err != nil {
+		log.Printf("[gateway] sync privacy zones of user %s: %v", userID, err)
+	}
+}
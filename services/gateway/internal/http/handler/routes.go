@@ -0,0 +1,389 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	mapspb "trailbox/gen/maps"
+	routespb "trailbox/gen/routes"
+)
+
+// routePayload es el cuerpo de POST /api/routes y PUT /api/routes/{id}. Si
+// trae geoJson, la geometría se guarda en el servicio de mapas en la misma
+// petición. distanceM y el desnivel solo quedan si la ruta no tiene
+// geometría; si la tiene se usan los que mide el servicio de mapas. Dificultad, superficie y tipo viajan como texto ("moderate",
+// "out_and_back"...); vacío = sin clasificar. visibility es public, unlisted,
+// private o shared; vacío = public al crear y sin cambios al editar.
+type routePayload struct {
+	Name                 string   `json:"name"`
+	Description          string   `json:"description"`
+	DistanceM            float64  `json:"distanceM"`
+	ElevationGainM       float64  `json:"elevationGainM"`
+	ElevationLossM       float64  `json:"elevationLossM"`
+	EstimatedDurationMin int32    `json:"estimatedDurationMin"`
+	Difficulty           string   `json:"difficulty"`
+	Surface              string   `json:"surface"`
+	RouteType            string   `json:"routeType"`
+	Region               string   `json:"region"`
+	Tags                 []string `json:"tags"`
+	Visibility           string   `json:"visibility"`
+	GeoJSON              string   `json:"geoJson"`
+}
+
+func (p *routePayload) fields() (*routespb.RouteFields, error) {
+	difficulty, err := parseRouteEnum(routespb.RouteDifficulty_value, "ROUTE_DIFFICULTY_", "difficulty", p.Difficulty)
+	if err != nil {
+		return nil, err
+	}
+	surface, err := parseRouteEnum(routespb.RouteSurface_value, "ROUTE_SURFACE_", "surface", p.Surface)
+	if err != nil {
+		return nil, err
+	}
+	routeType, err := parseRouteEnum(routespb.RouteType_value, "ROUTE_TYPE_", "route type", p.RouteType)
+	if err != nil {
+		return nil, err
+	}
+	visibility, err := parseRouteEnum(routespb.RouteVisibility_value, "ROUTE_VISIBILITY_", "visibility", p.Visibility)
+	if err != nil {
+		return nil, err
+	}
+	return &routespb.RouteFields{
+		Name:                 p.Name,
+		Description:          p.Description,
+		DistanceM:            p.DistanceM,
+		ElevationGainM:       p.ElevationGainM,
+		ElevationLossM:       p.ElevationLossM,
+		EstimatedDurationMin: p.EstimatedDurationMin,
+		Difficulty:           routespb.RouteDifficulty(difficulty),
+		Surface:              routespb.RouteSurface(surface),
+		RouteType:            routespb.RouteType(routeType),
+		Region:               p.Region,
+		Tags:                 p.Tags,
+		Visibility:           routespb.RouteVisibility(visibility),
+	}, nil
+}
+
+// parseRouteEnum traduce el texto del payload al valor del enum. Vacío es
+// UNSPECIFIED (0); "unspecified" por nombre no se acepta.
+func parseRouteEnum(values map[string]int32, prefix, field, s string) (int32, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	v, ok := values[prefix+strings.ToUpper(strings.ReplaceAll(s, "-", "_"))]
+	if !ok || v == 0 {
+		return 0, fmt.Errorf("unknown %s %q", field, s)
+	}
+	return v, nil
+}
+
+// routeResult es la respuesta de crear o editar una ruta. MapVersion es la
+// versión de geometría guardada; 0 si no se mandó geoJson.
+type routeResult struct {
+	Route      *routespb.Route `json:"route"`
+	MapVersion int32           `json:"map_version"`
+}
+
+var errViewerRequired = errors.New("the " + viewerHeader + " header is required")
+
+// handleCreateRoute publica una ruta nueva a nombre de quien la pide.
+func (h *Handler) handleCreateRoute(w http.ResponseWriter, r *http.Request) {
+	userID := viewerID(r)
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, errViewerRequired)
+		return
+	}
+	var body routePayload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	fields, err := body.fields()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	route, err := h.clients.Routes.CreateRoute(ctx, &routespb.CreateRouteRequest{
+		UserId: userID,
+		Route:  fields,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	rollback := func() {
+		if _, derr := h.clients.Routes.DeleteRoute(ctx, &routespb.DeleteRouteRequest{Id: route.GetId(), UserId: userID}); derr != nil {
+			log.Printf("[gateway] failed to roll back route %s: %v", route.GetId(), derr)
+		}
+	}
+	// Una ruta no pública se marca antes de guardar la geometría, para que
+	// nunca llegue a las teselas.
+	if route.GetVisibility() != routespb.RouteVisibility_ROUTE_VISIBILITY_PUBLIC {
+		if err := h.setRouteListed(ctx, route); err != nil {
+			rollback()
+			writeGRPCError(w, err)
+			return
+		}
+	}
+	res := routeResult{Route: route}
+	if body.GeoJSON != "" {
+		if res.MapVersion, err = h.setRouteMap(ctx, route, body.GeoJSON, userID); err != nil {
+			// Sin geometría válida la ruta no se publica.
+			rollback()
+			writeGRPCError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+// handleUpdateRoute edita una ruta; solo el dueño puede hacerlo. La
+// visibilidad en el mapa y la geometría se guardan después de comprobar el
+// dueño, así que si fallan los otros campos ya quedaron actualizados.
+func (h *Handler) handleUpdateRoute(w http.ResponseWriter, r *http.Request, id string) {
+	userID := viewerID(r)
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, errViewerRequired)
+		return
+	}
+	var body routePayload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	fields, err := body.fields()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	route, err := h.clients.Routes.UpdateRoute(ctx, &routespb.UpdateRouteRequest{
+		Id:     id,
+		UserId: userID,
+		Route:  fields,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	// Si falla, la ruta ya tiene la visibilidad nueva pero el mapa no: se
+	// responde con error para que el cliente reintente.
+	if err := h.setRouteListed(ctx, route); err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	res := routeResult{Route: route}
+	if body.GeoJSON != "" {
+		if res.MapVersion, err = h.setRouteMap(ctx, route, body.GeoJSON, userID); err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+	} else {
+		// Los valores del cliente acaban de pisar los medidos.
+		h.syncRouteMapStats(ctx, route)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleDeleteRoute borra la ruta y después su geometría; solo el dueño
+// puede hacerlo.
+func (h *Handler) handleDeleteRoute(w http.ResponseWriter, r *http.Request, id string) {
+	userID := viewerID(r)
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, errViewerRequired)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.clients.Routes.DeleteRoute(ctx, &routespb.DeleteRouteRequest{Id: id, UserId: userID})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	// Una ruta sin mapa es normal; cualquier otro error deja la geometría
+	// huérfana, pero la ruta ya no existe.
+	if _, err := h.clients.Maps.DeleteRoute(ctx, &mapspb.DeleteRouteRequest{RouteId: id}); err != nil && status.Code(err) != codes.NotFound {
+		log.Printf("[gateway] failed to delete map of route %s: %v", id, err)
+	}
+	writeProto(w, http.StatusOK, resp)
+}
+
+func (h *Handler) setRouteMap(ctx context.Context, route *routespb.Route, geoJSON, authorID string) (int32, error) {
+	resp, err := h.clients.Maps.SetRoute(ctx, &mapspb.SetRouteRequest{
+		RouteId:  route.GetId(),
+		GeoJson:  geoJSON,
+		Name:     route.GetName(),
+		AuthorId: authorID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	h.syncRouteMapStats(ctx, route)
+	return resp.GetVersion(), nil
+}
+
+// syncRouteMapStats copia a la ruta la distancia y el desnivel que mide el
+// servicio de mapas sobre la versión actual y los actualiza en route. Sin
+// geometría no hace nada: quedan los del cliente. Si falla solo se registra;
+// la próxima versión lo corrige.
+func (h *Handler) syncRouteMapStats(ctx context.Context, route *routespb.Route) {
+	stats, err := h.clients.Maps.GetRouteStats(ctx, &mapspb.GetRouteStatsRequest{RouteId: route.GetId()})
+	if status.Code(err) == codes.NotFound {
+		return
+	}
+	if err != nil {
+		log.Printf("[gateway] get map stats of route %s: %v", route.GetId(), err)
+		return
+	}
+	updated, err := h.clients.Routes.SetRouteGeometryStats(ctx, &routespb.SetRouteGeometryStatsRequest{
+		RouteId:        route.GetId(),
+		DistanceM:      stats.GetDistanceM(),
+		HasElevation:   stats.GetHasElevation(),
+		ElevationGainM: stats.GetElevationGainM(),
+		ElevationLossM: stats.GetElevationLossM(),
+	})
+	if err != nil {
+		log.Printf("[gateway] set geometry stats of route %s: %v", route.GetId(), err)
+		return
+	}
+	route.DistanceM = updated.GetDistanceM()
+	route.ElevationGainM = updated.GetElevationGainM()
+	route.ElevationLossM = updated.GetElevationLossM()
+}
+
+// setRouteListed le dice al servicio de mapas si la geometría de la ruta
+// puede salir en teselas, búsqueda espacial, heatmap y planificador: solo la
+// de las rutas públicas.
+func (h *Handler) setRouteListed(ctx context.Context, route *routespb.Route) error {
+	_, err := h.clients.Maps.SetRouteListed(ctx, &mapspb.SetRouteListedRequest{
+		RouteId: route.GetId(),
+		Listed:  route.GetVisibility() == routespb.RouteVisibility_ROUTE_VISIBILITY_PUBLIC,
+	})
+	return err
+}
+
+// checkRouteAccess responde como el servicio de rutas (404 si quien pide no
+// puede verla) y devuelve false cuando la ruta no es visible. Lo usan los
+// endpoints de datos que cuelgan de una ruta: geometría, POIs, reseñas.
+func (h *Handler) checkRouteAccess(w http.ResponseWriter, r *http.Request, routeID string) bool {
+	_, ok := h.visibleRoute(w, r, routeID)
+	return ok
+}
+
+// visibleRoute es checkRouteAccess pero devuelve la ruta; nil si ya
+// respondió.
+func (h *Handler) visibleRoute(w http.ResponseWriter, r *http.Request, routeID string) (*routespb.Route, bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	route, err := h.privacy.Route(ctx, routeID, viewerID(r))
+	if err != nil {
+		writeGRPCError(w, err)
+		return nil, false
+	}
+	return route, true
+}
+
+var errMapEditDenied = errors.New("only the route owner and the users it is shared with can change its map")
+
+// canEditMap dice si userID puede guardar o restaurar versiones del mapa de
+// route: el dueño y, si es shared, los usuarios con acceso. route tiene que
+// venir de visibleRoute para userID; una ruta shared solo la ven ellos.
+func canEditMap(route *routespb.Route, userID string) bool {
+	if userID == "" {
+		return false
+	}
+	return route.GetUserId() == userID || route.GetVisibility() == routespb.RouteVisibility_ROUTE_VISIBILITY_SHARED
+}
+
+// sharePayload es el cuerpo de POST /api/routes/{id}/shares.
+type sharePayload struct {
+	UserID string `json:"userId"`
+}
+
+// handleRouteShares da (POST /api/routes/{id}/shares) o quita (DELETE
+// /api/routes/{id}/shares/{userId}) el acceso a una ruta shared. Solo el
+// dueño puede hacerlo; responde la ruta con shared_with actualizado.
+func (h *Handler) handleRouteShares(w http.ResponseWriter, r *http.Request, id, granteeID string) {
+	userID := viewerID(r)
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, errViewerRequired)
+		return
+	}
+
+	req := &routespb.ShareRouteRequest{Id: id, UserId: userID, GranteeId: granteeID}
+	share := h.clients.Routes.ShareRoute
+	switch {
+	case r.Method == http.MethodPost && granteeID == "":
+		var body sharePayload
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		req.GranteeId = body.UserID
+	case r.Method == http.MethodDelete && granteeID != "":
+		share = h.clients.Routes.UnshareRoute
+	default:
+		methodNotAllowed(w)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	route, err := share(ctx, req)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, route)
+}
+
+// handleRouteStar marca (POST) o desmarca (DELETE) la ruta como favorita de
+// quien pide; responde la ruta con star_count actualizado.
+func (h *Handler) handleRouteStar(w http.ResponseWriter, r *http.Request, id string) {
+	userID := viewerID(r)
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, errViewerRequired)
+		return
+	}
+	req := &routespb.StarRouteRequest{RouteId: id, UserId: userID}
+	star := h.clients.Routes.StarRoute
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		star = h.clients.Routes.UnstarRoute
+	default:
+		methodNotAllowed(w)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	route, err := star(ctx, req)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, route)
+}
@@ -0,0 +1,340 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	mapspb "trailbox/gen/maps"
+	routespb "trailbox/gen/routes"
+	workoutpb "trailbox/gen/workouts"
+
+	"trailbox/services/gateway/internal/clients"
+	"trailbox/services/gateway/internal/imports/parser"
+)
+
+const requestTimeout = 5 * time.Second
+
+// Tolerancias para considerar que un track recorre una ruta existente.
+const (
+	matchEndpointM     = 250.0
+	matchDistanceRatio = 0.15
+	matchCandidates    = 20
+)
+
+// Estimación de calorías cuando el archivo no las trae (adulto de ~70 kg).
+const (
+	kcalPerKm          = 52.0
+	kcalPerMeterClimbM = 0.8
+)
+
+// ErrInvalidInput marca errores del archivo o de los campos del formulario.
+var ErrInvalidInput = errors.New("invalid import")
+
+// Nombre de la ruta creada cuando ni el formulario ni el archivo traen uno.
+const (
+	defaultRouteName = "Ruta importada"
+	maxRouteNameLen  = 255
+)
+
+// Input son los datos del formulario multipart de /api/imports.
+type Input struct {
+	UserID   string
+	RouteID  string // opcional; si falta se busca una ruta que coincida o se crea
+	Name     string
+	Calories int // opcional
+	Duration int // minutos; opcional si el archivo trae tiempos
+	Filename string
+	Data     []byte
+}
+
+// Result resume lo que se creó a partir del archivo.
+type Result struct {
+	Workout        *workoutpb.Workout `json:"workout"`
+	RouteID        string             `json:"route_id"`
+	RouteMatched   bool               `json:"route_matched"`
+	RouteCreated   bool               `json:"route_created"`
+	RouteMapSet    bool               `json:"route_map_set"`
+	Points         int                `json:"points"`
+	DistanceM      float64            `json:"distance_m"`
+	ElevationGainM float64            `json:"elevation_gain_m"`
+	Duration       int                `json:"duration"`
+	Calories       int                `json:"calories"`
+}
+
+type Controller struct {
+	clients clients.Clients
+}
+
+func New(cl clients.Clients) *Controller {
+	return &Controller{clients: cl}
+}
+
+// Import parsea el archivo, crea el workout y guarda el track en el servicio
+// de mapas.
+func (c *Controller) Import(ctx context.Context, in Input) (*Result, error) {
+	if in.UserID == "" {
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidInput)
+	}
+	track, err := parser.Parse(in.Filename, in.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	res := &Result{
+		Points:         len(track.Points),
+		DistanceM:      math.Round(track.Distance()),
+		ElevationGainM: math.Round(track.ElevationGain()),
+	}
+
+	res.Duration = in.Duration
+	if res.Duration <= 0 {
+		res.Duration = int(math.Ceil(track.Duration().Minutes()))
+	}
+	if res.Duration <= 0 {
+		return nil, fmt.Errorf("%w: file has no timestamps; duration is required", ErrInvalidInput)
+	}
+
+	res.Calories = in.Calories
+	if res.Calories <= 0 {
+		res.Calories = track.Calories
+	}
+	if res.Calories <= 0 {
+		res.Calories = int(math.Round(res.DistanceM/1000*kcalPerKm + res.ElevationGainM*kcalPerMeterClimbM))
+	}
+
+	geoJSON, err := track.GeoJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		name = strings.TrimSpace(track.Name)
+	}
+
+	res.RouteID = in.RouteID
+	if res.RouteID != "" {
+		// Como checkRouteAccess, pero para quien importa: solo se adjunta el
+		// workout a una ruta que puede ver. Si no, NotFound.
+		ctxRoute, cancel := context.WithTimeout(ctx, requestTimeout)
+		_, err := c.clients.Routes.GetRoute(ctxRoute, &routespb.GetRouteRequest{Id: res.RouteID, ViewerId: in.UserID})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("get route: %w", err)
+		}
+	} else {
+		res.RouteID, err = c.matchRoute(ctx, track, in.UserID)
+		if err != nil {
+			return nil, err
+		}
+		res.RouteMatched = res.RouteID != ""
+	}
+	if res.RouteID == "" {
+		if res.RouteID, err = c.createRoute(ctx, in.UserID, name, res); err != nil {
+			return nil, fmt.Errorf("create route: %w", err)
+		}
+		res.RouteCreated = true
+	}
+	date := ""
+	if start := track.StartTime(); !start.IsZero() {
+		date = start.Format(time.RFC3339)
+	}
+
+	ctxCreate, cancel := context.WithTimeout(ctx, requestTimeout)
+	res.Workout, err = c.clients.Workouts.CreateWorkout(ctxCreate, &workoutpb.CreateWorkoutRequest{
+		UserId:         in.UserID,
+		RouteId:        res.RouteID,
+		Name:           name,
+		Date:           date,
+		Duration:       int32(res.Duration),
+		Calories:       int32(res.Calories),
+		DistanceM:      res.DistanceM,
+		ElevationGainM: res.ElevationGainM,
+	})
+	cancel()
+	if err != nil {
+		c.rollbackRoute(ctx, res, in.UserID)
+		return nil, fmt.Errorf("create workout: %w", err)
+	}
+
+	ctxTrack, cancel := context.WithTimeout(ctx, requestTimeout)
+	_, err = c.clients.Maps.SetWorkoutTrack(ctxTrack, &mapspb.SetWorkoutTrackRequest{
+		WorkoutId: res.Workout.GetId(),
+		UserId:    in.UserID,
+		GeoJson:   geoJSON,
+	})
+	cancel()
+	if err != nil {
+		// Sin track el workout importado queda huérfano; se borra.
+		ctxDel, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+		if _, derr := c.clients.Workouts.DeleteWorkout(ctxDel, &workoutpb.DeleteWorkoutRequest{Id: res.Workout.GetId()}); derr != nil {
+			log.Printf("[gateway] failed to roll back workout %s: %v", res.Workout.GetId(), derr)
+		}
+		c.rollbackRoute(ctx, res, in.UserID)
+		return nil, fmt.Errorf("save track: %w", err)
+	}
+
+	// Si la ruta es del usuario y aún no tiene geometría, el track importado
+	// se usa como mapa. Las rutas ajenas no se tocan.
+	if !c.ownsRoute(ctx, res.RouteID, in.UserID) {
+		return res, nil
+	}
+	ctxMap, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if _, err := c.clients.Maps.GetRoute(ctxMap, &mapspb.GetRouteRequest{RouteId: res.RouteID}); status.Code(err) == codes.NotFound {
+		if _, err := c.clients.Maps.SetRoute(ctxMap, &mapspb.SetRouteRequest{
+			RouteId:  res.RouteID,
+			GeoJson:  geoJSON,
+			AuthorId: in.UserID,
+		}); err == nil {
+			res.RouteMapSet = true
+		}
+	}
+	return res, nil
+}
+
+// createRoute crea una ruta privada del usuario con los datos del track. Es
+// privada para no publicar por defecto dónde entrena; el dueño puede cambiarla
+// después. Se marca como no listada en el mapa antes de que se guarde su
+// geometría.
+func (c *Controller) createRoute(ctx context.Context, userID, name string, res *Result) (string, error) {
+	if name == "" {
+		name = defaultRouteName
+	}
+	if r := []rune(name); len(r) > maxRouteNameLen {
+		name = string(r[:maxRouteNameLen])
+	}
+
+	ctxRoute, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	route, err := c.clients.Routes.CreateRoute(ctxRoute, &routespb.CreateRouteRequest{
+		UserId: userID,
+		Route: &routespb.RouteFields{
+			Name:                 name,
+			DistanceM:            res.DistanceM,
+			ElevationGainM:       res.ElevationGainM,
+			EstimatedDurationMin: int32(res.Duration),
+			Visibility:           routespb.RouteVisibility_ROUTE_VISIBILITY_PRIVATE,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if _, err := c.clients.Maps.SetRouteListed(ctxRoute, &mapspb.SetRouteListedRequest{RouteId: route.GetId(), Listed: false}); err != nil {
+		c.rollbackRoute(ctx, &Result{RouteID: route.GetId(), RouteCreated: true}, userID)
+		return "", err
+	}
+	return route.GetId(), nil
+}
+
+// rollbackRoute borra la ruta si la creó esta importación.
+func (c *Controller) rollbackRoute(ctx context.Context, res *Result, userID string) {
+	if !res.RouteCreated {
+		return
+	}
+	ctxDel, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if _, err := c.clients.Routes.DeleteRoute(ctxDel, &routespb.DeleteRouteRequest{Id: res.RouteID, UserId: userID}); err != nil {
+		log.Printf("[gateway] failed to roll back route %s: %v", res.RouteID, err)
+	}
+}
+
+// ownsRoute indica si userID es el dueño de la ruta.
+func (c *Controller) ownsRoute(ctx context.Context, routeID, userID string) bool {
+	ctxRoute, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	rt, err := c.clients.Routes.GetRoute(ctxRoute, &routespb.GetRouteRequest{Id: routeID, ViewerId: userID})
+	return err == nil && rt.GetUserId() == userID
+}
+
+// matchRoute busca la ruta que empieza y termina cerca del track (en
+// cualquier sentido) y tiene una longitud parecida. Los candidatos son las
+// rutas públicas cercanas al inicio que ve userID y las suyas de longitud
+// parecida, que pueden ser privadas (como las que crean las importaciones) y
+// no salen en la búsqueda espacial. Devuelve "" si ninguna coincide.
+func (c *Controller) matchRoute(ctx context.Context, track *parser.Track, userID string) (string, error) {
+	first, last := track.Points[0], track.Points[len(track.Points)-1]
+	length := track.Distance()
+
+	ctxSearch, cancel := context.WithTimeout(ctx, requestTimeout)
+	near, err := c.clients.Maps.SearchRoutesNear(ctxSearch, &mapspb.SearchRoutesNearRequest{
+		Lat:     first.Lat,
+		Lon:     first.Lon,
+		RadiusM: matchEndpointM,
+		Limit:   matchCandidates,
+	})
+	cancel()
+	if err != nil {
+		return "", fmt.Errorf("search routes: %w", err)
+	}
+	var ids []string
+	for _, m := range near.GetRoutes() {
+		if l := m.GetLengthM(); l > 0 && math.Abs(l-length)/l <= matchDistanceRatio {
+			ids = append(ids, m.GetRouteId())
+		}
+	}
+
+	var candidates []*routespb.Route
+	if len(ids) > 0 {
+		// Solo cuentan las rutas que el usuario puede ver.
+		ctxList, cancel := context.WithTimeout(ctx, requestTimeout)
+		visible, err := c.clients.Routes.ListRoutes(ctxList, &routespb.ListRoutesRequest{Ids: ids, PageSize: int32(len(ids)), ViewerId: userID})
+		cancel()
+		if err != nil {
+			return "", fmt.Errorf("list routes: %w", err)
+		}
+		candidates = visible.GetRoutes()
+	}
+
+	ctxOwn, cancel := context.WithTimeout(ctx, requestTimeout)
+	own, err := c.clients.Routes.ListRoutes(ctxOwn, &routespb.ListRoutesRequest{
+		Query: fmt.Sprintf("owner:%s distance:%.0fm..%.0fm",
+			userID, length/(1+matchDistanceRatio), length/(1-matchDistanceRatio)),
+		PageSize: matchCandidates,
+		ViewerId: userID,
+	})
+	cancel()
+	if err != nil {
+		return "", fmt.Errorf("list own routes: %w", err)
+	}
+	seen := make(map[string]bool, len(candidates))
+	for _, rt := range candidates {
+		seen[rt.GetId()] = true
+	}
+	for _, rt := range own.GetRoutes() {
+		if !seen[rt.GetId()] {
+			candidates = append(candidates, rt)
+		}
+	}
+
+	bestID, bestScore := "", math.Inf(1)
+	for _, rt := range candidates {
+		ctxMap, cancel := context.WithTimeout(ctx, requestTimeout)
+		m, err := c.clients.Maps.GetRoute(ctxMap, &mapspb.GetRouteRequest{RouteId: rt.GetId()})
+		cancel()
+		if err != nil {
+			continue
+		}
+		line, err := parser.LineFromGeoJSON(m.GetGeoJson())
+		if err != nil || len(line) < 2 {
+			continue
+		}
+		start, end := line[0], line[len(line)-1]
+		forward := math.Max(parser.Haversine(first, start), parser.Haversine(last, end))
+		backward := math.Max(parser.Haversine(first, end), parser.Haversine(last, start))
+		score := math.Min(forward, backward)
+		if score <= matchEndpointM && score < bestScore {
+			bestID, bestScore = rt.GetId(), score
+		}
+	}
+	return bestID, nil
+}
@@ -0,0 +1,231 @@
+package parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Decodificador FIT mínimo: solo lee los mensajes record (posición, altitud,
+// pulso y tiempo) y session (calorías). Ignora el resto del perfil.
+
+const (
+	fitMsgSession = 18
+	fitMsgRecord  = 20
+
+	fitFieldTimestamp        = 253
+	fitFieldPositionLat      = 0
+	fitFieldPositionLong     = 1
+	fitFieldAltitude         = 2
+	fitFieldHeartRate        = 3
+	fitFieldEnhancedAltitude = 78
+	fitFieldTotalCalories    = 11 // en session
+)
+
+// fitEpoch es 1989-12-31T00:00:00Z, el origen de los timestamps FIT.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+var errFITTruncated = errors.New("invalid fit: truncated file")
+
+type fitFieldDef struct {
+	num  byte
+	size byte
+}
+
+type fitDefinition struct {
+	global    uint16
+	order     binary.ByteOrder
+	fields    []fitFieldDef
+	devFields int // bytes de campos de developer a saltar
+}
+
+func parseFIT(data []byte) (*Track, error) {
+	if len(data) < 12 {
+		return nil, errFITTruncated
+	}
+	headerSize := int(data[0])
+	if headerSize < 12 || len(data) < headerSize || string(data[8:12]) != ".FIT" {
+		return nil, errors.New("invalid fit: bad header")
+	}
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	end := headerSize + dataSize
+	if end > len(data) {
+		return nil, errFITTruncated
+	}
+
+	t := &Track{}
+	defs := map[byte]*fitDefinition{}
+	var lastTimestamp uint32
+	pos := headerSize
+
+	for pos < end {
+		header := data[pos]
+		pos++
+
+		// Cabecera de timestamp comprimido: siempre es un mensaje de datos.
+		if header&0x80 != 0 {
+			local := (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+			ts := (lastTimestamp &^ 0x1F) + offset
+			if offset < lastTimestamp&0x1F {
+				ts += 0x20
+			}
+			lastTimestamp = ts
+			def, ok := defs[local]
+			if !ok {
+				return nil, fmt.Errorf("invalid fit: undefined local message %d", local)
+			}
+			n, err := t.readFITData(data[pos:end], def, &lastTimestamp, true)
+			if err != nil {
+				return nil, err
+			}
+			pos += n
+			continue
+		}
+
+		local := header & 0x0F
+		if header&0x40 != 0 {
+			def, n, err := readFITDefinition(data[pos:end], header&0x20 != 0)
+			if err != nil {
+				return nil, err
+			}
+			defs[local] = def
+			pos += n
+			continue
+		}
+
+		def, ok := defs[local]
+		if !ok {
+			return nil, fmt.Errorf("invalid fit: undefined local message %d", local)
+		}
+		n, err := t.readFITData(data[pos:end], def, &lastTimestamp, false)
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+	}
+	return t, nil
+}
+
+func readFITDefinition(b []byte, hasDev bool) (*fitDefinition, int, error) {
+	if len(b) < 5 {
+		return nil, 0, errFITTruncated
+	}
+	def := &fitDefinition{order: binary.LittleEndian}
+	if b[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.global = def.order.Uint16(b[2:4])
+	count := int(b[4])
+	n := 5
+	if len(b) < n+3*count {
+		return nil, 0, errFITTruncated
+	}
+	for i := 0; i < count; i++ {
+		def.fields = append(def.fields, fitFieldDef{num: b[n], size: b[n+1]})
+		n += 3
+	}
+	if hasDev {
+		if len(b) < n+1 {
+			return nil, 0, errFITTruncated
+		}
+		devCount := int(b[n])
+		n++
+		if len(b) < n+3*devCount {
+			return nil, 0, errFITTruncated
+		}
+		for i := 0; i < devCount; i++ {
+			def.devFields += int(b[n+1])
+			n += 3
+		}
+	}
+	return def, n, nil
+}
+
+// readFITData consume un mensaje de datos y devuelve los bytes leídos.
+func (t *Track) readFITData(b []byte, def *fitDefinition, lastTimestamp *uint32, compressed bool) (int, error) {
+	n := 0
+	var (
+		lat, lon     int32
+		hasPos       bool
+		altitude     float64
+		hasAlt       bool
+		heartRate    int
+		timestamp    = *lastTimestamp
+		hasTimestamp = compressed
+	)
+
+	for _, f := range def.fields {
+		size := int(f.size)
+		if len(b) < n+size {
+			return 0, errFITTruncated
+		}
+		raw := b[n : n+size]
+		n += size
+
+		switch def.global {
+		case fitMsgRecord:
+			switch {
+			case f.num == fitFieldTimestamp && size == 4:
+				timestamp = def.order.Uint32(raw)
+				hasTimestamp = true
+			case f.num == fitFieldPositionLat && size == 4:
+				lat = int32(def.order.Uint32(raw))
+			case f.num == fitFieldPositionLong && size == 4:
+				lon = int32(def.order.Uint32(raw))
+				hasPos = true
+			case f.num == fitFieldAltitude && size == 2 && !hasAlt:
+				if v := def.order.Uint16(raw); v != 0xFFFF {
+					altitude, hasAlt = float64(v)/5-500, true
+				}
+			case f.num == fitFieldEnhancedAltitude && size == 4:
+				if v := def.order.Uint32(raw); v != 0xFFFFFFFF {
+					altitude, hasAlt = float64(v)/5-500, true
+				}
+			case f.num == fitFieldHeartRate && size == 1:
+				if raw[0] != 0xFF {
+					heartRate = int(raw[0])
+				}
+			}
+		case fitMsgSession:
+			if f.num == fitFieldTotalCalories && size == 2 {
+				if v := def.order.Uint16(raw); v != 0xFFFF {
+					t.Calories += int(v)
+				}
+			}
+		default:
+			if f.num == fitFieldTimestamp && size == 4 {
+				timestamp = def.order.Uint32(raw)
+				hasTimestamp = true
+			}
+		}
+	}
+	if len(b) < n+def.devFields {
+		return 0, errFITTruncated
+	}
+	n += def.devFields
+
+	if hasTimestamp {
+		*lastTimestamp = timestamp
+	}
+	if def.global != fitMsgRecord || !hasPos || lat == 0x7FFFFFFF || lon == 0x7FFFFFFF {
+		return n, nil
+	}
+
+	const semicircle = 180.0 / (1 << 31)
+	pt := Point{
+		Lat:       float64(lat) * semicircle,
+		Lon:       float64(lon) * semicircle,
+		Ele:       altitude,
+		HasEle:    hasAlt,
+		HeartRate: heartRate,
+	}
+	if hasTimestamp {
+		pt.Time = fitEpoch.Add(time.Duration(timestamp) * time.Second)
+	}
+	if validCoord(pt.Lat, pt.Lon) {
+		t.Points = append(t.Points, pt)
+	}
+	return n, nil
+}
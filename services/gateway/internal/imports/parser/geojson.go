@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+type geoObject struct {
+	Type        string          `json:"type"`
+	Geometry    *geoObject      `json:"geometry"`
+	Features    []geoObject     `json:"features"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// LineFromGeoJSON extrae los puntos de la primera LineString o
+// MultiLineString de un Feature, FeatureCollection o geometría suelta. Las
+// partes de una MultiLineString se devuelven seguidas.
+func LineFromGeoJSON(s string) ([]Point, error) {
+	parts, err := LinesFromGeoJSON(s)
+	if err != nil {
+		return nil, err
+	}
+	var pts []Point
+	for _, p := range parts {
+		pts = append(pts, p...)
+	}
+	return pts, nil
+}
+
+// LinesFromGeoJSON es como LineFromGeoJSON pero conserva las partes de una
+// MultiLineString, por ejemplo las que dejan las zonas de privacidad.
+func LinesFromGeoJSON(s string) ([][]Point, error) {
+	var obj geoObject
+	if err := json.Unmarshal([]byte(s), &obj); err != nil {
+		return nil, err
+	}
+	return linesFrom(obj)
+}
+
+func linesFrom(obj geoObject) ([][]Point, error) {
+	switch obj.Type {
+	case "Feature":
+		if obj.Geometry == nil {
+			return nil, errors.New("feature without geometry")
+		}
+		return linesFrom(*obj.Geometry)
+	case "FeatureCollection":
+		for _, f := range obj.Features {
+			if parts, err := linesFrom(f); err == nil {
+				return parts, nil
+			}
+		}
+		return nil, errors.New("no line geometry in collection")
+	case "LineString":
+		var coords [][]float64
+		if err := json.Unmarshal(obj.Coordinates, &coords); err != nil {
+			return nil, err
+		}
+		if pts := toPoints(coords); len(pts) > 0 {
+			return [][]Point{pts}, nil
+		}
+		return nil, nil
+	case "MultiLineString":
+		var lines [][][]float64
+		if err := json.Unmarshal(obj.Coordinates, &lines); err != nil {
+			return nil, err
+		}
+		parts := make([][]Point, 0, len(lines))
+		for _, l := range lines {
+			if pts := toPoints(l); len(pts) > 0 {
+				parts = append(parts, pts)
+			}
+		}
+		return parts, nil
+	}
+	return nil, errors.New("unsupported geometry type " + obj.Type)
+}
+
+func toPoints(coords [][]float64) []Point {
+	pts := make([]Point, 0, len(coords))
+	for _, c := range coords {
+		if len(c) < 2 {
+			continue
+		}
+		p := Point{Lon: c[0], Lat: c[1]}
+		if len(c) > 2 {
+			p.Ele, p.HasEle = c[2], true
+		}
+		pts = append(pts, p)
+	}
+	return pts
+}
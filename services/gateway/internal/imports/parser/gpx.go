@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// Estructura mínima de GPX 1.1. encoding/xml compara nombres locales, así que
+// las extensiones de Garmin (gpxtpx:hr) se leen sin declarar el namespace.
+type gpxFile struct {
+	Name   string     `xml:"metadata>name"`
+	Tracks []gpxTrack `xml:"trk"`
+	Routes []gpxRoute `xml:"rte"`
+}
+
+type gpxTrack struct {
+	Name     string       `xml:"name"`
+	Type     string       `xml:"type"`
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxRoute struct {
+	Name   string     `xml:"name"`
+	Points []gpxPoint `xml:"rtept"`
+}
+
+type gpxPoint struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele"`
+	Time string   `xml:"time"`
+	HR   int      `xml:"extensions>TrackPointExtension>hr"`
+}
+
+func parseGPX(data []byte) (*Track, error) {
+	var f gpxFile
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = passthroughCharset
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid gpx: %w", err)
+	}
+
+	t := &Track{Name: f.Name}
+	for _, trk := range f.Tracks {
+		if t.Name == "" {
+			t.Name = trk.Name
+		}
+		if t.Sport == "" {
+			t.Sport = trk.Type
+		}
+		for _, seg := range trk.Segments {
+			for _, p := range seg.Points {
+				t.appendGPX(p)
+			}
+		}
+	}
+	// Algunos exportadores solo generan <rte>; se usan si no hay <trk>.
+	if len(t.Points) == 0 {
+		for _, rte := range f.Routes {
+			if t.Name == "" {
+				t.Name = rte.Name
+			}
+			for _, p := range rte.Points {
+				t.appendGPX(p)
+			}
+		}
+	}
+	return t, nil
+}
+
+func (t *Track) appendGPX(p gpxPoint) {
+	if !validCoord(p.Lat, p.Lon) {
+		return
+	}
+	pt := Point{Lat: p.Lat, Lon: p.Lon, HeartRate: p.HR}
+	if p.Ele != nil {
+		pt.Ele, pt.HasEle = *p.Ele, true
+	}
+	if p.Time != "" {
+		if ts, err := time.Parse(time.RFC3339, p.Time); err == nil {
+			pt.Time = ts
+		}
+	}
+	t.Points = append(t.Points, pt)
+}
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Estructura mínima de TCX (Garmin Training Center v2): actividades y cursos.
+type tcxFile struct {
+	Activities []tcxActivity `xml:"Activities>Activity"`
+	Courses    []tcxCourse   `xml:"Courses>Course"`
+}
+
+type tcxActivity struct {
+	Sport string   `xml:"Sport,attr"`
+	Notes string   `xml:"Notes"`
+	Laps  []tcxLap `xml:"Lap"`
+}
+
+type tcxLap struct {
+	Calories int        `xml:"Calories"`
+	Points   []tcxPoint `xml:"Track>Trackpoint"`
+}
+
+type tcxCourse struct {
+	Name   string     `xml:"Name"`
+	Points []tcxPoint `xml:"Track>Trackpoint"`
+}
+
+type tcxPoint struct {
+	Time     string   `xml:"Time"`
+	Lat      *float64 `xml:"Position>LatitudeDegrees"`
+	Lon      *float64 `xml:"Position>LongitudeDegrees"`
+	Altitude *float64 `xml:"AltitudeMeters"`
+	HR       int      `xml:"HeartRateBpm>Value"`
+}
+
+func parseTCX(data []byte) (*Track, error) {
+	var f tcxFile
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = passthroughCharset
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid tcx: %w", err)
+	}
+
+	t := &Track{}
+	for _, act := range f.Activities {
+		if t.Sport == "" {
+			t.Sport = act.Sport
+		}
+		if t.Name == "" {
+			t.Name = act.Notes
+		}
+		for _, lap := range act.Laps {
+			t.Calories += lap.Calories
+			for _, p := range lap.Points {
+				t.appendTCX(p)
+			}
+		}
+	}
+	if len(t.Points) == 0 {
+		for _, c := range f.Courses {
+			if t.Name == "" {
+				t.Name = c.Name
+			}
+			for _, p := range c.Points {
+				t.appendTCX(p)
+			}
+		}
+	}
+	return t, nil
+}
+
+// Los Trackpoint sin Position (pausas, solo pulso) se descartan.
+func (t *Track) appendTCX(p tcxPoint) {
+	if p.Lat == nil || p.Lon == nil || !validCoord(*p.Lat, *p.Lon) {
+		return
+	}
+	pt := Point{Lat: *p.Lat, Lon: *p.Lon, HeartRate: p.HR}
+	if p.Altitude != nil {
+		pt.Ele, pt.HasEle = *p.Altitude, true
+	}
+	if p.Time != "" {
+		if ts, err := time.Parse(time.RFC3339, p.Time); err == nil {
+			pt.Time = ts
+		}
+	}
+	t.Points = append(t.Points, pt)
+}
+
+// passthroughCharset acepta declaraciones como encoding="ISO-8859-1"; los
+// relojes solo escriben ASCII en los campos que leemos.
+func passthroughCharset(_ string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
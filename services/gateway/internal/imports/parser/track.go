@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedFormat se devuelve cuando el archivo no es GPX, TCX ni FIT.
+var ErrUnsupportedFormat = errors.New("unsupported file format (expected gpx, tcx or fit)")
+
+// ErrEmptyTrack se devuelve cuando el archivo no contiene puntos con posición.
+var ErrEmptyTrack = errors.New("file contains no track points")
+
+const earthRadiusM = 6371008.8
+
+// Point es un punto del track. Time y HeartRate son opcionales.
+type Point struct {
+	Lat       float64
+	Lon       float64
+	Ele       float64
+	HasEle    bool
+	Time      time.Time
+	HeartRate int
+}
+
+// Track es el resultado de parsear cualquiera de los formatos soportados.
+type Track struct {
+	Name     string
+	Sport    string
+	Calories int // solo si el archivo lo trae (TCX, FIT)
+	Points   []Point
+}
+
+// Parse detecta el formato por extensión o contenido y parsea el archivo.
+func Parse(filename string, data []byte) (*Track, error) {
+	var (
+		t   *Track
+		err error
+	)
+	switch format := detectFormat(filename, data); format {
+	case "gpx":
+		t, err = parseGPX(data)
+	case "tcx":
+		t, err = parseTCX(data)
+	case "fit":
+		t, err = parseFIT(data)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Points) == 0 {
+		return nil, ErrEmptyTrack
+	}
+	return t, nil
+}
+
+func detectFormat(filename string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gpx":
+		return "gpx"
+	case ".tcx":
+		return "tcx"
+	case ".fit":
+		return "fit"
+	}
+	if len(data) >= 12 && string(data[8:12]) == ".FIT" {
+		return "fit"
+	}
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	switch {
+	case bytes.Contains(head, []byte("<gpx")):
+		return "gpx"
+	case bytes.Contains(head, []byte("<TrainingCenterDatabase")):
+		return "tcx"
+	}
+	return ""
+}
+
+// Distance devuelve la longitud del track en metros (haversine).
+func (t *Track) Distance() float64 {
+	total := 0.0
+	for i := 1; i < len(t.Points); i++ {
+		total += Haversine(t.Points[i-1], t.Points[i])
+	}
+	return total
+}
+
+// ElevationGain suma los ascensos entre puntos con elevación. Ignora
+// variaciones menores a un umbral para no acumular ruido del GPS.
+func (t *Track) ElevationGain() float64 {
+	const threshold = 3.0
+	gain := 0.0
+	var ref *float64
+	for i := range t.Points {
+		p := t.Points[i]
+		if !p.HasEle {
+			continue
+		}
+		if ref == nil {
+			ele := p.Ele
+			ref = &ele
+			continue
+		}
+		diff := p.Ele - *ref
+		switch {
+		case diff >= threshold:
+			gain += diff
+			*ref = p.Ele
+		case diff <= -threshold:
+			*ref = p.Ele
+		}
+	}
+	return gain
+}
+
+// StartTime es la hora del primer punto con tiempo; cero si no hay.
+func (t *Track) StartTime() time.Time {
+	for _, p := range t.Points {
+		if !p.Time.IsZero() {
+			return p.Time
+		}
+	}
+	return time.Time{}
+}
+
+// Duration es el tiempo entre el primer y el último punto con tiempo.
+func (t *Track) Duration() time.Duration {
+	start := t.StartTime()
+	if start.IsZero() {
+		return 0
+	}
+	for i := len(t.Points) - 1; i >= 0; i-- {
+		if !t.Points[i].Time.IsZero() {
+			return t.Points[i].Time.Sub(start)
+		}
+	}
+	return 0
+}
+
+// GeoJSON serializa el track como Feature LineString ([lon, lat, ele]).
+func (t *Track) GeoJSON() (string, error) {
+	coords := make([][]float64, 0, len(t.Points))
+	for _, p := range t.Points {
+		if p.HasEle {
+			coords = append(coords, []float64{round6(p.Lon), round6(p.Lat), math.Round(p.Ele*10) / 10})
+		} else {
+			coords = append(coords, []float64{round6(p.Lon), round6(p.Lat)})
+		}
+	}
+	props := map[string]interface{}{}
+	if t.Name != "" {
+		props["label"] = t.Name
+	}
+	if start := t.StartTime(); !start.IsZero() {
+		props["start_time"] = start.Format(time.RFC3339)
+	}
+	out, err := json.Marshal(map[string]interface{}{
+		"type":       "Feature",
+		"properties": props,
+		"geometry": map[string]interface{}{
+			"type":        "LineString",
+			"coordinates": coords,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// Haversine devuelve la distancia en metros entre dos puntos.
+func Haversine(a, b Point) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusM * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func round6(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+func validCoord(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180 && !(lat == 0 && lon == 0)
+}
@@ -0,0 +1,183 @@
+// Package privacy aplica las zonas de privacidad de los usuarios a la
+// geometría que sale del gateway. Las zonas viven en el servicio de usuarios
+// y el recorte lo hace el servicio de mapas; aquí solo se decide cuándo.
+//
+// También comprueba la visibilidad de las rutas antes de dar datos que
+// cuelgan de ellas (geometría, reseñas, POIs): mapas y reseñas no saben de
+// quién es cada ruta ni con quién se compartió.
+package privacy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	mapspb "trailbox/gen/maps"
+	routespb "trailbox/gen/routes"
+	userpb "trailbox/gen/users"
+
+	"trailbox/services/gateway/internal/clients"
+	"trailbox/services/gateway/internal/imports/parser"
+)
+
+// syncTimeout acota cada llamada de SyncAllZones.
+const syncTimeout = 5 * time.Second
+
+type Guard struct {
+	clients clients.Clients
+}
+
+func New(cl clients.Clients) *Guard {
+	return &Guard{clients: cl}
+}
+
+// Zones devuelve las zonas de ownerID que hay que aplicar para viewerID: nil
+// si no hay dueño, si quien pide es el dueño o si no tiene zonas.
+func (g *Guard) Zones(ctx context.Context, ownerID, viewerID string) ([]*mapspb.PrivacyZone, error) {
+	if ownerID == "" || ownerID == viewerID {
+		return nil, nil
+	}
+	return g.listZones(ctx, ownerID)
+}
+
+func (g *Guard) listZones(ctx context.Context, userID string) ([]*mapspb.PrivacyZone, error) {
+	resp, err := g.clients.Users.ListPrivacyZones(ctx, &userpb.ListPrivacyZonesRequest{UserId: userID})
+	if err != nil {
+		return nil, fmt.Errorf("list privacy zones: %w", err)
+	}
+	zones := make([]*mapspb.PrivacyZone, 0, len(resp.GetZones()))
+	for _, z := range resp.GetZones() {
+		zones = append(zones, &mapspb.PrivacyZone{Lat: z.GetLat(), Lon: z.GetLon(), RadiusM: z.GetRadiusM()})
+	}
+	return zones, nil
+}
+
+// SyncZones copia las zonas de userID al servicio de mapas, que las aplica
+// a sus tracks en el heatmap global. Se llama después de cada cambio.
+func (g *Guard) SyncZones(ctx context.Context, userID string) error {
+	zones, err := g.listZones(ctx, userID)
+	if err != nil {
+		return err
+	}
+	_, err = g.clients.Maps.SetUserPrivacyZones(ctx, &mapspb.SetUserPrivacyZonesRequest{UserId: userID, Zones: zones})
+	return err
+}
+
+// SyncAllZones hace SyncZones para todos los usuarios. Recupera las zonas
+// que el servicio de mapas no recibió (caído, réplica nueva, datos viejos).
+func (g *Guard) SyncAllZones(ctx context.Context) error {
+	lctx, cancel := context.WithTimeout(ctx, syncTimeout)
+	resp, err := g.clients.Users.ListUsers(lctx, &userpb.ListUsersRequest{})
+	cancel()
+	if err != nil {
+		return fmt.Errorf("list users: %w", err)
+	}
+	for _, u := range resp.GetUsers() {
+		uctx, cancel := context.WithTimeout(ctx, syncTimeout)
+		err := g.SyncZones(uctx, u.GetId())
+		cancel()
+		if err != nil {
+			return fmt.Errorf("sync privacy zones of user %s: %w", u.GetId(), err)
+		}
+	}
+	return nil
+}
+
+// Inside dice si el punto cae en alguna de las zonas.
+func Inside(lat, lon float64, zones []*mapspb.PrivacyZone) bool {
+	p := parser.Point{Lat: lat, Lon: lon}
+	for _, z := range zones {
+		if parser.Haversine(p, parser.Point{Lat: z.GetLat(), Lon: z.GetLon()}) <= z.GetRadiusM() {
+			return true
+		}
+	}
+	return false
+}
+
+// Route trae la ruta tal como la ve viewerID (vacío = anónimo). Si no puede
+// verla el servicio de rutas responde NotFound, igual que si no existiera.
+func (g *Guard) Route(ctx context.Context, routeID, viewerID string) (*routespb.Route, error) {
+	return g.clients.Routes.GetRoute(ctx, &routespb.GetRouteRequest{Id: routeID, ViewerId: viewerID})
+}
+
+// GetRoute pide la geometría de la ruta y, si viewerID no es el dueño del
+// track y este tiene zonas, la vuelve a pedir recortada. No comprueba la
+// visibilidad de la ruta: hay que pasar antes por Route.
+func (g *Guard) GetRoute(ctx context.Context, req *mapspb.GetRouteRequest, viewerID string) (*mapspb.GetRouteResponse, error) {
+	resp, err := g.clients.Maps.GetRoute(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	zones, err := g.Zones(ctx, resp.GetOwnerId(), viewerID)
+	if err != nil || len(zones) == 0 {
+		return resp, err
+	}
+	hidden := proto.Clone(req).(*mapspb.GetRouteRequest)
+	hidden.PrivacyZones = zones
+	return g.clients.Maps.GetRoute(ctx, hidden)
+}
+
+// GetRouteStats es como GetRoute para las métricas: con zonas, inicio, fin y
+// bbox salen de la geometría recortada.
+func (g *Guard) GetRouteStats(ctx context.Context, req *mapspb.GetRouteStatsRequest, viewerID string) (*mapspb.RouteStats, error) {
+	resp, err := g.clients.Maps.GetRouteStats(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	zones, err := g.Zones(ctx, resp.GetOwnerId(), viewerID)
+	if err != nil || len(zones) == 0 {
+		return resp, err
+	}
+	hidden := proto.Clone(req).(*mapspb.GetRouteStatsRequest)
+	hidden.PrivacyZones = zones
+	return g.clients.Maps.GetRouteStats(ctx, hidden)
+}
+
+// GetRouteMapVersion es como GetRoute para una versión del historial; cada
+// versión tiene su propio dueño.
+func (g *Guard) GetRouteMapVersion(ctx context.Context, req *mapspb.GetRouteMapVersionRequest, viewerID string) (*mapspb.RouteMapVersion, error) {
+	resp, err := g.clients.Maps.GetRouteMapVersion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	zones, err := g.Zones(ctx, resp.GetOwnerId(), viewerID)
+	if err != nil || len(zones) == 0 {
+		return resp, err
+	}
+	hidden := proto.Clone(req).(*mapspb.GetRouteMapVersionRequest)
+	hidden.PrivacyZones = zones
+	return g.clients.Maps.GetRouteMapVersion(ctx, hidden)
+}
+
+// RenderRoutePreview es como GetRoute para la miniatura.
+func (g *Guard) RenderRoutePreview(ctx context.Context, req *mapspb.RenderRoutePreviewRequest, viewerID string) (*mapspb.RoutePreview, error) {
+	resp, err := g.clients.Maps.RenderRoutePreview(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	zones, err := g.Zones(ctx, resp.GetOwnerId(), viewerID)
+	if err != nil || len(zones) == 0 {
+		return resp, err
+	}
+	hidden := proto.Clone(req).(*mapspb.RenderRoutePreviewRequest)
+	hidden.PrivacyZones = zones
+	return g.clients.Maps.RenderRoutePreview(ctx, hidden)
+}
+
+// GetWorkoutTrack es como GetRoute para el track de un workout; el dueño es
+// el usuario del workout.
+func (g *Guard) GetWorkoutTrack(ctx context.Context, workoutID, viewerID string) (*mapspb.WorkoutTrack, error) {
+	req := &mapspb.GetWorkoutTrackRequest{WorkoutId: workoutID}
+	resp, err := g.clients.Maps.GetWorkoutTrack(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	zones, err := g.Zones(ctx, resp.GetUserId(), viewerID)
+	if err != nil || len(zones) == 0 {
+		return resp, err
+	}
+	req.PrivacyZones = zones
+	return g.clients.Maps.GetWorkoutTrack(ctx, req)
+}
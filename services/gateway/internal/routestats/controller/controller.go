@@ -0,0 +1,136 @@
+// Package controller mantiene los totales de reseñas y workouts que el
+// servicio de rutas usa para ordenar por rating y popularidad. Esos datos
+// viven en otros servicios, así que los recalcula el gateway.
+package controller
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	commonpb "trailbox/gen/common"
+	reviewpb "trailbox/gen/reviews"
+	routespb "trailbox/gen/routes"
+
+	"trailbox/services/gateway/internal/clients"
+)
+
+const (
+	requestTimeout = 5 * time.Second
+	idsPageSize    = 100
+)
+
+type Controller struct {
+	clients clients.Clients
+
+	// Una ruta se recalcula de a una vez por réplica: si llega otro cambio
+	// mientras tanto se marca dirty y se vuelve a calcular al terminar, así
+	// un cálculo viejo nunca pisa a uno nuevo.
+	mu      sync.Mutex
+	running map[string]bool
+	dirty   map[string]bool
+}
+
+func New(cl clients.Clients) *Controller {
+	return &Controller{
+		clients: cl,
+		running: map[string]bool{},
+		dirty:   map[string]bool{},
+	}
+}
+
+// Refresh recalcula en segundo plano los totales de las rutas. Se calculan
+// desde cero cada vez, así que una actualización perdida se corrige con la
+// siguiente o con Reconcile.
+func (c *Controller) Refresh(routeIDs ...string) {
+	for _, id := range routeIDs {
+		if id == "" {
+			continue
+		}
+		c.mu.Lock()
+		if c.running[id] {
+			c.dirty[id] = true
+			c.mu.Unlock()
+			continue
+		}
+		c.running[id] = true
+		c.mu.Unlock()
+		go c.refreshLoop(id)
+	}
+}
+
+func (c *Controller) refreshLoop(routeID string) {
+	for {
+		if err := c.setStats(routeID); err != nil {
+			log.Printf("[gateway] refresh stats of route %s: %v", routeID, err)
+		}
+		c.mu.Lock()
+		if !c.dirty[routeID] {
+			delete(c.running, routeID)
+			c.mu.Unlock()
+			return
+		}
+		delete(c.dirty, routeID)
+		c.mu.Unlock()
+	}
+}
+
+// Reconcile recalcula los totales de todas las rutas. Sirve de backfill
+// para las rutas anteriores a las columnas y corrige lo que otra réplica
+// del gateway haya escrito fuera de orden.
+func (c *Controller) Reconcile(ctx context.Context) error {
+	token, n := "", 0
+	for {
+		pctx, cancel := context.WithTimeout(ctx, requestTimeout)
+		page, err := c.clients.Routes.ListRouteIds(pctx, &routespb.ListRouteIdsRequest{PageSize: idsPageSize, PageToken: token})
+		cancel()
+		if err != nil {
+			return err
+		}
+		for _, id := range page.GetIds() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := c.setStats(id); err != nil {
+				log.Printf("[gateway] reconcile stats of route %s: %v", id, err)
+				continue
+			}
+			n++
+		}
+		if token = page.GetNextPageToken(); token == "" {
+			break
+		}
+	}
+	log.Printf("[gateway] route stats reconciled for %d routes", n)
+	return nil
+}
+
+func (c *Controller) setStats(routeID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	reviews, err := c.clients.Reviews.GetReviews(ctx, &reviewpb.ReviewListRequest{RouteId: routeID})
+	if err != nil {
+		return err
+	}
+	count, err := c.clients.Workouts.CountRouteWorkouts(ctx, &commonpb.RouteId{Id: routeID})
+	if err != nil {
+		return err
+	}
+
+	req := &routespb.SetRouteStatsRequest{
+		RouteId:      routeID,
+		RatingCount:  int32(len(reviews.GetReviews())),
+		WorkoutCount: count.GetCount(),
+	}
+	if req.RatingCount > 0 {
+		sum := 0
+		for _, rv := range reviews.GetReviews() {
+			sum += int(rv.GetRating())
+		}
+		req.RatingAvg = float64(sum) / float64(req.RatingCount)
+	}
+	_, err = c.clients.Routes.SetRouteStats(ctx, req)
+	return err
+}
@@ -5,7 +5,9 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"google.golang.org/grpc"
 	health "google.golang.org/grpc/health"
@@ -15,11 +17,15 @@ import (
 
 	mapctrl "trailbox/services/map/internal/controller"
 	mapdb "trailbox/services/map/internal/db"
+	"trailbox/services/map/internal/dem"
 	mapgrpc "trailbox/services/map/internal/handler/grpc"
 	maprepo "trailbox/services/map/internal/repository/db"
 )
 
-const defaultPort = "50051"
+const (
+	defaultPort         = "50051"
+	defaultIndexRefresh = 30 * time.Second
+)
 
 func main() {
 	conn, err := mapdb.Connect()
@@ -28,7 +34,33 @@ func main() {
 	}
 
 	repo := maprepo.New(conn)
-	ctrl := mapctrl.NewController(repo)
+
+	// DEM local opcional para completar la altura de los tracks 2D.
+	var elev mapctrl.ElevationSource
+	if dir := os.Getenv("DEM_DIR"); dir != "" {
+		d, err := dem.Open(dir, getenvInt("DEM_MAX_LOADED_TILES", dem.DefaultMaxLoaded))
+		if err != nil {
+			log.Printf("[map] ⚠️ DEM disabled: %v", err)
+		} else {
+			log.Printf("[map] DEM: %d tiles indexed from %s", d.Len(), dir)
+			elev = d
+		}
+	}
+	ctrl := mapctrl.NewController(repo, elev)
+
+	// Índice espacial en memoria: se carga al arrancar y se refresca para
+	// incluir rutas guardadas por otras réplicas.
+	if err := ctrl.RefreshIndex(); err != nil {
+		log.Printf("[map] ⚠️ spatial index load failed: %v", err)
+	}
+	refresh := getenvDuration("SPATIAL_INDEX_REFRESH", defaultIndexRefresh)
+	go func() {
+		for range time.Tick(refresh) {
+			if err := ctrl.RefreshIndex(); err != nil {
+				log.Printf("[map] spatial index refresh failed: %v", err)
+			}
+		}
+	}()
 
 	port := getenvOr("PORT", defaultPort)
 	lis, err := net.Listen("tcp", ":"+port)
@@ -65,3 +97,17 @@ func getenvOr(k, def string) string {
 	}
 	return def
 }
+
+func getenvDuration(k string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(k)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+func getenvInt(k string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(k)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
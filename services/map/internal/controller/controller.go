@@ -1,36 +1,386 @@
 package mapctrl
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"trailbox/services/map/internal/geo"
+	"trailbox/services/map/internal/heatmap"
 	"trailbox/services/map/internal/model"
+	"trailbox/services/map/internal/preview"
 	"trailbox/services/map/internal/repository"
+	"trailbox/services/map/internal/spatial"
+	"trailbox/services/map/internal/tiles"
+	"trailbox/services/map/internal/trailgraph"
 
 	"github.com/google/uuid"
 )
 
+// ErrInvalidArgument marca los errores de validación de entrada.
+var ErrInvalidArgument = errors.New("invalid argument")
+
+// Límites de las búsquedas espaciales.
+const (
+	maxSearchRadiusM   = 100000.0
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// ElevationSource completa la altura de los puntos 2D de una línea (ver
+// dem.DEM). Devuelve la línea nueva y cuántos puntos completó.
+type ElevationSource interface {
+	Enrich(line []geo.Point) ([]geo.Point, int)
+}
+
 type Controller struct {
-	repo repository.Repository
+	repo      repository.Repository
+	index     *spatial.Index
+	tiles     *tiles.Cache
+	previews  *preview.Cache
+	heat      *heatmap.Set
+	heatTiles *heatmap.Cache
+	elev      ElevationSource // nil si no hay DEM configurado
+
+	graphMu sync.Mutex
+	graph   *trailgraph.Graph // nil = hay que reconstruirla (ver trailGraph)
+
+	zonesMu sync.RWMutex
+	zones   map[string][]geo.Circle // zonas de privacidad por dueño (ver heatmap.go)
 }
 
-func NewController(r repository.Repository) *Controller {
-	return &Controller{repo: r}
+// NewController crea el controller; elev puede ser nil.
+func NewController(r repository.Repository, elev ElevationSource) *Controller {
+	return &Controller{
+		repo:      r,
+		index:     spatial.NewIndex(),
+		tiles:     tiles.NewCache(tiles.DefaultCacheSize),
+		previews:  preview.NewCache(preview.DefaultCacheSize),
+		heat:      heatmap.NewSet(),
+		heatTiles: heatmap.NewCache(heatmap.DefaultCacheSize),
+		elev:      elev,
+		zones:     map[string][]geo.Circle{},
+	}
 }
 
-func (c *Controller) SetRouteMap(routeID string, geoJSON string) error {
+// SetRouteMap valida y normaliza la geometría de la ruta (ver
+// geo.Normalize), la guarda como una nueva versión y calcula sus métricas.
+// Si name viene vacío se toma del GeoJSON. Devuelve el número de versión.
+func (c *Controller) SetRouteMap(routeID, name, geoJSON, authorID string) (int, error) {
 	rid, err := uuid.Parse(routeID)
 	if err != nil {
+		return 0, fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidArgument)
+	}
+	author, err := parseAuthor(authorID)
+	if err != nil {
+		return 0, err
+	}
+	normalized, err := geo.Normalize(geoJSON)
+	if err != nil {
+		return 0, fmt.Errorf("%w: geo_json: %w", ErrInvalidArgument, err)
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		name = geo.FeatureName(geoJSON)
+	}
+	if normalized, err = c.enrichElevation(normalized); err != nil {
+		return 0, err
+	}
+	return c.saveRouteMap(rid, name, normalized, author, &model.MapVersion{AuthorID: author})
+}
+
+// enrichElevation completa con el DEM la altura de los puntos 2D.
+func (c *Controller) enrichElevation(geoJSON string) (string, error) {
+	if c.elev == nil {
+		return geoJSON, nil
+	}
+	filled := 0
+	out, err := geo.MapLines(geoJSON, func(line []geo.Point) []geo.Point {
+		enriched, n := c.elev.Enrich(line)
+		filled += n
+		return enriched
+	})
+	if err != nil || filled == 0 {
+		return geoJSON, err
+	}
+	return out, nil
+}
+
+// saveRouteMap guarda una geometría ya normalizada y, si la ruta es pública,
+// actualiza el índice, las teselas y el heatmap. owner es el usuario dueño
+// del track.
+func (c *Controller) saveRouteMap(rid uuid.UUID, name, geoJSON string, owner *uuid.UUID, v *model.MapVersion) (int, error) {
+	m := &model.Map{RouteID: rid, Name: name, GeoJSON: geoJSON, OwnerID: owner}
+	lines, err := applyStats(m)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.repo.SetRouteMap(m, v); err != nil {
+		return 0, err
+	}
+	// La visibilidad se lee de la base: otra réplica puede haber recibido el
+	// SetRouteListed.
+	listed, err := c.repo.IsRouteListed(rid)
+	if err != nil {
+		return 0, err
+	}
+	if listed {
+		c.indexRoute(m, lines)
+	} else {
+		c.unindexRoute(rid)
+	}
+	return m.Version, nil
+}
+
+// DeleteRouteMap borra la geometría de una ruta borrada, con su historial, y
+// la saca del índice, las teselas, el heatmap y la red de senderos.
+func (c *Controller) DeleteRouteMap(routeID string) error {
+	rid, err := uuid.Parse(routeID)
+	if err != nil {
+		return fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidArgument)
+	}
+	if err := c.repo.DeleteRouteMap(rid); err != nil {
 		return err
 	}
-	return c.repo.SetRouteMap(rid, geoJSON)
+	c.unindexRoute(rid)
+	return nil
 }
 
 func (c *Controller) GetRouteMap(routeID string) (*model.Map, error) {
 	rid, err := uuid.Parse(routeID)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidArgument)
 	}
 	return c.repo.GetByRouteID(rid)
 }
 
+// GetRouteStats devuelve las métricas guardadas. Los mapas guardados antes de
+// calcular métricas se procesan aquí y se actualizan. Con hide las métricas
+// se calculan al vuelo sobre la geometría sin esas zonas, la misma que
+// devuelve GetRouteGeometry, para no revelar inicio ni fin.
+func (c *Controller) GetRouteStats(routeID string, hide []geo.Circle) (*model.Map, error) {
+	if err := validateZones(hide); err != nil {
+		return nil, err
+	}
+	m, err := c.GetRouteMap(routeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(hide) > 0 {
+		lines, err := hiddenLines(m.GeoJSON, hide)
+		if err != nil {
+			return nil, err
+		}
+		out := &model.Map{RouteID: m.RouteID, Name: m.Name, OwnerID: m.OwnerID, Version: m.Version}
+		copyStats(out, geo.ComputeStats(lines, geo.DefaultProfileSamples))
+		return out, nil
+	}
+	if m.StatsAt != nil {
+		return m, nil
+	}
+	if _, err := applyStats(m); err != nil {
+		return nil, err
+	}
+	if err := c.repo.UpdateStats(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// hiddenLines devuelve las líneas de geoJSON fuera de las zonas; ninguna si
+// toda la ruta cae dentro.
+func hiddenLines(geoJSON string, hide []geo.Circle) ([][]geo.Point, error) {
+	hidden, err := geo.HideInCircles(geoJSON, hide)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := geo.ParseLines(hidden)
+	if errors.Is(err, geo.ErrNoLine) {
+		return nil, nil
+	}
+	return lines, err
+}
+
 func (c *Controller) ListMaps() ([]model.Map, error) {
 	return c.repo.List()
 }
+
+// RefreshIndex reconstruye el índice espacial y el heatmap con los mapas de
+// las rutas públicas y todos los tracks guardados. Se llama al arrancar y
+// periódicamente para ver los cambios hechos por otras réplicas.
+func (c *Controller) RefreshIndex() error {
+	maps, err := c.repo.List()
+	if err != nil {
+		return err
+	}
+	tracks, err := c.repo.ListWorkoutTracks()
+	if err != nil {
+		return err
+	}
+	unlistedIDs, err := c.repo.ListUnlistedRoutes()
+	if err != nil {
+		return err
+	}
+	unlisted := make(map[uuid.UUID]bool, len(unlistedIDs))
+	for _, id := range unlistedIDs {
+		unlisted[id] = true
+	}
+	zoneRows, err := c.repo.ListPrivacyZones()
+	if err != nil {
+		return err
+	}
+	zones := make(map[string][]geo.Circle)
+	for _, z := range zoneRows {
+		owner := z.UserID.String()
+		zones[owner] = append(zones[owner], geo.Circle{Center: geo.Point{Lat: z.Lat, Lon: z.Lon}, RadiusM: z.RadiusM})
+	}
+	c.zonesMu.Lock()
+	c.zones = zones
+	c.zonesMu.Unlock()
+
+	entries := make([]*spatial.Entry, 0, len(maps))
+	sources := make([]*heatmap.Source, 0, len(maps)+len(tracks))
+	for _, m := range maps {
+		if unlisted[m.RouteID] {
+			continue
+		}
+		lines, err := geo.ParseLines(m.GeoJSON)
+		if err != nil {
+			continue
+		}
+		owner := ownerString(m.OwnerID)
+		if e := spatial.NewEntry(m.RouteID.String(), m.Name, m.GeoJSON, lines, zones[owner]); e != nil {
+			entries = append(entries, e)
+		}
+		sources = append(sources, heatmap.NewSource(heatmap.RouteSourceID(m.RouteID.String()), owner, m.GeoJSON, lines, zones[owner]))
+	}
+	for _, t := range tracks {
+		lines, err := geo.ParseLines(t.GeoJSON)
+		if err != nil {
+			continue
+		}
+		owner := t.UserID.String()
+		sources = append(sources, heatmap.NewSource(heatmap.WorkoutSourceID(t.WorkoutID.String()), owner, t.GeoJSON, lines, zones[owner]))
+	}
+	// Solo se descartan las teselas de las rutas que cambiaron.
+	if changed := c.index.Replace(entries); len(changed) > 0 {
+		c.tiles.Invalidate(changed...)
+		c.invalidateGraph()
+	}
+	c.heatTiles.Invalidate(c.heat.Replace(sources)...)
+	return nil
+}
+
+// SearchRoutesNear busca rutas que pasen a menos de radiusM del punto.
+func (c *Controller) SearchRoutesNear(lat, lon, radiusM float64, limit int) ([]spatial.Match, error) {
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("%w: lat/lon out of range", ErrInvalidArgument)
+	}
+	if radiusM <= 0 || radiusM > maxSearchRadiusM {
+		return nil, fmt.Errorf("%w: radius_m must be between 0 and %.0f", ErrInvalidArgument, maxSearchRadiusM)
+	}
+	return c.index.Near(lat, lon, radiusM, searchLimit(limit)), nil
+}
+
+// SearchRoutesInBBox busca rutas con algún tramo dentro de la caja.
+func (c *Controller) SearchRoutesInBBox(box geo.BBox, limit int) ([]spatial.Match, error) {
+	if box.MinLat < -90 || box.MaxLat > 90 || box.MinLon < -180 || box.MaxLon > 180 ||
+		box.MinLat > box.MaxLat || box.MinLon > box.MaxLon {
+		return nil, fmt.Errorf("%w: bbox must satisfy -180 <= min_lon <= max_lon <= 180 and -90 <= min_lat <= max_lat <= 90", ErrInvalidArgument)
+	}
+	return c.index.InBBox(box, searchLimit(limit)), nil
+}
+
+func searchLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return defaultSearchLimit
+	case limit > maxSearchLimit:
+		return maxSearchLimit
+	}
+	return limit
+}
+
+func (c *Controller) SetWorkoutTrack(workoutID, userID, geoJSON string) error {
+	wid, err := uuid.Parse(workoutID)
+	if err != nil {
+		return fmt.Errorf("%w: workout_id must be a valid UUID", ErrInvalidArgument)
+	}
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
+	}
+	if err := c.repo.SetWorkoutTrack(wid, uid, geoJSON); err != nil {
+		return err
+	}
+	// Los tracks sin líneas (solo puntos, GeoJSON raro) no aportan al heatmap.
+	if lines, err := geo.ParseLines(geoJSON); err == nil {
+		c.upsertHeat(heatmap.NewSource(heatmap.WorkoutSourceID(wid.String()), uid.String(), geoJSON, lines, c.ownerZones(uid.String())))
+	}
+	return nil
+}
+
+// GetWorkoutTrack devuelve el track del workout sin los tramos que pasan
+// por las zonas de hide (vacío = track completo).
+func (c *Controller) GetWorkoutTrack(workoutID string, hide []geo.Circle) (*model.Track, error) {
+	wid, err := uuid.Parse(workoutID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: workout_id must be a valid UUID", ErrInvalidArgument)
+	}
+	if err := validateZones(hide); err != nil {
+		return nil, err
+	}
+	t, err := c.repo.GetWorkoutTrack(wid)
+	if err != nil {
+		return nil, err
+	}
+	if t.GeoJSON, err = geo.HideInCircles(t.GeoJSON, hide); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func validateZones(zones []geo.Circle) error {
+	for _, z := range zones {
+		if z.RadiusM <= 0 || z.Center.Lat < -90 || z.Center.Lat > 90 || z.Center.Lon < -180 || z.Center.Lon > 180 {
+			return fmt.Errorf("%w: privacy zones need a valid center and a positive radius", ErrInvalidArgument)
+		}
+	}
+	return nil
+}
+
+// applyStats parsea m.GeoJSON, copia las métricas al modelo y devuelve las
+// líneas para el índice espacial.
+func applyStats(m *model.Map) ([][]geo.Point, error) {
+	lines, err := geo.ParseLines(m.GeoJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: geo_json: %v", ErrInvalidArgument, err)
+	}
+	s := geo.ComputeStats(lines, geo.DefaultProfileSamples)
+	copyStats(m, s)
+	now := time.Now()
+	m.StatsAt = &now
+
+	m.Simplified, err = buildVariants(m.GeoJSON, (s.BBox.MinLat+s.BBox.MaxLat)/2)
+	if err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func copyStats(m *model.Map, s geo.Stats) {
+	m.DistanceM = s.DistanceM
+	m.ElevationGainM = s.ElevationGainM
+	m.ElevationLossM = s.ElevationLossM
+	m.MinElevationM = s.MinElevationM
+	m.MaxElevationM = s.MaxElevationM
+	m.MinLat, m.MinLon = s.BBox.MinLat, s.BBox.MinLon
+	m.MaxLat, m.MaxLon = s.BBox.MaxLat, s.BBox.MaxLon
+	m.StartLat, m.StartLon = s.Start.Lat, s.Start.Lon
+	m.EndLat, m.EndLon = s.End.Lat, s.End.Lon
+	m.Profile = make(model.ElevationProfile, 0, len(s.Profile))
+	for _, p := range s.Profile {
+		m.Profile = append(m.Profile, model.ProfileSample{DistanceM: p.DistanceM, ElevationM: p.ElevationM})
+	}
+}
@@ -0,0 +1,132 @@
+package mapctrl
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"trailbox/services/map/internal/geo"
+	"trailbox/services/map/internal/model"
+)
+
+const maxZoom = 22
+
+// GeometryQuery elige la resolución y el formato de GetRoute. Sin tolerancia
+// ni zoom se devuelve la geometría completa.
+type GeometryQuery struct {
+	ToleranceM float64
+	Zoom       int
+	Polyline   bool
+	Hide       []geo.Circle // zonas de privacidad del dueño; se quitan los tramos que pasan por ellas
+}
+
+// Geometry es la geometría de una ruta lista para enviar.
+type Geometry struct {
+	Map        *model.Map
+	GeoJSON    string
+	Polylines  []string
+	ToleranceM float64
+}
+
+// GetRouteGeometry devuelve la ruta simplificada con la tolerancia pedida o
+// con la variante precalculada de la banda de zoom.
+func (c *Controller) GetRouteGeometry(routeID string, q GeometryQuery) (*Geometry, error) {
+	if q.ToleranceM < 0 {
+		return nil, fmt.Errorf("%w: tolerance_m must not be negative", ErrInvalidArgument)
+	}
+	if q.Zoom < 0 || q.Zoom > maxZoom {
+		return nil, fmt.Errorf("%w: zoom must be between 0 and %d", ErrInvalidArgument, maxZoom)
+	}
+	if err := validateZones(q.Hide); err != nil {
+		return nil, err
+	}
+	m, err := c.GetRouteMap(routeID)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Geometry{Map: m, GeoJSON: m.GeoJSON}
+	switch {
+	case q.ToleranceM > 0:
+		g.ToleranceM = q.ToleranceM
+		if g.GeoJSON, err = geo.SimplifyGeoJSON(m.GeoJSON, q.ToleranceM); err != nil {
+			return nil, err
+		}
+	case q.Zoom > 0:
+		band, ok := bandFor(q.Zoom)
+		if !ok {
+			break
+		}
+		// Las filas guardadas antes de precalcular variantes se simplifican
+		// al vuelo.
+		for _, v := range m.Simplified {
+			if v.MaxZoom == band.MaxZoom {
+				g.GeoJSON, g.Polylines, g.ToleranceM = string(v.GeoJSON), v.Polylines, v.ToleranceM
+				break
+			}
+		}
+		if g.ToleranceM == 0 {
+			g.ToleranceM = geo.ToleranceForZoom(band.MaxZoom, (m.MinLat+m.MaxLat)/2)
+			if g.GeoJSON, err = geo.SimplifyGeoJSON(m.GeoJSON, g.ToleranceM); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(q.Hide) > 0 {
+		if g.GeoJSON, err = geo.HideInCircles(g.GeoJSON, q.Hide); err != nil {
+			return nil, err
+		}
+		g.Polylines = nil
+	}
+	if q.Polyline && g.Polylines == nil {
+		if g.Polylines, err = encodePolylines(g.GeoJSON); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func bandFor(zoom int) (geo.ZoomBand, bool) {
+	for _, b := range geo.ZoomBands {
+		if zoom <= b.MaxZoom {
+			return b, true
+		}
+	}
+	return geo.ZoomBand{}, false
+}
+
+// buildVariants precalcula la geometría de cada banda de zoom.
+func buildVariants(geoJSON string, centerLat float64) (model.SimplifiedVariants, error) {
+	out := make(model.SimplifiedVariants, 0, len(geo.ZoomBands))
+	for _, b := range geo.ZoomBands {
+		tol := geo.ToleranceForZoom(b.MaxZoom, centerLat)
+		simplified, err := geo.SimplifyGeoJSON(geoJSON, tol)
+		if err != nil {
+			return nil, err
+		}
+		polylines, err := encodePolylines(simplified)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, model.SimplifiedVariant{
+			MaxZoom:    b.MaxZoom,
+			ToleranceM: tol,
+			GeoJSON:    json.RawMessage(simplified),
+			Polylines:  polylines,
+		})
+	}
+	return out, nil
+}
+
+// encodePolylines genera una polilínea por cada línea de la ruta.
+func encodePolylines(geoJSON string) ([]string, error) {
+	lines, err := geo.ParseLines(geoJSON)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(lines))
+	for _, l := range lines {
+		out = append(out, geo.EncodePolyline(l))
+	}
+	return out, nil
+}
@@ -0,0 +1,93 @@
+package mapctrl
+
+import (
+	"fmt"
+
+	"trailbox/services/map/internal/geo"
+	"trailbox/services/map/internal/heatmap"
+	"trailbox/services/map/internal/model"
+	"trailbox/services/map/internal/tiles"
+
+	"github.com/google/uuid"
+)
+
+// GetHeatmapTile devuelve la tesela PNG z/x/y del heatmap. Con userID vacío
+// es el global, con los extremos de cada track recortados y sin las zonas de
+// privacidad de su dueño (ver SetUserPrivacyZones); si no, solo los tracks
+// de ese usuario, sin dibujar dentro de hide.
+func (c *Controller) GetHeatmapTile(z, x, y int, userID string, hide []geo.Circle) ([]byte, error) {
+	if err := tiles.Validate(z, x, y); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+	saturation := heatmap.GlobalSaturation
+	if userID != "" {
+		uid, err := uuid.Parse(userID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
+		}
+		userID = uid.String()
+		saturation = heatmap.UserSaturation
+	} else {
+		hide = nil
+	}
+	if err := validateZones(hide); err != nil {
+		return nil, err
+	}
+
+	key := heatmap.Key{Z: z, X: x, Y: y, UserID: userID, Zones: heatmap.ZonesKey(hide)}
+	if data, ok := c.heatTiles.Get(key); ok {
+		return data, nil
+	}
+	tracks := c.heat.Tracks(tiles.Bounds(z, x, y), userID)
+	data, err := heatmap.Render(z, x, y, tracks, saturation, hide)
+	if err != nil {
+		return nil, err
+	}
+	c.heatTiles.Put(key, data)
+	return data, nil
+}
+
+// SetUserPrivacyZones guarda la copia de las zonas de privacidad de userID
+// que usa el heatmap global y rearma el heatmap con ellas. El gateway la
+// manda entera cada vez que el usuario crea o borra una zona.
+func (c *Controller) SetUserPrivacyZones(userID string, zones []geo.Circle) error {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
+	}
+	if err := validateZones(zones); err != nil {
+		return err
+	}
+	rows := make([]model.PrivacyZone, 0, len(zones))
+	for _, z := range zones {
+		rows = append(rows, model.PrivacyZone{Lat: z.Center.Lat, Lon: z.Center.Lon, RadiusM: z.RadiusM})
+	}
+	if err := c.repo.SetPrivacyZones(uid, rows); err != nil {
+		return err
+	}
+	// Pocas veces cambian: se rearma todo en lugar de buscar sus tracks.
+	return c.RefreshIndex()
+}
+
+func (c *Controller) ownerZones(owner string) []geo.Circle {
+	c.zonesMu.RLock()
+	defer c.zonesMu.RUnlock()
+	return c.zones[owner]
+}
+
+// upsertHeat agrega o reemplaza un track del heatmap y descarta las teselas
+// que tocaba antes y las que toca ahora.
+func (c *Controller) upsertHeat(src *heatmap.Source) {
+	if prev, ok := c.heat.Upsert(src); ok {
+		c.heatTiles.Invalidate(prev, src.BBox)
+	} else {
+		c.heatTiles.Invalidate(src.BBox)
+	}
+}
+
+func ownerString(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
@@ -0,0 +1,112 @@
+package mapctrl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"trailbox/services/map/internal/geo"
+	"trailbox/services/map/internal/trailgraph"
+)
+
+// Límites del planificador.
+const (
+	maxPlanVias = 10
+	// planSnapM es lo más lejos que puede estar una parada del sendero.
+	planSnapM = 500.0
+)
+
+// PlannedRoute es un camino armado con tramos de rutas existentes.
+type PlannedRoute struct {
+	GeoJSON        string
+	DistanceM      float64
+	ElevationGainM float64
+	ElevationLossM float64
+	RouteIDs       []string
+}
+
+// PlanRoute busca el camino de start a end pasando por via en orden, sobre
+// la red de senderos que forman las rutas guardadas.
+func (c *Controller) PlanRoute(start, end geo.Point, via []geo.Point, opt trailgraph.Optimize) (*PlannedRoute, error) {
+	if len(via) > maxPlanVias {
+		return nil, fmt.Errorf("%w: at most %d via points", ErrInvalidArgument, maxPlanVias)
+	}
+	stops := append(append([]geo.Point{start}, via...), end)
+	for i, p := range stops {
+		if p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 {
+			return nil, fmt.Errorf("%w: stop %d: lat/lon out of range", ErrInvalidArgument, i)
+		}
+	}
+
+	path, err := c.trailGraph().Plan(stops, opt, planSnapM)
+	if err != nil {
+		return nil, err
+	}
+	if len(path.Points) < 2 {
+		return nil, fmt.Errorf("%w: start and end are the same point of the trail", ErrInvalidArgument)
+	}
+
+	s := geo.ComputeStats([][]geo.Point{path.Points}, 2)
+	out := &PlannedRoute{
+		DistanceM:      s.DistanceM,
+		ElevationGainM: s.ElevationGainM,
+		ElevationLossM: s.ElevationLossM,
+		RouteIDs:       path.RouteIDs,
+	}
+	if out.GeoJSON, err = plannedGeoJSON(out, path.Points); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// trailGraph devuelve la red de senderos y la reconstruye si alguna ruta
+// cambió desde la última vez. Se arma con el índice espacial, que ya tiene
+// las líneas de todas las rutas en memoria sin las zonas de privacidad.
+func (c *Controller) trailGraph() *trailgraph.Graph {
+	c.graphMu.Lock()
+	defer c.graphMu.Unlock()
+	if c.graph == nil {
+		entries := c.index.Entries()
+		routes := make([]trailgraph.Route, 0, len(entries))
+		for _, e := range entries {
+			routes = append(routes, trailgraph.Route{ID: e.RouteID, Lines: e.Lines})
+		}
+		c.graph = trailgraph.Build(routes)
+	}
+	return c.graph
+}
+
+// invalidateGraph hace que el próximo PlanRoute reconstruya la red.
+func (c *Controller) invalidateGraph() {
+	c.graphMu.Lock()
+	c.graph = nil
+	c.graphMu.Unlock()
+}
+
+func plannedGeoJSON(r *PlannedRoute, points []geo.Point) (string, error) {
+	coords := make([][]float64, 0, len(points))
+	for _, p := range points {
+		c := []float64{round6(p.Lon), round6(p.Lat)}
+		if p.HasEle {
+			c = append(c, math.Round(p.Ele*10)/10)
+		}
+		coords = append(coords, c)
+	}
+	out, err := json.Marshal(map[string]interface{}{
+		"type": "Feature",
+		"properties": map[string]interface{}{
+			"distance_m":       math.Round(r.DistanceM),
+			"elevation_gain_m": math.Round(r.ElevationGainM),
+			"route_ids":        r.RouteIDs,
+		},
+		"geometry": map[string]interface{}{
+			"type":        "LineString",
+			"coordinates": coords,
+		},
+	})
+	return string(out), err
+}
+
+func round6(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
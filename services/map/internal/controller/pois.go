@@ -0,0 +1,143 @@
+package mapctrl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"trailbox/services/map/internal/geo"
+	"trailbox/services/map/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// Límites de los puntos de interés.
+const (
+	defaultPOIRadiusM    = 200.0
+	maxPOIRadiusM        = 5000.0
+	maxPOINameLen        = 120
+	maxPOIDescriptionLen = 2000
+	maxPOIPhotoRefLen    = 500
+)
+
+var poiTypes = map[model.POIType]bool{
+	model.POIWater:     true,
+	model.POIViewpoint: true,
+	model.POIHazard:    true,
+	model.POIParking:   true,
+	model.POIShelter:   true,
+	model.POIOther:     true,
+}
+
+// RoutePOI es un POI cercano a una ruta.
+type RoutePOI struct {
+	POI       model.POI
+	DistanceM float64 // distancia a la línea de la ruta
+	AlongM    float64 // metros desde el inicio de la ruta hasta el punto más cercano
+}
+
+func (c *Controller) CreatePOI(p *model.POI, createdBy string) error {
+	if err := validatePOI(p); err != nil {
+		return err
+	}
+	author, err := parseAuthor(createdBy)
+	if err != nil {
+		return err
+	}
+	p.CreatedBy = author
+	return c.repo.CreatePOI(p)
+}
+
+func (c *Controller) GetPOI(id string) (*model.POI, error) {
+	pid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: id must be a valid UUID", ErrInvalidArgument)
+	}
+	return c.repo.GetPOI(pid)
+}
+
+// UpdatePOI reemplaza los campos editables del POI y devuelve el guardado.
+func (c *Controller) UpdatePOI(id string, p *model.POI) (*model.POI, error) {
+	pid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: id must be a valid UUID", ErrInvalidArgument)
+	}
+	if err := validatePOI(p); err != nil {
+		return nil, err
+	}
+	p.ID = pid
+	if err := c.repo.UpdatePOI(p); err != nil {
+		return nil, err
+	}
+	return c.repo.GetPOI(pid)
+}
+
+func (c *Controller) DeletePOI(id string) error {
+	pid, err := uuid.Parse(id)
+	if err != nil {
+		return fmt.Errorf("%w: id must be a valid UUID", ErrInvalidArgument)
+	}
+	return c.repo.DeletePOI(pid)
+}
+
+// ListPOIsForRoute devuelve los POIs a menos de withinM metros de la línea
+// de la ruta, ordenados por su posición a lo largo de ella.
+func (c *Controller) ListPOIsForRoute(routeID string, withinM float64, types []model.POIType) ([]RoutePOI, error) {
+	switch {
+	case withinM == 0:
+		withinM = defaultPOIRadiusM
+	case withinM < 0 || withinM > maxPOIRadiusM:
+		return nil, fmt.Errorf("%w: within_m must be between 0 and %.0f", ErrInvalidArgument, maxPOIRadiusM)
+	}
+	for _, t := range types {
+		if !poiTypes[t] {
+			return nil, fmt.Errorf("%w: unknown poi type %q", ErrInvalidArgument, t)
+		}
+	}
+	m, err := c.GetRouteMap(routeID)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := geo.ParseLines(m.GeoJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	// Caja de la ruta ampliada con el radio; el filtro exacto se hace aquí.
+	box := geo.ComputeStats(lines, 2).BBox.Expand(withinM)
+	candidates, err := c.repo.ListPOIsInBBox(box.MinLat, box.MinLon, box.MaxLat, box.MaxLon, types)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]RoutePOI, 0, len(candidates))
+	for _, p := range candidates {
+		d, along := geo.Locate(geo.Point{Lat: p.Lat, Lon: p.Lon}, lines)
+		if d <= withinM {
+			out = append(out, RoutePOI{POI: p, DistanceM: d, AlongM: along})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AlongM < out[j].AlongM })
+	return out, nil
+}
+
+func validatePOI(p *model.POI) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Description = strings.TrimSpace(p.Description)
+	p.PhotoRef = strings.TrimSpace(p.PhotoRef)
+	switch {
+	case !poiTypes[p.Type]:
+		return fmt.Errorf("%w: type is required", ErrInvalidArgument)
+	case p.Lat < -90 || p.Lat > 90:
+		return fmt.Errorf("%w: lat must be between -90 and 90", ErrInvalidArgument)
+	case p.Lon < -180 || p.Lon > 180:
+		return fmt.Errorf("%w: lon must be between -180 and 180", ErrInvalidArgument)
+	case len(p.Name) > maxPOINameLen:
+		return fmt.Errorf("%w: name must be at most %d characters", ErrInvalidArgument, maxPOINameLen)
+	case len(p.Description) > maxPOIDescriptionLen:
+		return fmt.Errorf("%w: description must be at most %d characters", ErrInvalidArgument, maxPOIDescriptionLen)
+	case len(p.PhotoRef) > maxPOIPhotoRefLen:
+		return fmt.Errorf("%w: photo_ref must be at most %d characters", ErrInvalidArgument, maxPOIPhotoRefLen)
+	}
+	return nil
+}
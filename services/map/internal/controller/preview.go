@@ -0,0 +1,69 @@
+package mapctrl
+
+import (
+	"fmt"
+
+	"trailbox/services/map/internal/geo"
+	"trailbox/services/map/internal/heatmap"
+	"trailbox/services/map/internal/preview"
+
+	"github.com/google/uuid"
+)
+
+// Tamaños permitidos de las miniaturas, en píxeles.
+const (
+	defaultPreviewWidth  = 320
+	defaultPreviewHeight = 200
+	minPreviewSide       = 32
+	maxPreviewSide       = 1024
+)
+
+// Preview es una miniatura PNG de la ruta.
+type Preview struct {
+	PNG           []byte
+	Version       int
+	Width, Height int
+	OwnerID       *uuid.UUID // dueño del track, como en model.Map
+}
+
+// RenderRoutePreview dibuja la ruta en un PNG, sin los tramos que pasan por
+// hide. El resultado se cachea por versión del mapa, tamaño, estilo y zonas.
+func (c *Controller) RenderRoutePreview(routeID string, width, height int, style preview.Style, hide []geo.Circle) (*Preview, error) {
+	if width == 0 {
+		width = defaultPreviewWidth
+	}
+	if height == 0 {
+		height = defaultPreviewHeight
+	}
+	if width < minPreviewSide || width > maxPreviewSide || height < minPreviewSide || height > maxPreviewSide {
+		return nil, fmt.Errorf("%w: width and height must be between %d and %d", ErrInvalidArgument, minPreviewSide, maxPreviewSide)
+	}
+	if err := validateZones(hide); err != nil {
+		return nil, err
+	}
+	m, err := c.GetRouteMap(routeID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Preview{Version: m.Version, Width: width, Height: height, OwnerID: m.OwnerID}
+	key := preview.Key{RouteID: m.RouteID.String(), Version: m.Version, Width: width, Height: height, Style: style, Zones: heatmap.ZonesKey(hide)}
+	if data, ok := c.previews.Get(key); ok {
+		out.PNG = data
+		return out, nil
+	}
+	var lines [][]geo.Point
+	if len(hide) > 0 {
+		lines, err = hiddenLines(m.GeoJSON, hide)
+	} else {
+		lines, err = geo.ParseLines(m.GeoJSON)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if out.PNG, err = preview.Render(lines, width, height, style); err != nil {
+		return nil, err
+	}
+	c.previews.Put(key, out.PNG)
+	return out, nil
+}
@@ -0,0 +1,33 @@
+package mapctrl
+
+import (
+	"fmt"
+
+	"trailbox/services/map/internal/tiles"
+)
+
+// GetTile devuelve la tesela MVT z/x/y con las rutas que la cruzan, sin lo
+// que cae en las zonas de privacidad de sus dueños (ver spatial.NewEntry).
+// Un resultado vacío significa que no hay rutas en la tesela.
+func (c *Controller) GetTile(z, x, y int) ([]byte, error) {
+	if err := tiles.Validate(z, x, y); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+	if data, ok := c.tiles.Get(z, x, y); ok {
+		return data, nil
+	}
+
+	entries := c.index.Intersecting(tiles.Bounds(z, x, y))
+	routes := make([]tiles.Route, 0, len(entries))
+	for _, e := range entries {
+		routes = append(routes, tiles.Route{
+			ID:        e.RouteID,
+			Name:      e.Name,
+			DistanceM: e.LengthM,
+			Lines:     e.Lines,
+		})
+	}
+	data := tiles.Render(z, x, y, routes)
+	c.tiles.Put(z, x, y, data)
+	return data, nil
+}
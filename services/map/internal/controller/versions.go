@@ -0,0 +1,81 @@
+package mapctrl
+
+import (
+	"fmt"
+
+	"trailbox/services/map/internal/geo"
+	"trailbox/services/map/internal/model"
+	"trailbox/services/map/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ListRouteMapVersions devuelve el historial de la ruta, de la versión más
+// nueva a la más vieja, sin la geometría.
+func (c *Controller) ListRouteMapVersions(routeID string) ([]model.MapVersion, error) {
+	rid, err := uuid.Parse(routeID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidArgument)
+	}
+	versions, err := c.repo.ListVersions(rid)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	return versions, nil
+}
+
+// GetRouteMapVersion devuelve una versión con su geometría, sin los tramos
+// que pasan por hide.
+func (c *Controller) GetRouteMapVersion(routeID string, version int, hide []geo.Circle) (*model.MapVersion, error) {
+	rid, err := uuid.Parse(routeID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidArgument)
+	}
+	if version <= 0 {
+		return nil, fmt.Errorf("%w: version must be positive", ErrInvalidArgument)
+	}
+	if err := validateZones(hide); err != nil {
+		return nil, err
+	}
+	v, err := c.repo.GetVersion(rid, version)
+	if err != nil || len(hide) == 0 {
+		return v, err
+	}
+	if v.GeoJSON, err = geo.HideInCircles(v.GeoJSON, hide); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// RevertRouteMap vuelve a la geometría de una versión anterior. No borra
+// nada: la restauración se guarda como una versión nueva, así que también se
+// puede deshacer.
+func (c *Controller) RevertRouteMap(routeID string, version int, authorID string) (int, error) {
+	author, err := parseAuthor(authorID)
+	if err != nil {
+		return 0, err
+	}
+	old, err := c.GetRouteMapVersion(routeID, version, nil)
+	if err != nil {
+		return 0, err
+	}
+	return c.saveRouteMap(old.RouteID, old.Name, old.GeoJSON, old.OwnerID, &model.MapVersion{
+		AuthorID:     author,
+		RevertedFrom: &old.Version,
+	})
+}
+
+// parseAuthor acepta un author_id vacío (cambios hechos por el sistema).
+func parseAuthor(authorID string) (*uuid.UUID, error) {
+	if authorID == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(authorID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: author_id must be a valid UUID", ErrInvalidArgument)
+	}
+	return &id, nil
+}
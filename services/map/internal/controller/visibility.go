@@ -0,0 +1,75 @@
+package mapctrl
+
+import (
+	"errors"
+	"fmt"
+
+	"trailbox/services/map/internal/geo"
+	"trailbox/services/map/internal/heatmap"
+	"trailbox/services/map/internal/model"
+	"trailbox/services/map/internal/repository"
+	"trailbox/services/map/internal/spatial"
+
+	"github.com/google/uuid"
+)
+
+// SetRouteListed guarda si la ruta es pública. Las que no lo son salen del
+// índice espacial, las teselas, el heatmap y la red de senderos; su
+// geometría sigue disponible por id, y el gateway decide quién la ve.
+func (c *Controller) SetRouteListed(routeID string, listed bool) error {
+	rid, err := uuid.Parse(routeID)
+	if err != nil {
+		return fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidArgument)
+	}
+	if err := c.repo.SetRouteListed(rid, listed); err != nil {
+		return err
+	}
+	if !listed {
+		c.unindexRoute(rid)
+		return nil
+	}
+	m, err := c.repo.GetByRouteID(rid)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil // todavía sin geometría
+	}
+	if err != nil {
+		return err
+	}
+	if lines, err := geo.ParseLines(m.GeoJSON); err == nil {
+		c.indexRoute(m, lines)
+	}
+	return nil
+}
+
+// indexRoute agrega o reemplaza la ruta en el índice y el heatmap y descarta
+// las teselas afectadas.
+func (c *Controller) indexRoute(m *model.Map, lines [][]geo.Point) {
+	id := m.RouteID.String()
+	owner := ownerString(m.OwnerID)
+	zones := c.ownerZones(owner)
+	// Si toda la ruta cae en las zonas del dueño no sale en teselas,
+	// búsqueda ni planificador.
+	if entry := spatial.NewEntry(id, m.Name, m.GeoJSON, lines, zones); entry == nil {
+		if box, ok := c.index.Remove(id); ok {
+			c.tiles.Invalidate(box)
+		}
+	} else if prev, ok := c.index.Upsert(entry); ok {
+		c.tiles.Invalidate(prev, entry.BBox)
+	} else {
+		c.tiles.Invalidate(entry.BBox)
+	}
+	c.invalidateGraph()
+	c.upsertHeat(heatmap.NewSource(heatmap.RouteSourceID(id), owner, m.GeoJSON, lines, zones))
+}
+
+// unindexRoute saca la ruta del índice, las teselas, el heatmap y la red de
+// senderos.
+func (c *Controller) unindexRoute(rid uuid.UUID) {
+	if box, ok := c.index.Remove(rid.String()); ok {
+		c.tiles.Invalidate(box)
+	}
+	if box, ok := c.heat.Remove(heatmap.RouteSourceID(rid.String())); ok {
+		c.heatTiles.Invalidate(box)
+	}
+	c.invalidateGraph()
+}
@@ -0,0 +1,238 @@
+// Package dem lee modelos digitales de elevación (SRTM .hgt y GeoTIFF) de un
+// directorio local para completar la altura de los tracks 2D sin salir a
+// internet.
+package dem
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"trailbox/services/map/internal/geo"
+)
+
+const (
+	// DefaultMaxLoaded es cuántas teselas se mantienen decodificadas en
+	// memoria. Una tesela SRTM1 ocupa ~50 MB como float32.
+	DefaultMaxLoaded = 3
+
+	// smoothWindowM es la ventana del suavizado a lo largo del track; quita
+	// los escalones del DEM sin aplanar las subidas reales.
+	smoothWindowM = 60.0
+)
+
+// grid es una malla regular en lon/lat. (originLon, originLat) es el centro
+// de la muestra (0, 0); las filas avanzan hacia el sur.
+type grid struct {
+	originLon, originLat float64
+	dLon, dLat           float64
+	cols, rows           int
+	data                 []float32 // NaN = sin dato
+}
+
+// source es un archivo del directorio ya indexado; la malla se carga al usarla.
+type source struct {
+	path   string
+	bounds geo.BBox
+	load   func() (*grid, error)
+}
+
+// DEM busca alturas en las teselas de un directorio. Es seguro para uso
+// concurrente.
+type DEM struct {
+	sources   []*source
+	maxLoaded int
+
+	mu     sync.Mutex
+	order  *list.List // frente = más reciente
+	loaded map[*source]*list.Element
+}
+
+type loadedGrid struct {
+	src *source
+	g   *grid
+}
+
+// Open indexa los .hgt y .tif/.tiff del directorio (sin leer las muestras).
+// Los archivos que no se entienden se registran y se saltan.
+func Open(dir string, maxLoaded int) (*DEM, error) {
+	if maxLoaded <= 0 {
+		maxLoaded = DefaultMaxLoaded
+	}
+	d := &DEM{maxLoaded: maxLoaded, order: list.New(), loaded: map[*source]*list.Element{}}
+	err := filepath.WalkDir(dir, func(path string, e os.DirEntry, err error) error {
+		if err != nil || e.IsDir() {
+			return err
+		}
+		var src *source
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".hgt":
+			src, err = hgtSource(path)
+		case ".tif", ".tiff":
+			src, err = tiffSource(path)
+		default:
+			return nil
+		}
+		if err != nil {
+			log.Printf("[map] dem: skipping %s: %v", path, err)
+			return nil
+		}
+		d.sources = append(d.sources, src)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dem: scan %s: %w", dir, err)
+	}
+	return d, nil
+}
+
+// Len devuelve la cantidad de teselas indexadas.
+func (d *DEM) Len() int {
+	return len(d.sources)
+}
+
+// Elevation interpola bilinealmente la altura en lat/lon. ok es false si no
+// hay tesela o todas las muestras vecinas son vacías.
+func (d *DEM) Elevation(lat, lon float64) (float64, bool) {
+	for _, src := range d.sources {
+		b := src.bounds
+		if lon < b.MinLon || lon > b.MaxLon || lat < b.MinLat || lat > b.MaxLat {
+			continue
+		}
+		g, err := d.grid(src)
+		if err != nil {
+			log.Printf("[map] dem: load %s: %v", src.path, err)
+			continue
+		}
+		if v, ok := g.sample(lat, lon); ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// Enrich devuelve una copia de la línea con altura en los puntos 2D que caen
+// dentro del DEM, suavizada a lo largo del recorrido. Los puntos que ya traían
+// altura no se tocan. n es la cantidad de puntos completados.
+func (d *DEM) Enrich(line []geo.Point) (out []geo.Point, n int) {
+	out = make([]geo.Point, len(line))
+	copy(out, line)
+	filled := make([]bool, len(line))
+	for i, p := range line {
+		if p.HasEle {
+			continue
+		}
+		if v, ok := d.Elevation(p.Lat, p.Lon); ok {
+			out[i].Ele, out[i].HasEle = v, true
+			filled[i] = true
+			n++
+		}
+	}
+	if n > 1 {
+		smooth(out, filled)
+	}
+	return out, n
+}
+
+// smooth aplica una media ponderada triangular de smoothWindowM metros a los
+// puntos completados con el DEM.
+func smooth(line []geo.Point, filled []bool) {
+	cum := make([]float64, len(line))
+	for i := 1; i < len(line); i++ {
+		cum[i] = cum[i-1] + geo.Haversine(line[i-1], line[i])
+	}
+	raw := make([]float64, len(line))
+	for i, p := range line {
+		raw[i] = p.Ele
+	}
+	for i := range line {
+		if !filled[i] {
+			continue
+		}
+		sum, weights := 0.0, 0.0
+		for j := i; j >= 0 && cum[i]-cum[j] < smoothWindowM; j-- {
+			if filled[j] {
+				w := 1 - (cum[i]-cum[j])/smoothWindowM
+				sum, weights = sum+w*raw[j], weights+w
+			}
+		}
+		for j := i + 1; j < len(line) && cum[j]-cum[i] < smoothWindowM; j++ {
+			if filled[j] {
+				w := 1 - (cum[j]-cum[i])/smoothWindowM
+				sum, weights = sum+w*raw[j], weights+w
+			}
+		}
+		line[i].Ele = sum / weights
+	}
+}
+
+// grid devuelve la malla de src, cargándola si hace falta y descartando la
+// usada hace más tiempo.
+func (d *DEM) grid(src *source) (*grid, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if el, ok := d.loaded[src]; ok {
+		d.order.MoveToFront(el)
+		return el.Value.(*loadedGrid).g, nil
+	}
+	g, err := src.load()
+	if err != nil {
+		return nil, err
+	}
+	d.loaded[src] = d.order.PushFront(&loadedGrid{src: src, g: g})
+	for d.order.Len() > d.maxLoaded {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.loaded, oldest.Value.(*loadedGrid).src)
+	}
+	return g, nil
+}
+
+func (g *grid) bounds() geo.BBox {
+	// Medio paso de margen para no perder los bordes de las mallas por área.
+	return geo.BBox{
+		MinLon: g.originLon - g.dLon/2,
+		MaxLon: g.originLon + (float64(g.cols)-0.5)*g.dLon,
+		MinLat: g.originLat - (float64(g.rows)-0.5)*g.dLat,
+		MaxLat: g.originLat + g.dLat/2,
+	}
+}
+
+func (g *grid) sample(lat, lon float64) (float64, bool) {
+	x := clamp((lon-g.originLon)/g.dLon, 0, float64(g.cols-1))
+	y := clamp((g.originLat-lat)/g.dLat, 0, float64(g.rows-1))
+	x0, y0 := int(x), int(y)
+	x1, y1 := min(x0+1, g.cols-1), min(y0+1, g.rows-1)
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	// Las muestras vacías se ignoran y se reparte su peso entre las demás.
+	sum, weights := 0.0, 0.0
+	for _, c := range [4]struct {
+		col, row int
+		w        float64
+	}{
+		{x0, y0, (1 - fx) * (1 - fy)},
+		{x1, y0, fx * (1 - fy)},
+		{x0, y1, (1 - fx) * fy},
+		{x1, y1, fx * fy},
+	} {
+		v := g.data[c.row*g.cols+c.col]
+		if math.IsNaN(float64(v)) || c.w == 0 {
+			continue
+		}
+		sum, weights = sum+c.w*float64(v), weights+c.w
+	}
+	if weights == 0 {
+		return 0, false
+	}
+	return sum / weights, true
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
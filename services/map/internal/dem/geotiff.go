@@ -0,0 +1,396 @@
+package dem
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Lector mínimo de GeoTIFF: una banda, en tiras o teselas, sin compresión o
+// Deflate, con predictor horizontal opcional y coordenadas geográficas
+// (lon/lat). Es lo que generan gdal_translate y los portales de DEM.
+
+const (
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagStripOffsets    = 273
+	tagSamplesPerPixel = 277
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagPredictor       = 317
+	tagTileWidth       = 322
+	tagTileLength      = 323
+	tagTileOffsets     = 324
+	tagTileByteCounts  = 325
+	tagSampleFormat    = 339
+	tagPixelScale      = 33550
+	tagTiepoint        = 33922
+	tagGeoKeyDirectory = 34735
+	tagGDALNoData      = 42113
+
+	geoKeyModelType  = 1024
+	geoKeyRasterType = 1025
+
+	modelTypeGeographic = 2
+	rasterPixelIsPoint  = 2
+
+	// Límites para no reservar memoria según lo que diga una cabecera rota:
+	// 8192×8192 muestras (~256 MB como float32) y 16 MB por tag.
+	maxTIFFPixels   = 1 << 26
+	maxTIFFTagBytes = 1 << 24
+)
+
+var errUnsupportedTIFF = errors.New("unsupported tiff")
+
+type tiffInfo struct {
+	order                  binary.ByteOrder
+	width, height          int
+	bits, format           int
+	compression, predictor int
+	chunkW, chunkH         int // tamaño de cada tira o tesela
+	offsets, counts        []uint64
+	nodata                 float64
+	hasNodata              bool
+	g                      grid
+}
+
+func tiffSource(path string) (*source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := readTIFFInfo(f)
+	if err != nil {
+		return nil, err
+	}
+	src := &source{path: path, bounds: info.g.bounds()}
+	src.load = func() (*grid, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return info.decode(f)
+	}
+	return src, nil
+}
+
+func readTIFFInfo(r io.ReaderAt) (*tiffInfo, error) {
+	head := make([]byte, 8)
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	info := &tiffInfo{compression: 1, predictor: 1, format: 1}
+	switch string(head[:2]) {
+	case "II":
+		info.order = binary.LittleEndian
+	case "MM":
+		info.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: not a tiff file", errUnsupportedTIFF)
+	}
+	if info.order.Uint16(head[2:]) != 42 {
+		return nil, fmt.Errorf("%w: BigTIFF is not supported", errUnsupportedTIFF)
+	}
+
+	ifd := int64(info.order.Uint32(head[4:]))
+	cnt := make([]byte, 2)
+	if _, err := r.ReadAt(cnt, ifd); err != nil {
+		return nil, err
+	}
+	n := int(info.order.Uint16(cnt))
+	entries := make([]byte, 12*n)
+	if _, err := r.ReadAt(entries, ifd+2); err != nil {
+		return nil, err
+	}
+
+	var (
+		scale, tiepoint []float64
+		geoKeys         []uint64
+		samples         = 1
+	)
+	for i := 0; i < n; i++ {
+		e := entries[12*i : 12*i+12]
+		tag := info.order.Uint16(e)
+		ints, floats, text, err := info.readValues(r, e)
+		if err != nil {
+			return nil, fmt.Errorf("tag %d: %w", tag, err)
+		}
+		first := 0
+		if len(ints) > 0 {
+			first = int(ints[0])
+		}
+		switch tag {
+		case tagImageWidth:
+			info.width = first
+		case tagImageLength:
+			info.height = first
+		case tagBitsPerSample:
+			info.bits = first
+		case tagCompression:
+			info.compression = first
+		case tagSamplesPerPixel:
+			samples = first
+		case tagRowsPerStrip:
+			info.chunkH = first
+		case tagPredictor:
+			info.predictor = first
+		case tagTileWidth:
+			info.chunkW = first
+		case tagTileLength:
+			info.chunkH = first
+		case tagStripOffsets, tagTileOffsets:
+			info.offsets = ints
+		case tagStripByteCounts, tagTileByteCounts:
+			info.counts = ints
+		case tagSampleFormat:
+			info.format = first
+		case tagPixelScale:
+			scale = floats
+		case tagTiepoint:
+			tiepoint = floats
+		case tagGeoKeyDirectory:
+			geoKeys = ints
+		case tagGDALNoData:
+			if v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimRight(text, "\x00")), 64); err == nil {
+				info.nodata, info.hasNodata = v, true
+			}
+		}
+	}
+
+	switch {
+	case info.width <= 0 || info.height <= 0:
+		return nil, fmt.Errorf("%w: missing image size", errUnsupportedTIFF)
+	case samples != 1:
+		return nil, fmt.Errorf("%w: %d bands, expected 1", errUnsupportedTIFF, samples)
+	case info.compression != 1 && info.compression != 8 && info.compression != 32946:
+		return nil, fmt.Errorf("%w: compression %d", errUnsupportedTIFF, info.compression)
+	case info.predictor != 1 && !(info.predictor == 2 && info.format != 3):
+		return nil, fmt.Errorf("%w: predictor %d", errUnsupportedTIFF, info.predictor)
+	case info.width > maxTIFFPixels/info.height:
+		return nil, fmt.Errorf("%w: %dx%d is too large", errUnsupportedTIFF, info.width, info.height)
+	case len(info.offsets) == 0 || len(info.offsets) != len(info.counts):
+		return nil, fmt.Errorf("%w: missing strip or tile offsets", errUnsupportedTIFF)
+	case len(scale) < 2 || len(tiepoint) < 6:
+		return nil, fmt.Errorf("%w: not georeferenced (needs ModelPixelScale and ModelTiepoint)", errUnsupportedTIFF)
+	case !(scale[0] > 0 && scale[1] > 0) || math.IsInf(scale[0], 0) || math.IsInf(scale[1], 0):
+		return nil, fmt.Errorf("%w: pixel scale must be positive", errUnsupportedTIFF)
+	}
+	for _, v := range tiepoint[:6] {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%w: invalid tiepoint", errUnsupportedTIFF)
+		}
+	}
+	if _, err := info.sampleReader(); err != nil {
+		return nil, err
+	}
+	if info.chunkW == 0 {
+		info.chunkW = info.width // tiras: cada una ocupa todo el ancho
+	}
+	if info.chunkH == 0 {
+		info.chunkH = info.height
+	}
+	if info.chunkW <= 0 || info.chunkH <= 0 || info.chunkW > maxTIFFPixels/info.chunkH {
+		return nil, fmt.Errorf("%w: %dx%d strips or tiles are not supported", errUnsupportedTIFF, info.chunkW, info.chunkH)
+	}
+	across := (info.width + info.chunkW - 1) / info.chunkW
+	down := (info.height + info.chunkH - 1) / info.chunkH
+	if len(info.offsets) > across*down {
+		return nil, fmt.Errorf("%w: %d strips or tiles for a %dx%d image", errUnsupportedTIFF, len(info.offsets), info.width, info.height)
+	}
+	for _, n := range info.counts {
+		// Deflate casi nunca crece más que unos bytes sobre el dato crudo.
+		if n > uint64(info.chunkBytes())*2+1024 {
+			return nil, fmt.Errorf("%w: strip or tile of %d bytes", errUnsupportedTIFF, n)
+		}
+	}
+
+	pixelIsPoint := false
+	if len(geoKeys) >= 4 {
+		for k := 4; k+3 < len(geoKeys) && k < 4+4*int(geoKeys[3]); k += 4 {
+			id, loc, val := geoKeys[k], geoKeys[k+1], geoKeys[k+3]
+			if loc != 0 {
+				continue
+			}
+			switch id {
+			case geoKeyModelType:
+				if val != modelTypeGeographic {
+					return nil, fmt.Errorf("%w: projected rasters are not supported, reproject to EPSG:4326", errUnsupportedTIFF)
+				}
+			case geoKeyRasterType:
+				pixelIsPoint = val == rasterPixelIsPoint
+			}
+		}
+	}
+
+	// El tiepoint liga el píxel (i, j) con (lon, lat). En rasters por área la
+	// coordenada es la esquina del píxel, no su centro.
+	i, j, lon, lat := tiepoint[0], tiepoint[1], tiepoint[3], tiepoint[4]
+	half := 0.5
+	if pixelIsPoint {
+		half = 0
+	}
+	info.g = grid{
+		originLon: lon + (half-i)*scale[0],
+		originLat: lat - (half-j)*scale[1],
+		dLon:      scale[0],
+		dLat:      scale[1],
+		cols:      info.width,
+		rows:      info.height,
+	}
+	return info, nil
+}
+
+// readValues lee los valores de una entrada del IFD como enteros, reales o
+// texto según su tipo.
+func (info *tiffInfo) readValues(r io.ReaderAt, e []byte) ([]uint64, []float64, string, error) {
+	typ := info.order.Uint16(e[2:])
+	count := int(info.order.Uint32(e[4:]))
+	size := map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 11: 4, 12: 8, 16: 8}[typ]
+	if size == 0 {
+		return nil, nil, "", nil // tipos que no usamos
+	}
+	if size*count > maxTIFFTagBytes {
+		return nil, nil, "", fmt.Errorf("%w: tag too large", errUnsupportedTIFF)
+	}
+	data := e[8:12]
+	if size*count > 4 {
+		data = make([]byte, size*count)
+		if _, err := r.ReadAt(data, int64(info.order.Uint32(e[8:]))); err != nil {
+			return nil, nil, "", err
+		}
+	}
+
+	var (
+		ints   []uint64
+		floats []float64
+	)
+	for k := 0; k < count; k++ {
+		b := data[k*size:]
+		switch typ {
+		case 1:
+			ints = append(ints, uint64(b[0]))
+		case 3:
+			ints = append(ints, uint64(info.order.Uint16(b)))
+		case 4:
+			ints = append(ints, uint64(info.order.Uint32(b)))
+		case 16:
+			ints = append(ints, info.order.Uint64(b))
+		case 11:
+			floats = append(floats, float64(math.Float32frombits(info.order.Uint32(b))))
+		case 12:
+			floats = append(floats, math.Float64frombits(info.order.Uint64(b)))
+		}
+	}
+	text := ""
+	if typ == 2 {
+		text = string(data[:count])
+	}
+	return ints, floats, text, nil
+}
+
+// sampleReader devuelve la función que interpreta los bits crudos de una
+// muestra según BitsPerSample y SampleFormat.
+func (info *tiffInfo) sampleReader() (func(raw uint64) float64, error) {
+	switch {
+	case info.format == 1 && (info.bits == 8 || info.bits == 16 || info.bits == 32):
+		return func(raw uint64) float64 { return float64(raw) }, nil
+	case info.format == 2 && info.bits == 8:
+		return func(raw uint64) float64 { return float64(int8(raw)) }, nil
+	case info.format == 2 && info.bits == 16:
+		return func(raw uint64) float64 { return float64(int16(raw)) }, nil
+	case info.format == 2 && info.bits == 32:
+		return func(raw uint64) float64 { return float64(int32(raw)) }, nil
+	case info.format == 3 && info.bits == 32:
+		return func(raw uint64) float64 { return float64(math.Float32frombits(uint32(raw))) }, nil
+	case info.format == 3 && info.bits == 64:
+		return math.Float64frombits, nil
+	}
+	return nil, fmt.Errorf("%w: %d-bit samples with format %d", errUnsupportedTIFF, info.bits, info.format)
+}
+
+// chunkBytes es el tamaño sin comprimir de una tira o tesela.
+func (info *tiffInfo) chunkBytes() int {
+	return info.chunkW * info.chunkH * info.bits / 8
+}
+
+// decode lee todas las tiras o teselas y arma la malla.
+func (info *tiffInfo) decode(r io.ReaderAt) (*grid, error) {
+	read, err := info.sampleReader()
+	if err != nil {
+		return nil, err
+	}
+	g := info.g
+	g.data = make([]float32, g.cols*g.rows)
+	for k := range g.data {
+		g.data[k] = float32(math.NaN())
+	}
+
+	bytesPer := info.bits / 8
+	mask := uint64(1)<<uint(info.bits) - 1
+	if info.bits == 64 {
+		mask = math.MaxUint64
+	}
+	across := (info.width + info.chunkW - 1) / info.chunkW
+	for c := range info.offsets {
+		buf := make([]byte, info.counts[c])
+		if _, err := r.ReadAt(buf, int64(info.offsets[c])); err != nil && err != io.EOF {
+			return nil, err
+		}
+		if info.compression != 1 {
+			zr, err := zlib.NewReader(bytes.NewReader(buf))
+			if err != nil {
+				return nil, fmt.Errorf("chunk %d: %w", c, err)
+			}
+			if buf, err = io.ReadAll(io.LimitReader(zr, int64(info.chunkBytes()))); err != nil {
+				return nil, fmt.Errorf("chunk %d: %w", c, err)
+			}
+		}
+
+		x0, y0 := (c%across)*info.chunkW, (c/across)*info.chunkH
+		for row := 0; row < info.chunkH && row*info.chunkW*bytesPer < len(buf); row++ {
+			var prev uint64
+			for col := 0; col < info.chunkW; col++ {
+				off := (row*info.chunkW + col) * bytesPer
+				if off+bytesPer > len(buf) {
+					break
+				}
+				var raw uint64
+				switch bytesPer {
+				case 1:
+					raw = uint64(buf[off])
+				case 2:
+					raw = uint64(info.order.Uint16(buf[off:]))
+				case 4:
+					raw = uint64(info.order.Uint32(buf[off:]))
+				case 8:
+					raw = info.order.Uint64(buf[off:])
+				}
+				if info.predictor == 2 {
+					raw = (raw + prev) & mask
+					prev = raw
+				}
+				x, y := x0+col, y0+row
+				if x >= g.cols || y >= g.rows {
+					continue
+				}
+				v := read(raw)
+				if math.IsNaN(v) || (info.hasNodata && v == info.nodata) {
+					continue
+				}
+				g.data[y*g.cols+x] = float32(v)
+			}
+		}
+	}
+	return &g, nil
+}
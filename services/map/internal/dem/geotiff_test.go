@@ -0,0 +1,226 @@
+package dem
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// tiffTag es una entrada del IFD para armar archivos de prueba.
+type tiffTag struct {
+	tag    uint16
+	typ    uint16 // 3 SHORT, 4 LONG, 12 DOUBLE
+	ints   []uint64
+	floats []float64
+}
+
+// buildTIFF arma un TIFF little-endian con una sola tira en data y los tags
+// dados; StripOffsets y StripByteCounts se agregan solos.
+func buildTIFF(data []byte, tags ...tiffTag) []byte {
+	le := binary.LittleEndian
+	tags = append(tags,
+		tiffTag{tag: tagStripOffsets, typ: 4, ints: []uint64{8}},
+		tiffTag{tag: tagStripByteCounts, typ: 4, ints: []uint64{uint64(len(data))}},
+	)
+
+	out := []byte("II*\x00\x00\x00\x00\x00")
+	out = append(out, data...)
+	ifd := len(out)
+	le.PutUint32(out[4:], uint32(ifd))
+	extra := ifd + 2 + 12*len(tags) + 4
+
+	var entries, values []byte
+	entries = le.AppendUint16(entries, uint16(len(tags)))
+	for _, t := range tags {
+		var v []byte
+		count := len(t.ints)
+		switch t.typ {
+		case 3:
+			for _, x := range t.ints {
+				v = le.AppendUint16(v, uint16(x))
+			}
+		case 4:
+			for _, x := range t.ints {
+				v = le.AppendUint32(v, uint32(x))
+			}
+		case 12:
+			count = len(t.floats)
+			for _, f := range t.floats {
+				v = le.AppendUint64(v, math.Float64bits(f))
+			}
+		}
+		entries = le.AppendUint16(entries, t.tag)
+		entries = le.AppendUint16(entries, t.typ)
+		entries = le.AppendUint32(entries, uint32(count))
+		if len(v) <= 4 {
+			entries = append(entries, append(v, make([]byte, 4-len(v))...)...)
+		} else {
+			entries = le.AppendUint32(entries, uint32(extra+len(values)))
+			values = append(values, v...)
+		}
+	}
+	entries = le.AppendUint32(entries, 0) // sin más IFDs
+	out = append(out, entries...)
+	return append(out, values...)
+}
+
+// geoTags son los tags de una malla de 0.5° con la esquina noroeste en
+// (-100, 20), por área.
+func geoTags(width, height, bits, format int) []tiffTag {
+	return []tiffTag{
+		{tag: tagImageWidth, typ: 3, ints: []uint64{uint64(width)}},
+		{tag: tagImageLength, typ: 3, ints: []uint64{uint64(height)}},
+		{tag: tagBitsPerSample, typ: 3, ints: []uint64{uint64(bits)}},
+		{tag: tagSampleFormat, typ: 3, ints: []uint64{uint64(format)}},
+		{tag: tagPixelScale, typ: 12, floats: []float64{0.5, 0.5, 0}},
+		{tag: tagTiepoint, typ: 12, floats: []float64{0, 0, 0, -100, 20, 0}},
+		{tag: tagGeoKeyDirectory, typ: 3, ints: []uint64{1, 1, 0, 1, geoKeyModelType, 0, 1, modelTypeGeographic}},
+	}
+}
+
+func int16Samples(vals ...int16) []byte {
+	var b []byte
+	for _, v := range vals {
+		b = binary.LittleEndian.AppendUint16(b, uint16(v))
+	}
+	return b
+}
+
+func decodeTIFF(t *testing.T, file []byte) *grid {
+	t.Helper()
+	info, err := readTIFFInfo(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("readTIFFInfo: %v", err)
+	}
+	g, err := info.decode(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return g
+}
+
+func TestReadTIFF(t *testing.T) {
+	file := buildTIFF(int16Samples(100, 200, -5, 400), geoTags(2, 2, 16, 2)...)
+	g := decodeTIFF(t, file)
+
+	// Por área: la muestra (0, 0) está en el centro del primer píxel.
+	if g.originLon != -99.75 || g.originLat != 19.75 || g.cols != 2 || g.rows != 2 {
+		t.Fatalf("grid = %+v", *g)
+	}
+	want := []float32{100, 200, -5, 400}
+	for i, v := range want {
+		if g.data[i] != v {
+			t.Errorf("data[%d] = %v, want %v", i, g.data[i], v)
+		}
+	}
+	if v, ok := g.sample(19.5, -99.5); !ok || v != 173.75 {
+		t.Errorf("sample(center) = %v, %v; want 173.75", v, ok)
+	}
+}
+
+func TestReadTIFFDeflatePredictorNoData(t *testing.T) {
+	// Predictor horizontal: cada muestra es la diferencia con la anterior de
+	// la fila. -9999 es el nodata de GDAL.
+	raw := int16Samples(10, 5, -9999, 0)
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(raw)
+	zw.Close()
+
+	tags := append(geoTags(2, 2, 16, 2),
+		tiffTag{tag: tagCompression, typ: 3, ints: []uint64{8}},
+		tiffTag{tag: tagPredictor, typ: 3, ints: []uint64{2}},
+	)
+	file := buildTIFF(z.Bytes(), tags...)
+	info, err := readTIFFInfo(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.nodata, info.hasNodata = -9999, true
+	g, err := info.decode(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.data[0] != 10 || g.data[1] != 15 {
+		t.Errorf("first row = %v, want [10 15]", g.data[:2])
+	}
+	if !math.IsNaN(float64(g.data[2])) || !math.IsNaN(float64(g.data[3])) {
+		t.Errorf("second row = %v, want nodata", g.data[2:])
+	}
+}
+
+func TestReadTIFFRejects(t *testing.T) {
+	valid := geoTags(2, 2, 16, 2)
+	with := func(extra ...tiffTag) []tiffTag {
+		return append(append([]tiffTag{}, valid...), extra...)
+	}
+	projected := with()
+	projected[6] = tiffTag{tag: tagGeoKeyDirectory, typ: 3, ints: []uint64{1, 1, 0, 1, geoKeyModelType, 0, 1, 1}}
+
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{"empty", nil},
+		{"not tiff", []byte("PK\x03\x04 not a tiff")},
+		{"bigtiff", []byte("II+\x00\x08\x00\x00\x00")},
+		{"truncated ifd", buildTIFF(int16Samples(1, 2, 3, 4), valid...)[:30]},
+		{"no georef", buildTIFF(int16Samples(1, 2, 3, 4), valid[:4]...)},
+		{"projected", buildTIFF(int16Samples(1, 2, 3, 4), projected...)},
+		{"two bands", buildTIFF(int16Samples(1, 2, 3, 4), with(tiffTag{tag: tagSamplesPerPixel, typ: 3, ints: []uint64{2}})...)},
+		{"bad bits", buildTIFF(int16Samples(1, 2, 3, 4), geoTags(2, 2, 12, 1)...)},
+		{"jpeg", buildTIFF(int16Samples(1, 2, 3, 4), with(tiffTag{tag: tagCompression, typ: 3, ints: []uint64{7}})...)},
+		{"too large", buildTIFF(int16Samples(1, 2, 3, 4), geoTags(65535, 65535, 16, 2)...)},
+		{"huge strip", buildTIFF(make([]byte, 4096), valid...)},
+		{"huge tiles", buildTIFF(int16Samples(1, 2, 3, 4), with(
+			tiffTag{tag: tagTileWidth, typ: 4, ints: []uint64{1 << 20}},
+			tiffTag{tag: tagTileLength, typ: 4, ints: []uint64{1 << 20}},
+		)...)},
+		{"zero scale", buildTIFF(int16Samples(1, 2, 3, 4), append(with()[:4],
+			tiffTag{tag: tagPixelScale, typ: 12, floats: []float64{0, 0.5, 0}},
+			valid[5], valid[6],
+		)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readTIFFInfo(bytes.NewReader(tt.file)); err == nil {
+				t.Error("readTIFFInfo accepted the file")
+			}
+		})
+	}
+}
+
+func TestReadTIFFUnsupportedIsWrapped(t *testing.T) {
+	_, err := readTIFFInfo(bytes.NewReader(buildTIFF(nil, geoTags(2, 2, 12, 1)...)))
+	if !errors.Is(err, errUnsupportedTIFF) {
+		t.Errorf("err = %v, want errUnsupportedTIFF", err)
+	}
+}
+
+// FuzzReadTIFF comprueba que ninguna cabecera, por rota que esté, haga
+// entrar en pánico al lector ni reservar más de lo permitido.
+func FuzzReadTIFF(f *testing.F) {
+	f.Add(buildTIFF(int16Samples(100, 200, -5, 400), geoTags(2, 2, 16, 2)...))
+	f.Add(buildTIFF([]byte{1, 2, 3, 4, 5, 6, 7, 8}, geoTags(2, 1, 32, 3)...))
+	f.Add([]byte("MM\x00*\x00\x00\x00\x08"))
+	f.Fuzz(func(t *testing.T, file []byte) {
+		info, err := readTIFFInfo(bytes.NewReader(file))
+		if err != nil {
+			return
+		}
+		if info.width*info.height > maxTIFFPixels {
+			t.Fatalf("accepted %dx%d", info.width, info.height)
+		}
+		g, err := info.decode(bytes.NewReader(file))
+		if err != nil {
+			return
+		}
+		if len(g.data) != g.cols*g.rows {
+			t.Fatalf("len(data) = %d for %dx%d", len(g.data), g.cols, g.rows)
+		}
+		g.sample(g.originLat, g.originLon)
+	})
+}
@@ -0,0 +1,72 @@
+package dem
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Valor de las muestras vacías en SRTM.
+const hgtVoid = -32768
+
+var hgtName = regexp.MustCompile(`^([NS])(\d{2})([EW])(\d{3})$`)
+
+// hgtSource indexa un .hgt de SRTM. El nombre (p. ej. N19W100) es la esquina
+// suroeste; el tamaño del archivo da la resolución (1201 o 3601 por lado).
+func hgtSource(path string) (*source, error) {
+	name := strings.ToUpper(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	m := hgtName.FindStringSubmatch(name)
+	if m == nil {
+		return nil, fmt.Errorf("name must look like N19W100.hgt")
+	}
+	lat, _ := strconv.Atoi(m[2])
+	lon, _ := strconv.Atoi(m[4])
+	if m[1] == "S" {
+		lat = -lat
+	}
+	if m[3] == "W" {
+		lon = -lon
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	side := int(math.Round(math.Sqrt(float64(info.Size() / 2))))
+	if side < 2 || int64(side*side*2) != info.Size() {
+		return nil, fmt.Errorf("size %d is not a square grid of int16", info.Size())
+	}
+
+	g := grid{
+		originLon: float64(lon),
+		originLat: float64(lat + 1),
+		dLon:      1 / float64(side-1),
+		dLat:      1 / float64(side-1),
+		cols:      side,
+		rows:      side,
+	}
+	src := &source{path: path, bounds: g.bounds()}
+	src.load = func() (*grid, error) {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		out := g
+		out.data = make([]float32, side*side)
+		for i := range out.data {
+			v := int16(binary.BigEndian.Uint16(raw[2*i:]))
+			if v == hgtVoid {
+				out.data[i] = float32(math.NaN())
+			} else {
+				out.data[i] = float32(v)
+			}
+		}
+		return &out, nil
+	}
+	return src, nil
+}
@@ -0,0 +1,139 @@
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const earthRadiusM = 6371008.8
+
+// Desnivel mínimo entre puntos para contarlo como subida o bajada; filtra el
+// ruido de los perfiles generados con GPS.
+const elevationThresholdM = 3.0
+
+// ErrNoLine indica que el GeoJSON no contiene ninguna LineString.
+var ErrNoLine = errors.New("geojson contains no LineString or MultiLineString")
+
+// Point es una coordenada GeoJSON (lon, lat y altura opcional).
+type Point struct {
+	Lon    float64
+	Lat    float64
+	Ele    float64
+	HasEle bool
+}
+
+type geoObject struct {
+	Type        string          `json:"type"`
+	Geometry    *geoObject      `json:"geometry"`
+	Features    []geoObject     `json:"features"`
+	Geometries  []geoObject     `json:"geometries"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// ParseLines devuelve todas las líneas de un Feature, FeatureCollection o
+// geometría suelta. Cada LineString o parte de una MultiLineString es una
+// línea aparte.
+func ParseLines(geoJSON string) ([][]Point, error) {
+	var obj geoObject
+	if err := json.Unmarshal([]byte(geoJSON), &obj); err != nil {
+		return nil, fmt.Errorf("invalid geojson: %w", err)
+	}
+	var lines [][]Point
+	if err := collectLines(obj, &lines); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, ErrNoLine
+	}
+	return lines, nil
+}
+
+func collectLines(obj geoObject, out *[][]Point) error {
+	switch obj.Type {
+	case "Feature":
+		if obj.Geometry != nil {
+			return collectLines(*obj.Geometry, out)
+		}
+	case "FeatureCollection":
+		for _, f := range obj.Features {
+			if err := collectLines(f, out); err != nil {
+				return err
+			}
+		}
+	case "GeometryCollection":
+		for _, g := range obj.Geometries {
+			if err := collectLines(g, out); err != nil {
+				return err
+			}
+		}
+	case "LineString":
+		var coords [][]float64
+		if err := json.Unmarshal(obj.Coordinates, &coords); err != nil {
+			return fmt.Errorf("invalid LineString coordinates: %w", err)
+		}
+		if line := toPoints(coords); len(line) >= 2 {
+			*out = append(*out, line)
+		}
+	case "MultiLineString":
+		var parts [][][]float64
+		if err := json.Unmarshal(obj.Coordinates, &parts); err != nil {
+			return fmt.Errorf("invalid MultiLineString coordinates: %w", err)
+		}
+		for _, coords := range parts {
+			if line := toPoints(coords); len(line) >= 2 {
+				*out = append(*out, line)
+			}
+		}
+	}
+	return nil
+}
+
+func toPoints(coords [][]float64) []Point {
+	pts := make([]Point, 0, len(coords))
+	for _, c := range coords {
+		if len(c) < 2 {
+			continue
+		}
+		p := Point{Lon: c[0], Lat: c[1]}
+		if len(c) > 2 {
+			p.Ele, p.HasEle = c[2], true
+		}
+		pts = append(pts, p)
+	}
+	return pts
+}
+
+// Haversine devuelve la distancia en metros entre dos puntos.
+func Haversine(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusM * math.Asin(math.Sqrt(h))
+}
+
+// FeatureName devuelve el nombre del primer Feature que traiga una propiedad
+// name, label o title; "" si no hay ninguno.
+func FeatureName(geoJSON string) string {
+	var obj struct {
+		Type       string            `json:"type"`
+		Properties map[string]any    `json:"properties"`
+		Features   []json.RawMessage `json:"features"`
+	}
+	if err := json.Unmarshal([]byte(geoJSON), &obj); err != nil {
+		return ""
+	}
+	for _, key := range []string{"name", "label", "title"} {
+		if v, ok := obj.Properties[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	for _, f := range obj.Features {
+		if name := FeatureName(string(f)); name != "" {
+			return name
+		}
+	}
+	return ""
+}
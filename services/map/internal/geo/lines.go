@@ -0,0 +1,118 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MapLines aplica fn a cada LineString (y a cada parte de una
+// MultiLineString) del GeoJSON y lo vuelve a serializar. fn debe devolver la
+// misma cantidad de puntos; la altura se escribe solo si HasEle.
+func MapLines(geoJSON string, fn func([]Point) []Point) (string, error) {
+	return RewriteLines(geoJSON, func(line []Point) ([][]Point, error) {
+		mapped := fn(line)
+		if len(mapped) != len(line) {
+			return nil, fmt.Errorf("line mapper changed the number of points")
+		}
+		return [][]Point{mapped}, nil
+	})
+}
+
+// RewriteLines reemplaza cada línea por las partes que devuelve fn. Una
+// LineString que queda partida pasa a ser MultiLineString; si no queda
+// ninguna parte, la geometría queda como MultiLineString vacía.
+func RewriteLines(geoJSON string, fn func([]Point) ([][]Point, error)) (string, error) {
+	var obj interface{}
+	if err := json.Unmarshal([]byte(geoJSON), &obj); err != nil {
+		return "", fmt.Errorf("invalid geojson: %w", err)
+	}
+	if err := rewriteLines(obj, fn); err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func rewriteLines(v interface{}, fn func([]Point) ([][]Point, error)) error {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	switch obj["type"] {
+	case "FeatureCollection":
+		features, _ := obj["features"].([]interface{})
+		for _, f := range features {
+			if err := rewriteLines(f, fn); err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		return rewriteLines(obj["geometry"], fn)
+	case "GeometryCollection":
+		geometries, _ := obj["geometries"].([]interface{})
+		for _, g := range geometries {
+			if err := rewriteLines(g, fn); err != nil {
+				return err
+			}
+		}
+	case "LineString":
+		parts, err := rewriteLine(obj["coordinates"], fn)
+		if err != nil {
+			return err
+		}
+		if len(parts) == 1 {
+			obj["coordinates"] = parts[0]
+		} else {
+			obj["type"], obj["coordinates"] = "MultiLineString", parts
+		}
+	case "MultiLineString":
+		in, _ := obj["coordinates"].([]interface{})
+		out := [][][]float64{}
+		for _, line := range in {
+			parts, err := rewriteLine(line, fn)
+			if err != nil {
+				return err
+			}
+			out = append(out, parts...)
+		}
+		obj["coordinates"] = out
+	}
+	return nil
+}
+
+func rewriteLine(v interface{}, fn func([]Point) ([][]Point, error)) ([][][]float64, error) {
+	raw, _ := json.Marshal(v)
+	var coords [][]float64
+	if err := json.Unmarshal(raw, &coords); err != nil {
+		return nil, fmt.Errorf("invalid line coordinates: %w", err)
+	}
+	pts := make([]Point, len(coords))
+	for i, c := range coords {
+		if len(c) < 2 {
+			return nil, fmt.Errorf("invalid position %v", c)
+		}
+		pts[i] = Point{Lon: c[0], Lat: c[1]}
+		if len(c) > 2 {
+			pts[i].Ele, pts[i].HasEle = c[2], true
+		}
+	}
+	parts, err := fn(pts)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][][]float64, 0, len(parts))
+	for _, part := range parts {
+		coords := make([][]float64, len(part))
+		for i, p := range part {
+			coords[i] = []float64{p.Lon, p.Lat}
+			if p.HasEle {
+				coords[i] = append(coords[i], round(p.Ele, 1))
+			}
+		}
+		out = append(out, coords)
+	}
+	return out, nil
+}
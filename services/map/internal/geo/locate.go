@@ -0,0 +1,44 @@
+package geo
+
+import "math"
+
+const metersPerDegree = 111320.0
+
+// Locate devuelve la distancia en metros de p a la línea más cercana y a
+// cuántos metros del inicio de esa línea (sumando las anteriores) queda la
+// proyección. Usa un plano local alrededor de p, válido para distancias
+// cortas.
+func Locate(p Point, lines [][]Point) (distM, alongM float64) {
+	cosLat := math.Cos(p.Lat * math.Pi / 180)
+	toXY := func(q Point) (float64, float64) {
+		return (q.Lon - p.Lon) * cosLat * metersPerDegree, (q.Lat - p.Lat) * metersPerDegree
+	}
+
+	distM = math.Inf(1)
+	offset := 0.0
+	for _, line := range lines {
+		walked := offset
+		for i := 0; i+1 < len(line); i++ {
+			seg := Haversine(line[i], line[i+1])
+			ax, ay := toXY(line[i])
+			bx, by := toXY(line[i+1])
+			t := 0.0
+			if dx, dy := bx-ax, by-ay; dx != 0 || dy != 0 {
+				t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/(dx*dx+dy*dy)))
+			}
+			if d := math.Hypot(ax+t*(bx-ax), ay+t*(by-ay)); d < distM {
+				distM, alongM = d, walked+t*seg
+			}
+			walked += seg
+		}
+		offset = walked
+	}
+	return distM, alongM
+}
+
+// Expand agranda la caja m metros hacia cada lado.
+func (b BBox) Expand(m float64) BBox {
+	dLat := m / metersPerDegree
+	dLon := m / (metersPerDegree * math.Max(math.Cos((b.MinLat+b.MaxLat)/2*math.Pi/180), 0.01))
+	return BBox{MinLon: b.MinLon - dLon, MinLat: b.MinLat - dLat, MaxLon: b.MaxLon + dLon, MaxLat: b.MaxLat + dLat}
+}
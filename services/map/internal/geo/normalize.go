@@ -0,0 +1,333 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// ValidationError señala el campo exacto que no cumple RFC 7946, p. ej.
+// "features[0].geometry.coordinates[3][1]".
+type ValidationError struct {
+	Field string
+	Msg   string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Msg
+	}
+	return e.Field + ": " + e.Msg
+}
+
+func invalid(field, format string, args ...interface{}) error {
+	return &ValidationError{Field: field, Msg: fmt.Sprintf(format, args...)}
+}
+
+type feature struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id,omitempty"`
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   *geometry              `json:"geometry"`
+}
+
+type geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates,omitempty"`
+	Geometries  []*geometry `json:"geometries,omitempty"`
+}
+
+type featureCollection struct {
+	Type     string     `json:"type"`
+	Features []*feature `json:"features"`
+}
+
+// Normalize valida el GeoJSON (Feature, FeatureCollection o geometría suelta)
+// y lo devuelve como FeatureCollection canónica: coordenadas redondeadas a 6
+// decimales, sin puntos repetidos consecutivos y sin miembros ajenos (crs,
+// bbox). Debe contener al menos una LineString o MultiLineString.
+func Normalize(geoJSON string) (string, error) {
+	if len(bytes.TrimSpace([]byte(geoJSON))) == 0 {
+		return "", invalid("", "is empty")
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(geoJSON), &raw); err != nil {
+		return "", invalid("", "is not a JSON object: %v", err)
+	}
+
+	var (
+		fc  = featureCollection{Type: "FeatureCollection", Features: []*feature{}}
+		err error
+	)
+	switch typ := rawType(raw); typ {
+	case "FeatureCollection":
+		var items []map[string]json.RawMessage
+		if err := json.Unmarshal(raw["features"], &items); err != nil || raw["features"] == nil {
+			return "", invalid("features", "must be an array of features")
+		}
+		for i, item := range items {
+			f, err := parseFeature(fmt.Sprintf("features[%d]", i), item)
+			if err != nil {
+				return "", err
+			}
+			fc.Features = append(fc.Features, f)
+		}
+	case "Feature":
+		f, err := parseFeature("", raw)
+		if err != nil {
+			return "", err
+		}
+		fc.Features = append(fc.Features, f)
+	case "":
+		return "", invalid("type", "is required")
+	default:
+		g, err := parseGeometry("", raw)
+		if err != nil {
+			return "", err
+		}
+		fc.Features = append(fc.Features, &feature{Type: "Feature", Properties: map[string]interface{}{}, Geometry: g})
+	}
+
+	if !hasLine(fc) {
+		return "", invalid("geometry", "a route needs at least one LineString or MultiLineString")
+	}
+	out, err := json.Marshal(fc)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func rawType(raw map[string]json.RawMessage) string {
+	var t string
+	_ = json.Unmarshal(raw["type"], &t)
+	return t
+}
+
+func join(prefix, field string) string {
+	if prefix == "" {
+		return field
+	}
+	return prefix + "." + field
+}
+
+func parseFeature(path string, raw map[string]json.RawMessage) (*feature, error) {
+	if t := rawType(raw); t != "Feature" {
+		return nil, invalid(join(path, "type"), "must be \"Feature\", got %q", t)
+	}
+	f := &feature{Type: "Feature", Properties: map[string]interface{}{}}
+
+	if id, ok := raw["id"]; ok {
+		if err := json.Unmarshal(id, &f.ID); err != nil {
+			return nil, invalid(join(path, "id"), "must be a string or number")
+		}
+		switch f.ID.(type) {
+		case string, float64, nil:
+		default:
+			return nil, invalid(join(path, "id"), "must be a string or number")
+		}
+	}
+	if props, ok := raw["properties"]; ok && string(props) != "null" {
+		if err := json.Unmarshal(props, &f.Properties); err != nil {
+			return nil, invalid(join(path, "properties"), "must be an object or null")
+		}
+	}
+
+	g, ok := raw["geometry"]
+	if !ok {
+		return nil, invalid(join(path, "geometry"), "is required (may be null)")
+	}
+	if string(g) == "null" {
+		return f, nil
+	}
+	var graw map[string]json.RawMessage
+	if err := json.Unmarshal(g, &graw); err != nil {
+		return nil, invalid(join(path, "geometry"), "must be an object or null")
+	}
+	geom, err := parseGeometry(join(path, "geometry"), graw)
+	if err != nil {
+		return nil, err
+	}
+	f.Geometry = geom
+	return f, nil
+}
+
+func parseGeometry(path string, raw map[string]json.RawMessage) (*geometry, error) {
+	typ := rawType(raw)
+	g := &geometry{Type: typ}
+	coordsField := join(path, "coordinates")
+
+	if typ == "GeometryCollection" {
+		var items []map[string]json.RawMessage
+		if err := json.Unmarshal(raw["geometries"], &items); err != nil || raw["geometries"] == nil {
+			return nil, invalid(join(path, "geometries"), "must be an array of geometries")
+		}
+		for i, item := range items {
+			child, err := parseGeometry(fmt.Sprintf("%s[%d]", join(path, "geometries"), i), item)
+			if err != nil {
+				return nil, err
+			}
+			g.Geometries = append(g.Geometries, child)
+		}
+		return g, nil
+	}
+
+	switch typ {
+	case "Point", "MultiPoint", "LineString", "MultiLineString", "Polygon", "MultiPolygon":
+	case "":
+		return nil, invalid(join(path, "type"), "is required")
+	default:
+		return nil, invalid(join(path, "type"), "unknown geometry type %q", typ)
+	}
+	c, ok := raw["coordinates"]
+	if !ok {
+		return nil, invalid(coordsField, "is required")
+	}
+
+	var err error
+	switch typ {
+	case "Point":
+		var pos []float64
+		if err := json.Unmarshal(c, &pos); err != nil {
+			return nil, invalid(coordsField, "must be a position [lon, lat]")
+		}
+		g.Coordinates, err = position(coordsField, pos)
+	case "MultiPoint":
+		var pts [][]float64
+		if err := json.Unmarshal(c, &pts); err != nil {
+			return nil, invalid(coordsField, "must be an array of positions")
+		}
+		g.Coordinates, err = positions(coordsField, pts, 0, false)
+	case "LineString":
+		var pts [][]float64
+		if err := json.Unmarshal(c, &pts); err != nil {
+			return nil, invalid(coordsField, "must be an array of positions")
+		}
+		g.Coordinates, err = positions(coordsField, pts, 2, true)
+	case "MultiLineString", "Polygon":
+		var parts [][][]float64
+		if err := json.Unmarshal(c, &parts); err != nil {
+			return nil, invalid(coordsField, "must be an array of position arrays")
+		}
+		min := 2
+		if typ == "Polygon" {
+			min = 4
+		}
+		out := make([][][]float64, 0, len(parts))
+		for i, part := range parts {
+			field := fmt.Sprintf("%s[%d]", coordsField, i)
+			p, err := positions(field, part, min, typ == "MultiLineString")
+			if err != nil {
+				return nil, err
+			}
+			if typ == "Polygon" && !samePosition(p[0], p[len(p)-1]) {
+				return nil, invalid(field, "linear ring must be closed")
+			}
+			out = append(out, p)
+		}
+		g.Coordinates = out
+	case "MultiPolygon":
+		var polys [][][][]float64
+		if err := json.Unmarshal(c, &polys); err != nil {
+			return nil, invalid(coordsField, "must be an array of polygons")
+		}
+		out := make([][][][]float64, 0, len(polys))
+		for i, poly := range polys {
+			rings := make([][][]float64, 0, len(poly))
+			for j, ring := range poly {
+				field := fmt.Sprintf("%s[%d][%d]", coordsField, i, j)
+				p, err := positions(field, ring, 4, false)
+				if err != nil {
+					return nil, err
+				}
+				if !samePosition(p[0], p[len(p)-1]) {
+					return nil, invalid(field, "linear ring must be closed")
+				}
+				rings = append(rings, p)
+			}
+			out = append(out, rings)
+		}
+		g.Coordinates = out
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// positions valida y redondea una lista de posiciones. Con dedupe se quitan
+// los puntos repetidos consecutivos antes de contar el mínimo.
+func positions(field string, pts [][]float64, min int, dedupe bool) ([][]float64, error) {
+	out := make([][]float64, 0, len(pts))
+	for i, pt := range pts {
+		p, err := position(fmt.Sprintf("%s[%d]", field, i), pt)
+		if err != nil {
+			return nil, err
+		}
+		if dedupe && len(out) > 0 && samePosition(out[len(out)-1], p) {
+			continue
+		}
+		out = append(out, p)
+	}
+	if len(out) < min {
+		return nil, invalid(field, "needs at least %d distinct positions, got %d", min, len(out))
+	}
+	return out, nil
+}
+
+func position(field string, pt []float64) ([]float64, error) {
+	if len(pt) < 2 {
+		return nil, invalid(field, "position needs at least [lon, lat]")
+	}
+	for _, v := range pt {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, invalid(field, "position must contain finite numbers")
+		}
+	}
+	lon, lat := pt[0], pt[1]
+	if lon < -180 || lon > 180 {
+		return nil, invalid(field+"[0]", "longitude %g out of range [-180, 180]", lon)
+	}
+	if lat < -90 || lat > 90 {
+		return nil, invalid(field+"[1]", "latitude %g out of range [-90, 90]", lat)
+	}
+	out := []float64{round(lon, 6), round(lat, 6)}
+	if len(pt) > 2 {
+		out = append(out, round(pt[2], 1))
+	}
+	return out, nil
+}
+
+func samePosition(a, b []float64) bool {
+	return len(a) >= 2 && len(b) >= 2 && a[0] == b[0] && a[1] == b[1]
+}
+
+func hasLine(fc featureCollection) bool {
+	var check func(g *geometry) bool
+	check = func(g *geometry) bool {
+		if g == nil {
+			return false
+		}
+		if g.Type == "LineString" || g.Type == "MultiLineString" {
+			return true
+		}
+		for _, child := range g.Geometries {
+			if check(child) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, f := range fc.Features {
+		if check(f.Geometry) {
+			return true
+		}
+	}
+	return false
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,77 @@
+package geo
+
+// Circle es una zona circular, p. ej. una zona de privacidad.
+type Circle struct {
+	Center  Point
+	RadiusM float64
+}
+
+// HideInCircles quita del GeoJSON todos los tramos que pasan por alguna de
+// las zonas. No se recorta en el borde del círculo: eso permitiría
+// reconstruir el centro juntando varios tracks.
+func HideInCircles(geoJSON string, zones []Circle) (string, error) {
+	if len(zones) == 0 {
+		return geoJSON, nil
+	}
+	return RewriteLines(geoJSON, func(line []Point) ([][]Point, error) {
+		return splitOutside(line, zones), nil
+	})
+}
+
+// HideLines es HideInCircles para líneas ya parseadas.
+func HideLines(lines [][]Point, zones []Circle) [][]Point {
+	if len(zones) == 0 {
+		return lines
+	}
+	var out [][]Point
+	for _, l := range lines {
+		out = append(out, splitOutside(l, zones)...)
+	}
+	return out
+}
+
+// splitOutside devuelve las partes de la línea que quedan fuera de las zonas.
+// Un tramo entre dos puntos de fuera que cruza una zona también corta la
+// línea.
+func splitOutside(line []Point, zones []Circle) [][]Point {
+	var (
+		parts   [][]Point
+		current []Point
+	)
+	flush := func() {
+		if len(current) >= 2 {
+			parts = append(parts, current)
+		}
+		current = nil
+	}
+	for _, p := range line {
+		if inAny(p, zones) {
+			flush()
+			continue
+		}
+		if len(current) > 0 && crossesAny(current[len(current)-1], p, zones) {
+			flush()
+		}
+		current = append(current, p)
+	}
+	flush()
+	return parts
+}
+
+func inAny(p Point, zones []Circle) bool {
+	for _, z := range zones {
+		if Haversine(p, z.Center) <= z.RadiusM {
+			return true
+		}
+	}
+	return false
+}
+
+func crossesAny(a, b Point, zones []Circle) bool {
+	for _, z := range zones {
+		if d, _ := Locate(z.Center, [][]Point{{a, b}}); d <= z.RadiusM {
+			return true
+		}
+	}
+	return false
+}
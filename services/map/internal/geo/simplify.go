@@ -0,0 +1,197 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// metersPerPixelZ0 es la resolución de Web Mercator en el ecuador a zoom 0
+// con teselas de 256 px.
+const metersPerPixelZ0 = 156543.03392
+
+// ZoomBand agrupa niveles de zoom que comparten la misma geometría
+// simplificada. Desde MaxZoom+1 del último se usa la geometría completa.
+type ZoomBand struct {
+	MaxZoom int
+}
+
+// ZoomBands son las variantes que se precalculan al guardar una ruta.
+var ZoomBands = []ZoomBand{{MaxZoom: 8}, {MaxZoom: 11}, {MaxZoom: 14}}
+
+// ToleranceForZoom devuelve la tolerancia en metros equivalente a un píxel a
+// ese zoom y latitud.
+func ToleranceForZoom(zoom int, lat float64) float64 {
+	return metersPerPixelZ0 * math.Cos(lat*math.Pi/180) / math.Pow(2, float64(zoom))
+}
+
+// Simplify aplica Douglas-Peucker con la tolerancia en metros. Conserva
+// siempre el primer y el último punto.
+func Simplify(points []Point, toleranceM float64) []Point {
+	if len(points) <= 2 || toleranceM <= 0 {
+		return points
+	}
+
+	// Proyección equirectangular local: basta para medir desvíos de pocos
+	// metros dentro de una ruta.
+	var latSum float64
+	for _, p := range points {
+		latSum += p.Lat
+	}
+	cosLat := math.Cos(latSum / float64(len(points)) * math.Pi / 180)
+	xy := make([][2]float64, len(points))
+	for i, p := range points {
+		xy[i] = [2]float64{
+			(p.Lon - points[0].Lon) * cosLat * earthRadiusM * math.Pi / 180,
+			(p.Lat - points[0].Lat) * earthRadiusM * math.Pi / 180,
+		}
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		seg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first, last := seg[0], seg[1]
+		maxDist, index := 0.0, -1
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(xy[i], xy[first], xy[last]); d > maxDist {
+				maxDist, index = d, i
+			}
+		}
+		if index >= 0 && maxDist > toleranceM {
+			keep[index] = true
+			stack = append(stack, [2]int{first, index}, [2]int{index, last})
+		}
+	}
+
+	out := make([]Point, 0, len(points))
+	for i, p := range points {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func segmentDistance(p, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+	t := math.Max(0, math.Min(1, ((p[0]-a[0])*dx+(p[1]-a[1])*dy)/(dx*dx+dy*dy)))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
+
+// SimplifyGeoJSON simplifica cada LineString y MultiLineString del GeoJSON
+// y deja intactos el resto de geometrías y las properties.
+func SimplifyGeoJSON(geoJSON string, toleranceM float64) (string, error) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(geoJSON), &doc); err != nil {
+		return "", fmt.Errorf("invalid geojson: %w", err)
+	}
+	simplifyNode(doc, toleranceM)
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func simplifyNode(node interface{}, toleranceM float64) {
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return
+	}
+	switch obj["type"] {
+	case "FeatureCollection":
+		if features, ok := obj["features"].([]interface{}); ok {
+			for _, f := range features {
+				simplifyNode(f, toleranceM)
+			}
+		}
+	case "Feature":
+		simplifyNode(obj["geometry"], toleranceM)
+	case "GeometryCollection":
+		if geoms, ok := obj["geometries"].([]interface{}); ok {
+			for _, g := range geoms {
+				simplifyNode(g, toleranceM)
+			}
+		}
+	case "LineString":
+		obj["coordinates"] = simplifyCoords(obj["coordinates"], toleranceM)
+	case "MultiLineString":
+		if parts, ok := obj["coordinates"].([]interface{}); ok {
+			for i, part := range parts {
+				parts[i] = simplifyCoords(part, toleranceM)
+			}
+		}
+	}
+}
+
+func simplifyCoords(raw interface{}, toleranceM float64) interface{} {
+	list, ok := raw.([]interface{})
+	if !ok {
+		return raw
+	}
+	coords := make([][]float64, 0, len(list))
+	for _, item := range list {
+		pos, ok := item.([]interface{})
+		if !ok {
+			return raw
+		}
+		c := make([]float64, 0, len(pos))
+		for _, v := range pos {
+			f, ok := v.(float64)
+			if !ok {
+				return raw
+			}
+			c = append(c, f)
+		}
+		coords = append(coords, c)
+	}
+	points := toPoints(coords)
+	if len(points) != len(coords) {
+		return raw
+	}
+
+	simplified := Simplify(points, toleranceM)
+	out := make([][]float64, 0, len(simplified))
+	for _, p := range simplified {
+		if p.HasEle {
+			out = append(out, []float64{p.Lon, p.Lat, p.Ele})
+		} else {
+			out = append(out, []float64{p.Lon, p.Lat})
+		}
+	}
+	return out
+}
+
+// EncodePolyline codifica la línea con el algoritmo de polilíneas de Google
+// (precisión 1e5, solo lat/lon).
+func EncodePolyline(points []Point) string {
+	var sb strings.Builder
+	var prevLat, prevLon int64
+	for _, p := range points {
+		lat := int64(math.Round(p.Lat * 1e5))
+		lon := int64(math.Round(p.Lon * 1e5))
+		encodeValue(&sb, lat-prevLat)
+		encodeValue(&sb, lon-prevLon)
+		prevLat, prevLon = lat, lon
+	}
+	return sb.String()
+}
+
+func encodeValue(sb *strings.Builder, v int64) {
+	u := uint64(v << 1)
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		sb.WriteByte(byte((0x20 | (u & 0x1f)) + 63))
+		u >>= 5
+	}
+	sb.WriteByte(byte(u + 63))
+}
@@ -0,0 +1,57 @@
+package geo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	// ~0.0001° de latitud son ~11 m.
+	line := []Point{{Lon: 0, Lat: 0}, {Lon: 0.001, Lat: 0}, {Lon: 0.002, Lat: 0.0001}, {Lon: 0.003, Lat: 0}, {Lon: 0.004, Lat: 0}}
+
+	tests := []struct {
+		name      string
+		points    []Point
+		tolerance float64
+		want      []Point
+	}{
+		{"two points", line[:2], 100, line[:2]},
+		{"zero tolerance", line, 0, line},
+		{"collinear", []Point{{Lon: 0, Lat: 0}, {Lon: 1, Lat: 1}, {Lon: 2, Lat: 2}}, 1, []Point{{Lon: 0, Lat: 0}, {Lon: 2, Lat: 2}}},
+		{"spike above tolerance", line, 8, []Point{line[0], line[2], line[4]}},
+		{"spike below tolerance", line, 20, []Point{line[0], line[4]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Simplify(tt.points, tt.tolerance); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Simplify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimplifyGeoJSON(t *testing.T) {
+	in := `{"type":"Feature","properties":{"name":"x"},"geometry":{"type":"LineString","coordinates":[[0,0,10],[0.5,0.5,11],[1,1,12]]}}`
+	want := `{"geometry":{"coordinates":[[0,0,10],[1,1,12]],"type":"LineString"},"properties":{"name":"x"},"type":"Feature"}`
+	got, err := SimplifyGeoJSON(in, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("SimplifyGeoJSON() = %s, want %s", got, want)
+	}
+	if _, err := SimplifyGeoJSON("{", 1); err == nil {
+		t.Error("SimplifyGeoJSON() accepted invalid JSON")
+	}
+}
+
+func TestEncodePolyline(t *testing.T) {
+	// Ejemplo de la documentación del formato.
+	points := []Point{{Lat: 38.5, Lon: -120.2}, {Lat: 40.7, Lon: -120.95}, {Lat: 43.252, Lon: -126.453}}
+	if got, want := EncodePolyline(points), "_p~iF~ps|U_ulLnnqC_mqNvxq`@"; got != want {
+		t.Errorf("EncodePolyline() = %q, want %q", got, want)
+	}
+	if got := EncodePolyline(nil); got != "" {
+		t.Errorf("EncodePolyline(nil) = %q, want empty", got)
+	}
+}
@@ -0,0 +1,122 @@
+package geo
+
+import "math"
+
+// DefaultProfileSamples es la cantidad de muestras del perfil de altura.
+const DefaultProfileSamples = 200
+
+// BBox es la caja que contiene la geometría.
+type BBox struct {
+	MinLon float64
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+}
+
+// ProfileSample es la altura a cierta distancia desde el inicio.
+type ProfileSample struct {
+	DistanceM  float64 `json:"d"`
+	ElevationM float64 `json:"e"`
+}
+
+// Stats son las métricas de una ruta calculadas a partir de su geometría.
+type Stats struct {
+	DistanceM      float64
+	ElevationGainM float64
+	ElevationLossM float64
+	MinElevationM  float64
+	MaxElevationM  float64
+	HasElevation   bool
+	BBox           BBox
+	Start          Point
+	End            Point
+	Profile        []ProfileSample
+}
+
+// ComputeStats recorre las líneas en orden. La distancia entre el final de
+// una línea y el inicio de la siguiente no se cuenta.
+func ComputeStats(lines [][]Point, samples int) Stats {
+	var s Stats
+	if len(lines) == 0 {
+		return s
+	}
+	if samples < 2 {
+		samples = DefaultProfileSamples
+	}
+
+	first := lines[0][0]
+	last := lines[len(lines)-1]
+	s.Start, s.End = first, last[len(last)-1]
+	s.BBox = BBox{MinLon: first.Lon, MinLat: first.Lat, MaxLon: first.Lon, MaxLat: first.Lat}
+
+	// La altura solo cuenta si todos los puntos la traen.
+	s.HasElevation = true
+	for _, line := range lines {
+		for _, p := range line {
+			s.HasElevation = s.HasElevation && p.HasEle
+		}
+	}
+	if s.HasElevation {
+		s.MinElevationM, s.MaxElevationM = first.Ele, first.Ele
+	}
+
+	// Distancia acumulada de cada punto, para el perfil.
+	var cum []ProfileSample
+	for _, line := range lines {
+		ref := line[0].Ele
+		for i, p := range line {
+			s.BBox.MinLon = math.Min(s.BBox.MinLon, p.Lon)
+			s.BBox.MinLat = math.Min(s.BBox.MinLat, p.Lat)
+			s.BBox.MaxLon = math.Max(s.BBox.MaxLon, p.Lon)
+			s.BBox.MaxLat = math.Max(s.BBox.MaxLat, p.Lat)
+			if i > 0 {
+				s.DistanceM += Haversine(line[i-1], p)
+			}
+			if !s.HasElevation {
+				continue
+			}
+			s.MinElevationM = math.Min(s.MinElevationM, p.Ele)
+			s.MaxElevationM = math.Max(s.MaxElevationM, p.Ele)
+			if diff := p.Ele - ref; math.Abs(diff) >= elevationThresholdM {
+				if diff > 0 {
+					s.ElevationGainM += diff
+				} else {
+					s.ElevationLossM -= diff
+				}
+				ref = p.Ele
+			}
+			cum = append(cum, ProfileSample{DistanceM: s.DistanceM, ElevationM: p.Ele})
+		}
+	}
+	if s.HasElevation {
+		s.Profile = resample(cum, samples)
+	}
+	return s
+}
+
+// resample toma n muestras a distancias equidistantes interpolando la altura
+// entre los puntos originales.
+func resample(cum []ProfileSample, n int) []ProfileSample {
+	if len(cum) <= n {
+		return cum
+	}
+	total := cum[len(cum)-1].DistanceM
+	out := make([]ProfileSample, 0, n)
+	j := 0
+	for i := 0; i < n; i++ {
+		d := total * float64(i) / float64(n-1)
+		for j < len(cum)-2 && cum[j+1].DistanceM < d {
+			j++
+		}
+		a, b := cum[j], cum[j+1]
+		e := a.ElevationM
+		if span := b.DistanceM - a.DistanceM; span > 0 {
+			e += (b.ElevationM - a.ElevationM) * (d - a.DistanceM) / span
+		}
+		out = append(out, ProfileSample{
+			DistanceM:  math.Round(d*10) / 10,
+			ElevationM: math.Round(e*10) / 10,
+		})
+	}
+	return out
+}
@@ -2,12 +2,21 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	pb "trailbox/gen/maps"
 	mapctrl "trailbox/services/map/internal/controller"
+	"trailbox/services/map/internal/geo"
+	"trailbox/services/map/internal/model"
+	"trailbox/services/map/internal/preview"
+	"trailbox/services/map/internal/repository"
+	"trailbox/services/map/internal/spatial"
+	"trailbox/services/map/internal/trailgraph"
 )
 
 type Handler struct {
@@ -20,20 +29,425 @@ func New(ctrl *mapctrl.Controller) *Handler {
 }
 
 func (h *Handler) GetRoute(ctx context.Context, req *pb.GetRouteRequest) (*pb.GetRouteResponse, error) {
-	m, err := h.ctrl.GetRouteMap(req.RouteId)
+	polyline := req.Format == pb.GeometryFormat_GEOMETRY_FORMAT_POLYLINE
+	g, err := h.ctrl.GetRouteGeometry(req.RouteId, mapctrl.GeometryQuery{
+		ToleranceM: req.ToleranceM,
+		Zoom:       int(req.Zoom),
+		Polyline:   polyline,
+		Hide:       zonesFromProto(req.PrivacyZones),
+	})
 	if err != nil {
-		return nil, status.Error(codes.NotFound, "route map not found")
+		return nil, toStatus(err, "failed to get map")
 	}
-	return &pb.GetRouteResponse{
-		RouteId:   m.RouteID.String(),
-		GeoJson:   m.GeoJSON,
-		CreatedAt: m.CreatedAt.String(),
-	}, nil
+	resp := &pb.GetRouteResponse{
+		RouteId:    g.Map.RouteID.String(),
+		CreatedAt:  g.Map.CreatedAt.String(),
+		ToleranceM: g.ToleranceM,
+		Version:    int32(g.Map.Version),
+	}
+	if g.Map.OwnerID != nil {
+		resp.OwnerId = g.Map.OwnerID.String()
+	}
+	if polyline {
+		resp.Polylines = g.Polylines
+	} else {
+		resp.GeoJson = g.GeoJSON
+	}
+	return resp, nil
 }
 
 func (h *Handler) SetRoute(ctx context.Context, req *pb.SetRouteRequest) (*pb.SetRouteResponse, error) {
-	if err := h.ctrl.SetRouteMap(req.RouteId, req.GeoJson); err != nil {
-		return nil, status.Error(codes.Internal, "failed to save map")
+	version, err := h.ctrl.SetRouteMap(req.RouteId, req.Name, req.GeoJson, req.AuthorId)
+	if err != nil {
+		return nil, toStatus(err, "failed to save map")
+	}
+	return &pb.SetRouteResponse{Ok: true, Version: int32(version)}, nil
+}
+
+func (h *Handler) ListRouteMapVersions(ctx context.Context, req *pb.ListRouteMapVersionsRequest) (*pb.ListRouteMapVersionsResponse, error) {
+	versions, err := h.ctrl.ListRouteMapVersions(req.RouteId)
+	if err != nil {
+		return nil, toStatus(err, "failed to list map versions")
+	}
+	resp := &pb.ListRouteMapVersionsResponse{Versions: make([]*pb.RouteMapVersion, 0, len(versions))}
+	for i := range versions {
+		resp.Versions = append(resp.Versions, versionToProto(&versions[i]))
+	}
+	return resp, nil
+}
+
+func (h *Handler) GetRouteMapVersion(ctx context.Context, req *pb.GetRouteMapVersionRequest) (*pb.RouteMapVersion, error) {
+	v, err := h.ctrl.GetRouteMapVersion(req.RouteId, int(req.Version), zonesFromProto(req.PrivacyZones))
+	if err != nil {
+		return nil, toStatus(err, "failed to get map version")
+	}
+	resp := versionToProto(v)
+	resp.GeoJson = v.GeoJSON
+	return resp, nil
+}
+
+func (h *Handler) RevertRouteMap(ctx context.Context, req *pb.RevertRouteMapRequest) (*pb.SetRouteResponse, error) {
+	version, err := h.ctrl.RevertRouteMap(req.RouteId, int(req.Version), req.AuthorId)
+	if err != nil {
+		return nil, toStatus(err, "failed to revert map")
+	}
+	return &pb.SetRouteResponse{Ok: true, Version: int32(version)}, nil
+}
+
+func (h *Handler) SetWorkoutTrack(ctx context.Context, req *pb.SetWorkoutTrackRequest) (*pb.SetWorkoutTrackResponse, error) {
+	if err := h.ctrl.SetWorkoutTrack(req.WorkoutId, req.UserId, req.GeoJson); err != nil {
+		return nil, toStatus(err, "failed to save track")
+	}
+	return &pb.SetWorkoutTrackResponse{Ok: true}, nil
+}
+
+func (h *Handler) GetWorkoutTrack(ctx context.Context, req *pb.GetWorkoutTrackRequest) (*pb.WorkoutTrack, error) {
+	t, err := h.ctrl.GetWorkoutTrack(req.WorkoutId, zonesFromProto(req.PrivacyZones))
+	if err != nil {
+		return nil, toStatus(err, "failed to get track")
+	}
+	return &pb.WorkoutTrack{
+		WorkoutId: t.WorkoutID.String(),
+		UserId:    t.UserID.String(),
+		GeoJson:   t.GeoJSON,
+		CreatedAt: t.CreatedAt.Format(time.RFC3339),
+	}, nil
+}
+
+func (h *Handler) GetRouteStats(ctx context.Context, req *pb.GetRouteStatsRequest) (*pb.RouteStats, error) {
+	m, err := h.ctrl.GetRouteStats(req.RouteId, zonesFromProto(req.PrivacyZones))
+	if err != nil {
+		return nil, toStatus(err, "failed to compute route stats")
+	}
+	resp := &pb.RouteStats{
+		RouteId:        m.RouteID.String(),
+		DistanceM:      m.DistanceM,
+		HasElevation:   len(m.Profile) > 0,
+		ElevationGainM: m.ElevationGainM,
+		ElevationLossM: m.ElevationLossM,
+		MinElevationM:  m.MinElevationM,
+		MaxElevationM:  m.MaxElevationM,
+	}
+	// Sin distancia no queda nada que ubicar (toda la ruta en zonas de
+	// privacidad).
+	if m.DistanceM > 0 {
+		resp.Bbox = &pb.BoundingBox{
+			MinLat: m.MinLat,
+			MinLon: m.MinLon,
+			MaxLat: m.MaxLat,
+			MaxLon: m.MaxLon,
+		}
+		resp.Start = &pb.LatLon{Lat: m.StartLat, Lon: m.StartLon}
+		resp.End = &pb.LatLon{Lat: m.EndLat, Lon: m.EndLon}
+	}
+	if m.OwnerID != nil {
+		resp.OwnerId = m.OwnerID.String()
+	}
+	for _, p := range m.Profile {
+		resp.Profile = append(resp.Profile, &pb.ElevationSample{
+			DistanceM:  p.DistanceM,
+			ElevationM: p.ElevationM,
+		})
+	}
+	return resp, nil
+}
+
+func (h *Handler) SearchRoutesNear(ctx context.Context, req *pb.SearchRoutesNearRequest) (*pb.SearchRoutesResponse, error) {
+	matches, err := h.ctrl.SearchRoutesNear(req.Lat, req.Lon, req.RadiusM, int(req.Limit))
+	if err != nil {
+		return nil, toStatus(err, "failed to search routes")
+	}
+	return searchResponse(matches), nil
+}
+
+func (h *Handler) SearchRoutesInBBox(ctx context.Context, req *pb.SearchRoutesInBBoxRequest) (*pb.SearchRoutesResponse, error) {
+	if req.Bbox == nil {
+		return nil, status.Error(codes.InvalidArgument, "bbox is required")
+	}
+	matches, err := h.ctrl.SearchRoutesInBBox(geo.BBox{
+		MinLon: req.Bbox.MinLon,
+		MinLat: req.Bbox.MinLat,
+		MaxLon: req.Bbox.MaxLon,
+		MaxLat: req.Bbox.MaxLat,
+	}, int(req.Limit))
+	if err != nil {
+		return nil, toStatus(err, "failed to search routes")
+	}
+	return searchResponse(matches), nil
+}
+
+func (h *Handler) RenderRoutePreview(ctx context.Context, req *pb.RenderRoutePreviewRequest) (*pb.RoutePreview, error) {
+	style, ok := previewStyles[req.Style]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid preview style %v", req.Style)
+	}
+	p, err := h.ctrl.RenderRoutePreview(req.RouteId, int(req.Width), int(req.Height), style, zonesFromProto(req.PrivacyZones))
+	if err != nil {
+		return nil, toStatus(err, "failed to render preview")
+	}
+	resp := &pb.RoutePreview{
+		Png:     p.PNG,
+		Version: int32(p.Version),
+		Width:   int32(p.Width),
+		Height:  int32(p.Height),
+	}
+	if p.OwnerID != nil {
+		resp.OwnerId = p.OwnerID.String()
+	}
+	return resp, nil
+}
+
+var previewStyles = map[pb.PreviewStyle]preview.Style{
+	pb.PreviewStyle_PREVIEW_STYLE_PLAIN:     preview.StylePlain,
+	pb.PreviewStyle_PREVIEW_STYLE_ELEVATION: preview.StyleElevation,
+	pb.PreviewStyle_PREVIEW_STYLE_GRADE:     preview.StyleGrade,
+}
+
+func (h *Handler) GetTile(ctx context.Context, req *pb.GetTileRequest) (*pb.Tile, error) {
+	data, err := h.ctrl.GetTile(int(req.Z), int(req.X), int(req.Y))
+	if err != nil {
+		return nil, toStatus(err, "failed to render tile")
+	}
+	return &pb.Tile{Data: data}, nil
+}
+
+func (h *Handler) DeleteRoute(ctx context.Context, req *pb.DeleteRouteRequest) (*pb.DeleteRouteResponse, error) {
+	if err := h.ctrl.DeleteRouteMap(req.RouteId); err != nil {
+		return nil, toStatus(err, "failed to delete route map")
+	}
+	return &pb.DeleteRouteResponse{Ok: true}, nil
+}
+
+func (h *Handler) SetRouteListed(ctx context.Context, req *pb.SetRouteListedRequest) (*pb.SetRouteListedResponse, error) {
+	if err := h.ctrl.SetRouteListed(req.RouteId, req.Listed); err != nil {
+		return nil, toStatus(err, "failed to set route visibility")
+	}
+	return &pb.SetRouteListedResponse{Ok: true}, nil
+}
+
+func (h *Handler) SetUserPrivacyZones(ctx context.Context, req *pb.SetUserPrivacyZonesRequest) (*pb.SetUserPrivacyZonesResponse, error) {
+	if err := h.ctrl.SetUserPrivacyZones(req.UserId, zonesFromProto(req.Zones)); err != nil {
+		return nil, toStatus(err, "failed to set privacy zones")
+	}
+	return &pb.SetUserPrivacyZonesResponse{Ok: true}, nil
+}
+
+func (h *Handler) GetHeatmapTile(ctx context.Context, req *pb.GetHeatmapTileRequest) (*pb.HeatmapTile, error) {
+	data, err := h.ctrl.GetHeatmapTile(int(req.Z), int(req.X), int(req.Y), req.UserId, zonesFromProto(req.PrivacyZones))
+	if err != nil {
+		return nil, toStatus(err, "failed to render heatmap tile")
+	}
+	return &pb.HeatmapTile{Png: data}, nil
+}
+
+func (h *Handler) PlanRoute(ctx context.Context, req *pb.PlanRouteRequest) (*pb.PlannedRoute, error) {
+	if req.Start == nil || req.End == nil {
+		return nil, status.Error(codes.InvalidArgument, "start and end are required")
+	}
+	via := make([]geo.Point, 0, len(req.Via))
+	for _, v := range req.Via {
+		via = append(via, latLonToPoint(v))
+	}
+	p, err := h.ctrl.PlanRoute(latLonToPoint(req.Start), latLonToPoint(req.End), via, planOptimize[req.Optimize])
+	if err != nil {
+		return nil, toStatus(err, "failed to plan route")
+	}
+	return &pb.PlannedRoute{
+		GeoJson:        p.GeoJSON,
+		DistanceM:      p.DistanceM,
+		ElevationGainM: p.ElevationGainM,
+		ElevationLossM: p.ElevationLossM,
+		RouteIds:       p.RouteIDs,
+	}, nil
+}
+
+func (h *Handler) CreatePOI(ctx context.Context, req *pb.CreatePOIRequest) (*pb.POI, error) {
+	p := &model.POI{
+		Type:        poiTypeFromProto[req.Type],
+		Lat:         req.Lat,
+		Lon:         req.Lon,
+		Name:        req.Name,
+		Description: req.Description,
+		PhotoRef:    req.PhotoRef,
+	}
+	if err := h.ctrl.CreatePOI(p, req.CreatedBy); err != nil {
+		return nil, toStatus(err, "failed to create poi")
+	}
+	return poiToProto(p), nil
+}
+
+func (h *Handler) GetPOI(ctx context.Context, req *pb.GetPOIRequest) (*pb.POI, error) {
+	p, err := h.ctrl.GetPOI(req.Id)
+	if err != nil {
+		return nil, toStatus(err, "failed to get poi")
+	}
+	return poiToProto(p), nil
+}
+
+func (h *Handler) UpdatePOI(ctx context.Context, req *pb.UpdatePOIRequest) (*pb.POI, error) {
+	p, err := h.ctrl.UpdatePOI(req.Id, &model.POI{
+		Type:        poiTypeFromProto[req.Type],
+		Lat:         req.Lat,
+		Lon:         req.Lon,
+		Name:        req.Name,
+		Description: req.Description,
+		PhotoRef:    req.PhotoRef,
+	})
+	if err != nil {
+		return nil, toStatus(err, "failed to update poi")
+	}
+	return poiToProto(p), nil
+}
+
+func (h *Handler) DeletePOI(ctx context.Context, req *pb.DeletePOIRequest) (*pb.DeletePOIResponse, error) {
+	if err := h.ctrl.DeletePOI(req.Id); err != nil {
+		return nil, toStatus(err, "failed to delete poi")
+	}
+	return &pb.DeletePOIResponse{Ok: true}, nil
+}
+
+func (h *Handler) ListPOIsForRoute(ctx context.Context, req *pb.ListPOIsForRouteRequest) (*pb.ListPOIsForRouteResponse, error) {
+	types := make([]model.POIType, 0, len(req.Types))
+	for _, t := range req.Types {
+		mt, ok := poiTypeFromProto[t]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid poi type %v", t)
+		}
+		types = append(types, mt)
+	}
+	pois, err := h.ctrl.ListPOIsForRoute(req.RouteId, req.WithinM, types)
+	if err != nil {
+		return nil, toStatus(err, "failed to list pois")
+	}
+	resp := &pb.ListPOIsForRouteResponse{Pois: make([]*pb.RoutePOI, 0, len(pois))}
+	for i := range pois {
+		resp.Pois = append(resp.Pois, &pb.RoutePOI{
+			Poi:       poiToProto(&pois[i].POI),
+			DistanceM: pois[i].DistanceM,
+			AlongM:    pois[i].AlongM,
+		})
+	}
+	return resp, nil
+}
+
+var poiTypeFromProto = map[pb.POIType]model.POIType{
+	pb.POIType_POI_TYPE_WATER:     model.POIWater,
+	pb.POIType_POI_TYPE_VIEWPOINT: model.POIViewpoint,
+	pb.POIType_POI_TYPE_HAZARD:    model.POIHazard,
+	pb.POIType_POI_TYPE_PARKING:   model.POIParking,
+	pb.POIType_POI_TYPE_SHELTER:   model.POIShelter,
+	pb.POIType_POI_TYPE_OTHER:     model.POIOther,
+}
+
+func poiToProto(p *model.POI) *pb.POI {
+	resp := &pb.POI{
+		Id:          p.ID.String(),
+		Lat:         p.Lat,
+		Lon:         p.Lon,
+		Name:        p.Name,
+		Description: p.Description,
+		PhotoRef:    p.PhotoRef,
+		CreatedAt:   p.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   p.UpdatedAt.Format(time.RFC3339),
+	}
+	for pt, mt := range poiTypeFromProto {
+		if mt == p.Type {
+			resp.Type = pt
+		}
+	}
+	if p.CreatedBy != nil {
+		resp.CreatedBy = p.CreatedBy.String()
+	}
+	return resp
+}
+
+func versionToProto(v *model.MapVersion) *pb.RouteMapVersion {
+	resp := &pb.RouteMapVersion{
+		RouteId:   v.RouteID.String(),
+		Version:   int32(v.Version),
+		Name:      v.Name,
+		CreatedAt: v.CreatedAt.Format(time.RFC3339),
+		DistanceM: v.DistanceM,
+	}
+	if v.AuthorID != nil {
+		resp.AuthorId = v.AuthorID.String()
+	}
+	if v.OwnerID != nil {
+		resp.OwnerId = v.OwnerID.String()
+	}
+	if v.RevertedFrom != nil {
+		resp.RevertedFrom = int32(*v.RevertedFrom)
+	}
+	return resp
+}
+
+var planOptimize = map[pb.PlanOptimize]trailgraph.Optimize{
+	pb.PlanOptimize_PLAN_OPTIMIZE_DISTANCE:  trailgraph.OptimizeDistance,
+	pb.PlanOptimize_PLAN_OPTIMIZE_ELEVATION: trailgraph.OptimizeElevation,
+}
+
+func latLonToPoint(ll *pb.LatLon) geo.Point {
+	return geo.Point{Lat: ll.Lat, Lon: ll.Lon}
+}
+
+func zonesFromProto(zones []*pb.PrivacyZone) []geo.Circle {
+	out := make([]geo.Circle, 0, len(zones))
+	for _, z := range zones {
+		out = append(out, geo.Circle{Center: geo.Point{Lat: z.Lat, Lon: z.Lon}, RadiusM: z.RadiusM})
+	}
+	return out
+}
+
+func searchResponse(matches []spatial.Match) *pb.SearchRoutesResponse {
+	resp := &pb.SearchRoutesResponse{Routes: make([]*pb.RouteMatch, 0, len(matches))}
+	for _, m := range matches {
+		resp.Routes = append(resp.Routes, &pb.RouteMatch{
+			RouteId:   m.Entry.RouteID,
+			DistanceM: m.DistanceM,
+			Nearest:   &pb.LatLon{Lat: m.Nearest.Lat, Lon: m.Nearest.Lon},
+			Bbox: &pb.BoundingBox{
+				MinLat: m.Entry.BBox.MinLat,
+				MinLon: m.Entry.BBox.MinLon,
+				MaxLat: m.Entry.BBox.MaxLat,
+				MaxLon: m.Entry.BBox.MaxLon,
+			},
+			LengthM: m.Entry.LengthM,
+		})
+	}
+	return resp
+}
+
+// toStatus traduce errores del controller a códigos gRPC.
+func toStatus(err error, internalMsg string) error {
+	var verr *geo.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		// El campo exacto viaja como detalle BadRequest para que el gateway
+		// lo pueda mostrar.
+		st, derr := status.New(codes.InvalidArgument, err.Error()).WithDetails(&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       joinField("geo_json", verr.Field),
+				Description: verr.Msg,
+			}},
+		})
+		if derr != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		return st.Err()
+	case errors.Is(err, mapctrl.ErrInvalidArgument):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, repository.ErrNotFound):
+		return status.Error(codes.NotFound, "not found")
+	case errors.Is(err, trailgraph.ErrNoTrailNearby), errors.Is(err, trailgraph.ErrNoPath):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, internalMsg)
+	}
+}
+
+func joinField(prefix, field string) string {
+	if field == "" {
+		return prefix
 	}
-	return &pb.SetRouteResponse{Ok: true}, nil
+	return prefix + "." + field
 }
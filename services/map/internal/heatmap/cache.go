@@ -0,0 +1,101 @@
+package heatmap
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+
+	"trailbox/services/map/internal/geo"
+	"trailbox/services/map/internal/tiles"
+)
+
+// DefaultCacheSize es la cantidad de teselas que se guardan en memoria.
+const DefaultCacheSize = 2048
+
+// Key identifica una tesela ya dibujada. UserID vacío es el heatmap global;
+// Zones resume las zonas enmascaradas (ver ZonesKey).
+type Key struct {
+	Z, X, Y int
+	UserID  string
+	Zones   string
+}
+
+// ZonesKey resume las zonas para usarlas en Key; "" si no hay.
+func ZonesKey(zones []geo.Circle) string {
+	var b strings.Builder
+	for _, z := range zones {
+		fmt.Fprintf(&b, "%.6f,%.6f,%.0f;", z.Center.Lat, z.Center.Lon, z.RadiusM)
+	}
+	return b.String()
+}
+
+type cacheEntry struct {
+	key  Key
+	box  geo.BBox
+	data []byte
+}
+
+// Cache es un LRU de PNGs. Como en tiles.Cache, Invalidate borra solo las
+// teselas que cruzan la zona que cambió, de todos los usuarios.
+type Cache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // frente = más reciente
+	items map[Key]*list.Element
+}
+
+func NewCache(size int) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &Cache{size: size, order: list.New(), items: map[Key]*list.Element{}}
+}
+
+func (c *Cache) Get(k Key) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[k]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).data, true
+}
+
+func (c *Cache) Put(k Key, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[k]; ok {
+		el.Value.(*cacheEntry).data = data
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[k] = c.order.PushFront(&cacheEntry{key: k, box: tiles.Bounds(k.Z, k.X, k.Y), data: data})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Invalidate borra las teselas que intersectan alguna de las cajas.
+func (c *Cache) Invalidate(boxes ...geo.BBox) {
+	if len(boxes) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		e := el.Value.(*cacheEntry)
+		for _, b := range boxes {
+			if intersects(e.box, b) {
+				c.order.Remove(el)
+				delete(c.items, e.key)
+				break
+			}
+		}
+		el = next
+	}
+}
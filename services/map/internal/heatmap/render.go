@@ -0,0 +1,134 @@
+package heatmap
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	"trailbox/services/map/internal/geo"
+	"trailbox/services/map/internal/tiles"
+)
+
+// TileSize es el lado de la tesela PNG en píxeles.
+const TileSize = 256
+
+// Cantidad de tracks con la que un píxel llega al color más caliente. Un
+// usuario solo rara vez repite tanto como todos juntos.
+const (
+	GlobalSaturation = 50
+	UserSaturation   = 10
+)
+
+// ramp va de rojo oscuro y semitransparente (pocos tracks) a blanco.
+var ramp = []color.NRGBA{
+	{0x7f, 0x00, 0x26, 0x70},
+	{0xe3, 0x2d, 0x14, 0xc0},
+	{0xff, 0xb3, 0x1a, 0xe6},
+	{0xff, 0xff, 0xe0, 0xff},
+}
+
+// Render cuenta en cada píxel de la tesela z/x/y cuántos tracks lo cruzan y
+// lo devuelve como PNG transparente. Un track que pasa dos veces por el mismo
+// píxel cuenta una. Los píxeles dentro de hide quedan vacíos.
+func Render(z, x, y int, tracks [][][]geo.Point, saturation int, hide []geo.Circle) ([]byte, error) {
+	counts := make([]uint16, TileSize*TileSize)
+	stamp := make([]int32, TileSize*TileSize) // último track que marcó el píxel
+	n := math.Exp2(float64(z))
+
+	for i, lines := range tracks {
+		id := int32(i + 1)
+		plot := func(px, py int) {
+			if px < 0 || py < 0 || px >= TileSize || py >= TileSize {
+				return
+			}
+			k := py*TileSize + px
+			if stamp[k] != id {
+				stamp[k] = id
+				if counts[k] < math.MaxUint16 {
+					counts[k]++
+				}
+			}
+		}
+		for _, line := range lines {
+			var prev [2]float64
+			for j, p := range line {
+				wx, wy := tiles.Project(p, n)
+				cur := [2]float64{(wx - float64(x)) * TileSize, (wy - float64(y)) * TileSize}
+				if j > 0 {
+					if a, b, ok := tiles.ClipSegment(prev, cur, -1, TileSize+1); ok {
+						drawLine(a, b, plot)
+					}
+				}
+				prev = cur
+			}
+		}
+	}
+	if len(hide) > 0 {
+		mask(counts, z, x, y, hide)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, TileSize, TileSize))
+	scale := math.Log1p(float64(max(saturation, 1)))
+	for k, c := range counts {
+		if c == 0 {
+			continue
+		}
+		col := rampColor(math.Log1p(float64(c)) / scale)
+		img.Pix[k*4], img.Pix[k*4+1], img.Pix[k*4+2], img.Pix[k*4+3] = col.R, col.G, col.B, col.A
+	}
+
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawLine recorre el segmento ab píxel a píxel (DDA).
+func drawLine(a, b [2]float64, plot func(px, py int)) {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	steps := int(math.Ceil(math.Max(math.Abs(dx), math.Abs(dy))))
+	if steps == 0 {
+		plot(int(math.Floor(a[0])), int(math.Floor(a[1])))
+		return
+	}
+	for s := 0; s <= steps; s++ {
+		t := float64(s) / float64(steps)
+		plot(int(math.Floor(a[0]+t*dx)), int(math.Floor(a[1]+t*dy)))
+	}
+}
+
+// mask vacía los píxeles cuyo centro cae dentro de alguna zona.
+func mask(counts []uint16, z, x, y int, hide []geo.Circle) {
+	n := math.Exp2(float64(z))
+	for k, c := range counts {
+		if c == 0 {
+			continue
+		}
+		px, py := k%TileSize, k/TileSize
+		wx := float64(x) + (float64(px)+0.5)/TileSize
+		wy := float64(y) + (float64(py)+0.5)/TileSize
+		p := geo.Point{
+			Lon: wx/n*360 - 180,
+			Lat: math.Atan(math.Sinh(math.Pi*(1-2*wy/n))) * 180 / math.Pi,
+		}
+		for _, zone := range hide {
+			if geo.Haversine(p, zone.Center) <= zone.RadiusM {
+				counts[k] = 0
+				break
+			}
+		}
+	}
+}
+
+func rampColor(t float64) color.NRGBA {
+	t = math.Max(0, math.Min(1, t)) * float64(len(ramp)-1)
+	i := min(int(t), len(ramp)-2)
+	f := t - float64(i)
+	a, b := ramp[i], ramp[i+1]
+	mix := func(x, y uint8) uint8 { return uint8(math.Round(float64(x) + (float64(y)-float64(x))*f)) }
+	return color.NRGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
@@ -0,0 +1,194 @@
+// Package heatmap arma teselas PNG de densidad con todos los tracks
+// guardados: rutas y workouts. Cada track suma uno en cada píxel que cruza,
+// así que el color dice cuánta gente pasó por ahí.
+package heatmap
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"trailbox/services/map/internal/geo"
+)
+
+// EndTrimM es cuánto se recorta del inicio y del fin de cada track en el
+// heatmap global, además de las zonas de privacidad del dueño: así no se
+// marca la puerta de casa de quien sale siempre del mismo sitio aunque no
+// haya definido zonas.
+const EndTrimM = 400.0
+
+// Source es un track que aporta al heatmap.
+type Source struct {
+	ID      string // "route:<id>" o "workout:<id>"
+	OwnerID string // "" si no se conoce el dueño; solo cuenta en el global
+	Lines   [][]geo.Point
+	Public  [][]geo.Point // Lines sin los EndTrimM de cada extremo ni las zonas del dueño
+	BBox    geo.BBox
+	Version uint64
+}
+
+// RouteSourceID y WorkoutSourceID arman el ID de la fuente para que rutas y
+// workouts no choquen.
+func RouteSourceID(routeID string) string     { return "route:" + routeID }
+func WorkoutSourceID(workoutID string) string { return "workout:" + workoutID }
+
+// NewSource arma la fuente a partir de las líneas ya parseadas; hide son las
+// zonas de privacidad del dueño. geoJSON solo se usa para calcular la
+// versión.
+func NewSource(id, ownerID, geoJSON string, lines [][]geo.Point, hide []geo.Circle) *Source {
+	h := fnv.New64a()
+	h.Write([]byte(geoJSON))
+	h.Write([]byte{0})
+	h.Write([]byte(ownerID))
+	h.Write([]byte{0})
+	h.Write([]byte(ZonesKey(hide)))
+	return &Source{
+		ID:      id,
+		OwnerID: ownerID,
+		Lines:   lines,
+		Public:  geo.HideLines(trimEnds(lines, EndTrimM), hide),
+		BBox:    geo.ComputeStats(lines, 2).BBox,
+		Version: h.Sum64(),
+	}
+}
+
+// Set guarda las fuentes en memoria. Es seguro para uso concurrente.
+type Set struct {
+	mu      sync.RWMutex
+	sources map[string]*Source
+}
+
+func NewSet() *Set {
+	return &Set{sources: map[string]*Source{}}
+}
+
+// Replace reemplaza todas las fuentes y devuelve las cajas de las que
+// cambiaron, aparecieron o desaparecieron.
+func (s *Set) Replace(sources []*Source) []geo.BBox {
+	m := make(map[string]*Source, len(sources))
+	for _, src := range sources {
+		m[src.ID] = src
+	}
+
+	s.mu.Lock()
+	old := s.sources
+	s.sources = m
+	s.mu.Unlock()
+
+	var changed []geo.BBox
+	for id, src := range m {
+		prev, ok := old[id]
+		if !ok {
+			changed = append(changed, src.BBox)
+		} else if prev.Version != src.Version {
+			changed = append(changed, prev.BBox, src.BBox)
+		}
+	}
+	for id, prev := range old {
+		if _, ok := m[id]; !ok {
+			changed = append(changed, prev.BBox)
+		}
+	}
+	return changed
+}
+
+// Upsert agrega o reemplaza una fuente. Devuelve la caja anterior, si ya
+// estaba.
+func (s *Set) Upsert(src *Source) (geo.BBox, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, existed := s.sources[src.ID]
+	s.sources[src.ID] = src
+	if !existed {
+		return geo.BBox{}, false
+	}
+	return prev.BBox, true
+}
+
+// Remove quita una fuente. Devuelve su caja, si estaba.
+func (s *Set) Remove(id string) (geo.BBox, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.sources[id]
+	if !ok {
+		return geo.BBox{}, false
+	}
+	delete(s.sources, id)
+	return prev.BBox, true
+}
+
+// Tracks devuelve las líneas de las fuentes cuya caja cruza box. Con ownerID
+// vacío son todas las fuentes recortadas (heatmap global); si no, solo las de
+// ese usuario y completas.
+func (s *Set) Tracks(box geo.BBox, ownerID string) [][][]geo.Point {
+	var out [][][]geo.Point
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, src := range s.sources {
+		if !intersects(src.BBox, box) {
+			continue
+		}
+		switch {
+		case ownerID == "":
+			if len(src.Public) > 0 {
+				out = append(out, src.Public)
+			}
+		case src.OwnerID == ownerID:
+			out = append(out, src.Lines)
+		}
+	}
+	return out
+}
+
+// Len devuelve la cantidad de fuentes.
+func (s *Set) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.sources)
+}
+
+// trimEnds quita trimM metros del principio de la primera línea y del final
+// de la última. Las líneas que quedan con menos de dos puntos se descartan.
+func trimEnds(lines [][]geo.Point, trimM float64) [][]geo.Point {
+	if len(lines) == 0 {
+		return nil
+	}
+	out := make([][]geo.Point, len(lines))
+	copy(out, lines)
+	out[0] = trimStart(out[0], trimM)
+	last := len(out) - 1
+	out[last] = reversed(trimStart(reversed(out[last]), trimM))
+
+	kept := out[:0]
+	for _, l := range out {
+		if len(l) >= 2 {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// trimStart devuelve la línea desde el primer punto que queda a más de
+// trimM metros del inicio, medidos sobre la línea.
+func trimStart(line []geo.Point, trimM float64) []geo.Point {
+	acc := 0.0
+	for i := 1; i < len(line); i++ {
+		acc += geo.Haversine(line[i-1], line[i])
+		if acc >= trimM {
+			return line[i:]
+		}
+	}
+	return nil
+}
+
+func reversed(line []geo.Point) []geo.Point {
+	out := make([]geo.Point, len(line))
+	for i, p := range line {
+		out[len(line)-1-i] = p
+	}
+	return out
+}
+
+func intersects(a, b geo.BBox) bool {
+	return a.MinLon <= b.MaxLon && b.MinLon <= a.MaxLon &&
+		a.MinLat <= b.MaxLat && b.MinLat <= a.MaxLat
+}
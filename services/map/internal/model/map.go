@@ -1,14 +1,126 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Map struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey;column:id"`
-	RouteID   uuid.UUID `gorm:"type:uuid;not null;column:route_id"` // FK -> routes.id
-	GeoJSON   string    `gorm:"type:jsonb;not null;column:geojson"` // 👈 OJO: geojson
+	ID        uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey;column:id"`
+	RouteID   uuid.UUID  `gorm:"type:uuid;not null;column:route_id"` // FK -> routes.id
+	GeoJSON   string     `gorm:"type:jsonb;not null;column:geojson"` // 👈 OJO: geojson
+	Name      string     `gorm:"not null;default:'';column:name"`    // se muestra en las teselas
+	Version   int        `gorm:"not null;default:0;column:version"`  // última versión en map_versions
+	OwnerID   *uuid.UUID `gorm:"type:uuid;column:owner_id"`          // dueño del track; se aplican sus zonas de privacidad
+	CreatedAt time.Time  `gorm:"autoCreateTime;column:created_at"`
+
+	// Métricas calculadas al guardar la geometría.
+	DistanceM      float64          `gorm:"not null;default:0;column:distance_m"`
+	ElevationGainM float64          `gorm:"not null;default:0;column:elevation_gain_m"`
+	ElevationLossM float64          `gorm:"not null;default:0;column:elevation_loss_m"`
+	MinElevationM  float64          `gorm:"not null;default:0;column:min_elevation_m"`
+	MaxElevationM  float64          `gorm:"not null;default:0;column:max_elevation_m"`
+	MinLat         float64          `gorm:"not null;default:0;column:min_lat"`
+	MinLon         float64          `gorm:"not null;default:0;column:min_lon"`
+	MaxLat         float64          `gorm:"not null;default:0;column:max_lat"`
+	MaxLon         float64          `gorm:"not null;default:0;column:max_lon"`
+	StartLat       float64          `gorm:"not null;default:0;column:start_lat"`
+	StartLon       float64          `gorm:"not null;default:0;column:start_lon"`
+	EndLat         float64          `gorm:"not null;default:0;column:end_lat"`
+	EndLon         float64          `gorm:"not null;default:0;column:end_lon"`
+	Profile        ElevationProfile `gorm:"type:jsonb;column:elevation_profile"`
+	StatsAt        *time.Time       `gorm:"column:stats_at"` // nil = filas guardadas antes de calcular métricas
+
+	// Geometría simplificada por banda de zoom, calculada al guardar.
+	Simplified SimplifiedVariants `gorm:"type:jsonb;column:simplified"`
+}
+
+// ProfileSample es la altura a cierta distancia desde el inicio de la ruta.
+type ProfileSample struct {
+	DistanceM  float64 `json:"d"`
+	ElevationM float64 `json:"e"`
+}
+
+// ElevationProfile se guarda como JSONB; vacío si la geometría no trae alturas.
+type ElevationProfile []ProfileSample
+
+func (p ElevationProfile) Value() (driver.Value, error) {
+	if p == nil {
+		p = ElevationProfile{}
+	}
+	return json.Marshal(p)
+}
+
+func (p *ElevationProfile) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*p = ElevationProfile{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("failed to parse JSONB column")
+	}
+	return json.Unmarshal(data, p)
+}
+
+// SimplifiedVariant es la geometría de la ruta simplificada para los zooms
+// hasta MaxZoom.
+type SimplifiedVariant struct {
+	MaxZoom    int             `json:"max_zoom"`
+	ToleranceM float64         `json:"tolerance_m"`
+	GeoJSON    json.RawMessage `json:"geojson"`
+	Polylines  []string        `json:"polylines"`
+}
+
+// SimplifiedVariants se guarda como JSONB, ordenado de menor a mayor zoom.
+type SimplifiedVariants []SimplifiedVariant
+
+func (v SimplifiedVariants) Value() (driver.Value, error) {
+	if v == nil {
+		v = SimplifiedVariants{}
+	}
+	return json.Marshal(v)
+}
+
+func (v *SimplifiedVariants) Scan(value interface{}) error {
+	var data []byte
+	switch val := value.(type) {
+	case nil:
+		*v = SimplifiedVariants{}
+		return nil
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	default:
+		return fmt.Errorf("failed to parse JSONB column")
+	}
+	return json.Unmarshal(data, v)
+}
+
+// UnlistedRoute marca una ruta que no es pública. Su geometría se sigue
+// guardando, pero no entra en teselas, búsqueda espacial, heatmap ni
+// planificador.
+type UnlistedRoute struct {
+	RouteID   uuid.UUID `gorm:"type:uuid;primaryKey;column:route_id"`
 	CreatedAt time.Time `gorm:"autoCreateTime;column:created_at"`
 }
+
+// PrivacyZone es la copia de una zona de privacidad del servicio de
+// usuarios; el gateway la mantiene (ver SetUserPrivacyZones) para enmascarar
+// el heatmap global.
+type PrivacyZone struct {
+	ID      uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey;column:id"`
+	UserID  uuid.UUID `gorm:"type:uuid;not null;index;column:user_id"`
+	Lat     float64   `gorm:"not null;column:lat"`
+	Lon     float64   `gorm:"not null;column:lon"`
+	RadiusM float64   `gorm:"not null;column:radius_m"`
+}
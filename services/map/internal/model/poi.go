@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// POIType es la categoría de un punto de interés.
+type POIType string
+
+const (
+	POIWater     POIType = "water"
+	POIViewpoint POIType = "viewpoint"
+	POIHazard    POIType = "hazard"
+	POIParking   POIType = "parking"
+	POIShelter   POIType = "shelter"
+	POIOther     POIType = "other"
+)
+
+// POI es un punto de interés (fuente de agua, mirador, peligro...). No
+// pertenece a una ruta: se asocia a las rutas que pasan cerca.
+type POI struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey;column:id"`
+	Type        POIType    `gorm:"not null;column:type"`
+	Lat         float64    `gorm:"not null;column:lat"`
+	Lon         float64    `gorm:"not null;column:lon"`
+	Name        string     `gorm:"not null;default:'';column:name"`
+	Description string     `gorm:"not null;default:'';column:description"`
+	PhotoRef    string     `gorm:"not null;default:'';column:photo_ref"` // URL o clave del archivo; opcional
+	CreatedBy   *uuid.UUID `gorm:"type:uuid;column:created_by"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime;column:created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime;column:updated_at"`
+}
+
+func (POI) TableName() string {
+	return "pois"
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Track es el recorrido GPS de un workout.
+type Track struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey;column:id"`
+	WorkoutID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex;column:workout_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;column:user_id"`
+	GeoJSON   string    `gorm:"type:jsonb;not null;column:geojson"`
+	CreatedAt time.Time `gorm:"autoCreateTime;column:created_at"`
+}
+
+func (Track) TableName() string {
+	return "workout_tracks"
+}
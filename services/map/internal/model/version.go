@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MapVersion es una versión guardada de la geometría de una ruta. Cada
+// SetRoute o revert agrega una; nunca se modifican.
+type MapVersion struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey;column:id"`
+	RouteID      uuid.UUID  `gorm:"type:uuid;not null;column:route_id"`
+	Version      int        `gorm:"not null;column:version"`
+	GeoJSON      string     `gorm:"type:jsonb;not null;column:geojson"`
+	Name         string     `gorm:"not null;default:'';column:name"`
+	AuthorID     *uuid.UUID `gorm:"type:uuid;column:author_id"` // nil = sin autor (cargas del sistema)
+	OwnerID      *uuid.UUID `gorm:"type:uuid;column:owner_id"`  // dueño de la geometría; en un revert, el de la versión restaurada
+	DistanceM    float64    `gorm:"not null;default:0;column:distance_m"`
+	RevertedFrom *int       `gorm:"column:reverted_from"` // versión restaurada, si vino de un revert
+	CreatedAt    time.Time  `gorm:"autoCreateTime;column:created_at"`
+}
+
+func (MapVersion) TableName() string {
+	return "map_versions"
+}
@@ -0,0 +1,66 @@
+package preview
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheSize es la cantidad de miniaturas que se guardan en memoria.
+const DefaultCacheSize = 512
+
+// Key identifica una miniatura. Como incluye la versión del mapa, guardar una
+// geometría nueva deja obsoletas las anteriores sin invalidar nada.
+type Key struct {
+	RouteID       string
+	Version       int
+	Width, Height int
+	Style         Style
+	Zones         string // zonas de privacidad aplicadas; vacío = ninguna
+}
+
+type cacheEntry struct {
+	key  Key
+	data []byte
+}
+
+// Cache es un LRU de PNGs ya codificados.
+type Cache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // frente = más reciente
+	items map[Key]*list.Element
+}
+
+func NewCache(size int) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &Cache{size: size, order: list.New(), items: map[Key]*list.Element{}}
+}
+
+func (c *Cache) Get(k Key) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[k]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).data, true
+}
+
+func (c *Cache) Put(k Key, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[k]; ok {
+		el.Value.(*cacheEntry).data = data
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[k] = c.order.PushFront(&cacheEntry{key: k, data: data})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,180 @@
+// Package preview dibuja miniaturas PNG de una ruta sin servidor de
+// teselas: fondo liso, la línea de la ruta y marcadores de inicio y fin.
+package preview
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	"trailbox/services/map/internal/geo"
+)
+
+// Style elige cómo se colorea la línea.
+type Style int
+
+const (
+	StylePlain     Style = iota
+	StyleElevation       // de verde (bajo) a rojo (alto)
+	StyleGrade           // por pendiente; rojo desde maxGrade
+)
+
+const (
+	padding  = 0.08 // fracción del lado que queda libre alrededor
+	maxGrade = 0.15
+)
+
+var (
+	background = color.NRGBA{0xf1, 0xf5, 0xf0, 0xff}
+	halo       = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+	plainLine  = color.NRGBA{0x25, 0x63, 0xeb, 0xff}
+	startFill  = color.NRGBA{0x16, 0xa3, 0x4a, 0xff}
+	endFill    = color.NRGBA{0xdc, 0x26, 0x26, 0xff}
+	ramp       = []color.NRGBA{
+		{0x22, 0xc5, 0x5e, 0xff},
+		{0xea, 0xb3, 0x08, 0xff},
+		{0xdc, 0x26, 0x26, 0xff},
+	}
+)
+
+// vertex es un punto ya proyectado a píxeles con el valor (0..1) que define
+// su color.
+type vertex struct {
+	x, y float64
+	t    float64
+}
+
+// Render dibuja las líneas en una imagen w×h y la devuelve codificada como
+// PNG. Si el estilo pide alturas y la ruta no las trae, se usa el color liso.
+func Render(lines [][]geo.Point, w, h int, style Style) ([]byte, error) {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	fill(img, background)
+
+	if style == StyleElevation && !hasElevation(lines) {
+		style = StylePlain
+	}
+	paths := project(lines, w, h, style)
+
+	width := math.Max(2, float64(min(w, h))/80)
+	haloLayer, lineLayer := newLayer(w, h), newLayer(w, h)
+	for _, path := range paths {
+		for i := 0; i+1 < len(path); i++ {
+			haloLayer.segment(path[i], path[i+1], width/2+1.5, nil)
+			lineLayer.segment(path[i], path[i+1], width/2, func(t float64) color.NRGBA {
+				if style == StylePlain {
+					return plainLine
+				}
+				return rampColor(t)
+			})
+		}
+	}
+	haloLayer.compose(img, func(int) color.NRGBA { return halo })
+	lineLayer.compose(img, func(i int) color.NRGBA { return lineLayer.colors[i] })
+
+	if len(paths) > 0 {
+		first, last := paths[0], paths[len(paths)-1]
+		r := width * 1.6
+		marker(img, first[0], r, startFill)
+		marker(img, last[len(last)-1], r, endFill)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// project pasa las líneas a píxeles (Web Mercator) encuadradas en la imagen,
+// simplificadas a medio píxel, y calcula el valor de color de cada punto.
+func project(lines [][]geo.Point, w, h int, style Style) [][]vertex {
+	s := geo.ComputeStats(lines, 2)
+	minX, maxX := s.BBox.MinLon, s.BBox.MaxLon
+	minY, maxY := mercY(s.BBox.MaxLat), mercY(s.BBox.MinLat)
+
+	padX, padY := float64(w)*padding, float64(h)*padding
+	scale := math.Inf(1)
+	if dx := maxX - minX; dx > 0 {
+		scale = (float64(w) - 2*padX) / dx
+	}
+	if dy := maxY - minY; dy > 0 {
+		scale = math.Min(scale, (float64(h)-2*padY)/dy)
+	}
+	if math.IsInf(scale, 1) {
+		scale = 1
+	}
+	offX := (float64(w) - (maxX-minX)*scale) / 2
+	offY := (float64(h) - (maxY-minY)*scale) / 2
+
+	// Metros sobre el terreno que cubre un píxel, para simplificar.
+	metersPerPixel := 111320 * math.Cos((s.BBox.MinLat+s.BBox.MaxLat)/2*math.Pi/180) / scale
+
+	minEle, maxEle := s.MinElevationM, s.MaxElevationM
+	var paths [][]vertex
+	for _, line := range lines {
+		pts := geo.Simplify(line, metersPerPixel/2)
+		path := make([]vertex, len(pts))
+		for i, p := range pts {
+			path[i] = vertex{
+				x: offX + (p.Lon-minX)*scale,
+				y: offY + (mercY(p.Lat)-minY)*scale,
+			}
+			switch style {
+			case StyleElevation:
+				if maxEle > minEle {
+					path[i].t = (p.Ele - minEle) / (maxEle - minEle)
+				}
+			case StyleGrade:
+				// La pendiente de un punto es la del tramo que llega a él.
+				if i > 0 {
+					if d := geo.Haversine(pts[i-1], p); d > 0 {
+						path[i].t = math.Min(1, math.Abs(p.Ele-pts[i-1].Ele)/d/maxGrade)
+					}
+				} else if len(pts) > 1 {
+					if d := geo.Haversine(p, pts[1]); d > 0 {
+						path[i].t = math.Min(1, math.Abs(pts[1].Ele-p.Ele)/d/maxGrade)
+					}
+				}
+			}
+		}
+		if len(path) >= 2 {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// mercY devuelve la coordenada Y de Web Mercator en grados, creciente hacia
+// el sur para que coincida con las filas de la imagen.
+func mercY(lat float64) float64 {
+	lat = math.Max(-85.0511, math.Min(85.0511, lat)) * math.Pi / 180
+	return -math.Log(math.Tan(math.Pi/4+lat/2)) * 180 / math.Pi
+}
+
+func hasElevation(lines [][]geo.Point) bool {
+	for _, line := range lines {
+		for _, p := range line {
+			if p.HasEle {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func rampColor(t float64) color.NRGBA {
+	t = math.Max(0, math.Min(1, t)) * float64(len(ramp)-1)
+	i := min(int(t), len(ramp)-2)
+	f := t - float64(i)
+	a, b := ramp[i], ramp[i+1]
+	mix := func(x, y uint8) uint8 { return uint8(math.Round(float64(x) + (float64(y)-float64(x))*f)) }
+	return color.NRGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+}
+
+func fill(img *image.NRGBA, c color.NRGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+}
@@ -0,0 +1,82 @@
+package preview
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// layer acumula la cobertura (antialias) de un trazo. Cada píxel guarda la
+// cobertura máxima, así los tramos que se solapan no se oscurecen.
+type layer struct {
+	w, h   int
+	cov    []float64
+	colors []color.NRGBA
+}
+
+func newLayer(w, h int) *layer {
+	return &layer{w: w, h: h, cov: make([]float64, w*h), colors: make([]color.NRGBA, w*h)}
+}
+
+// segment traza el tramo ab con radio r. colorAt recibe el valor t
+// interpolado a lo largo del tramo; puede ser nil si la capa es de un color.
+func (l *layer) segment(a, b vertex, r float64, colorAt func(t float64) color.NRGBA) {
+	x0 := max(0, int(math.Floor(math.Min(a.x, b.x)-r-1)))
+	x1 := min(l.w-1, int(math.Ceil(math.Max(a.x, b.x)+r+1)))
+	y0 := max(0, int(math.Floor(math.Min(a.y, b.y)-r-1)))
+	y1 := min(l.h-1, int(math.Ceil(math.Max(a.y, b.y)+r+1)))
+
+	dx, dy := b.x-a.x, b.y-a.y
+	lenSq := dx*dx + dy*dy
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			u := 0.0
+			if lenSq > 0 {
+				u = math.Max(0, math.Min(1, ((px-a.x)*dx+(py-a.y)*dy)/lenSq))
+			}
+			d := math.Hypot(px-(a.x+u*dx), py-(a.y+u*dy))
+			alpha := math.Max(0, math.Min(1, r+0.5-d))
+			i := y*l.w + x
+			if alpha <= l.cov[i] {
+				continue
+			}
+			l.cov[i] = alpha
+			if colorAt != nil {
+				l.colors[i] = colorAt(a.t + u*(b.t-a.t))
+			}
+		}
+	}
+}
+
+// compose mezcla la capa sobre la imagen.
+func (l *layer) compose(img *image.NRGBA, colorAt func(i int) color.NRGBA) {
+	for i, a := range l.cov {
+		if a > 0 {
+			blend(img.Pix[i*4:i*4+4], colorAt(i), a)
+		}
+	}
+}
+
+// marker dibuja un círculo relleno con borde blanco.
+func marker(img *image.NRGBA, at vertex, r float64, c color.NRGBA) {
+	border := math.Max(1.5, r/3)
+	b := img.Bounds()
+	for y := max(b.Min.Y, int(at.y-r-border-1)); y <= min(b.Max.Y-1, int(at.y+r+border+1)); y++ {
+		for x := max(b.Min.X, int(at.x-r-border-1)); x <= min(b.Max.X-1, int(at.x+r+border+1)); x++ {
+			d := math.Hypot(float64(x)+0.5-at.x, float64(y)+0.5-at.y)
+			pix := img.Pix[img.PixOffset(x, y):]
+			if a := math.Max(0, math.Min(1, r+border+0.5-d)); a > 0 {
+				blend(pix, halo, a)
+			}
+			if a := math.Max(0, math.Min(1, r+0.5-d)); a > 0 {
+				blend(pix, c, a)
+			}
+		}
+	}
+}
+
+func blend(pix []uint8, c color.NRGBA, a float64) {
+	mix := func(dst, src uint8) uint8 { return uint8(math.Round(float64(dst)*(1-a) + float64(src)*a)) }
+	pix[0], pix[1], pix[2], pix[3] = mix(pix[0], c.R), mix(pix[1], c.G), mix(pix[2], c.B), 0xff
+}
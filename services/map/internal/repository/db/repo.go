@@ -1,12 +1,15 @@
 package db
 
 import (
+	"errors"
+
 	"trailbox/services/map/internal/model"
 	"trailbox/services/map/internal/repository"
 
 	"github.com/google/uuid"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type DBRepository struct {
@@ -17,23 +20,69 @@ func New(conn *gorm.DB) repository.Repository {
 	return &DBRepository{db: conn}
 }
 
-func (r *DBRepository) SetRouteMap(routeID uuid.UUID, geoJSON string) error {
-	var existing model.Map
-	err := r.db.Where("route_id = ?", routeID).First(&existing).Error
-	if err == gorm.ErrRecordNotFound {
-		newMap := model.Map{RouteID: routeID, GeoJSON: geoJSON}
-		return r.db.Create(&newMap).Error
-	}
-	if err != nil {
-		return err
-	}
-	existing.GeoJSON = geoJSON
-	return r.db.Save(&existing).Error
+func (r *DBRepository) SetRouteMap(m *model.Map, v *model.MapVersion) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// El lock serializa los guardados de la misma ruta entre réplicas.
+		var existing model.Map
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("route_id = ?", m.RouteID).First(&existing).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if m.ID == uuid.Nil {
+				m.ID = uuid.New()
+			}
+			m.Version = 1
+			err = tx.Create(m).Error
+		case err != nil:
+			return err
+		default:
+			m.ID = existing.ID
+			m.CreatedAt = existing.CreatedAt
+			m.Version = existing.Version + 1
+			err = tx.Save(m).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		v.ID = uuid.New()
+		v.RouteID = m.RouteID
+		v.Version = m.Version
+		v.GeoJSON = m.GeoJSON
+		v.Name = m.Name
+		v.DistanceM = m.DistanceM
+		v.OwnerID = m.OwnerID
+		return tx.Create(v).Error
+	})
+}
+
+func (r *DBRepository) DeleteRouteMap(routeID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("route_id = ?", routeID).Delete(&model.Map{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return repository.ErrNotFound
+		}
+		if err := tx.Where("route_id = ?", routeID).Delete(&model.MapVersion{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("route_id = ?", routeID).Delete(&model.UnlistedRoute{}).Error
+	})
+}
+
+func (r *DBRepository) UpdateStats(m *model.Map) error {
+	return r.db.Save(m).Error
 }
 
 func (r *DBRepository) GetByRouteID(routeID uuid.UUID) (*model.Map, error) {
 	var m model.Map
-	if err := r.db.Where("route_id = ?", routeID).First(&m).Error; err != nil {
+	err := r.db.Where("route_id = ?", routeID).First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
 		return nil, err
 	}
 	return &m, nil
@@ -46,3 +95,167 @@ func (r *DBRepository) List() ([]model.Map, error) {
 	}
 	return maps, nil
 }
+
+func (r *DBRepository) SetRouteListed(routeID uuid.UUID, listed bool) error {
+	if listed {
+		return r.db.Where("route_id = ?", routeID).Delete(&model.UnlistedRoute{}).Error
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.UnlistedRoute{RouteID: routeID}).Error
+}
+
+func (r *DBRepository) ListUnlistedRoutes() ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := r.db.Model(&model.UnlistedRoute{}).Pluck("route_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *DBRepository) IsRouteListed(routeID uuid.UUID) (bool, error) {
+	var n int64
+	if err := r.db.Model(&model.UnlistedRoute{}).Where("route_id = ?", routeID).Count(&n).Error; err != nil {
+		return false, err
+	}
+	return n == 0, nil
+}
+
+func (r *DBRepository) SetPrivacyZones(userID uuid.UUID, zones []model.PrivacyZone) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.PrivacyZone{}).Error; err != nil {
+			return err
+		}
+		if len(zones) == 0 {
+			return nil
+		}
+		for i := range zones {
+			zones[i].UserID = userID
+		}
+		return tx.Create(&zones).Error
+	})
+}
+
+func (r *DBRepository) ListPrivacyZones() ([]model.PrivacyZone, error) {
+	var zones []model.PrivacyZone
+	if err := r.db.Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+func (r *DBRepository) SetWorkoutTrack(workoutID, userID uuid.UUID, geoJSON string) error {
+	var existing model.Track
+	err := r.db.Where("workout_id = ?", workoutID).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		track := model.Track{ID: uuid.New(), WorkoutID: workoutID, UserID: userID, GeoJSON: geoJSON}
+		return r.db.Create(&track).Error
+	}
+	if err != nil {
+		return err
+	}
+	existing.UserID = userID
+	existing.GeoJSON = geoJSON
+	return r.db.Save(&existing).Error
+}
+
+func (r *DBRepository) GetWorkoutTrack(workoutID uuid.UUID) (*model.Track, error) {
+	var t model.Track
+	err := r.db.Where("workout_id = ?", workoutID).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *DBRepository) ListWorkoutTracks() ([]model.Track, error) {
+	var tracks []model.Track
+	if err := r.db.Find(&tracks).Error; err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+func (r *DBRepository) ListVersions(routeID uuid.UUID) ([]model.MapVersion, error) {
+	var versions []model.MapVersion
+	err := r.db.Omit("geojson").
+		Where("route_id = ?", routeID).
+		Order("version DESC").
+		Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (r *DBRepository) GetVersion(routeID uuid.UUID, version int) (*model.MapVersion, error) {
+	var v model.MapVersion
+	err := r.db.Where("route_id = ? AND version = ?", routeID, version).First(&v).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (r *DBRepository) CreatePOI(p *model.POI) error {
+	p.ID = uuid.New()
+	return r.db.Create(p).Error
+}
+
+func (r *DBRepository) GetPOI(id uuid.UUID) (*model.POI, error) {
+	var p model.POI
+	err := r.db.Where("id = ?", id).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *DBRepository) UpdatePOI(p *model.POI) error {
+	res := r.db.Model(&model.POI{}).Where("id = ?", p.ID).Updates(map[string]interface{}{
+		"type":        p.Type,
+		"lat":         p.Lat,
+		"lon":         p.Lon,
+		"name":        p.Name,
+		"description": p.Description,
+		"photo_ref":   p.PhotoRef,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *DBRepository) DeletePOI(id uuid.UUID) error {
+	res := r.db.Where("id = ?", id).Delete(&model.POI{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *DBRepository) ListPOIsInBBox(minLat, minLon, maxLat, maxLon float64, types []model.POIType) ([]model.POI, error) {
+	q := r.db.Where("lat BETWEEN ? AND ? AND lon BETWEEN ? AND ?", minLat, maxLat, minLon, maxLon)
+	if len(types) > 0 {
+		q = q.Where("type IN ?", types)
+	}
+	var pois []model.POI
+	if err := q.Find(&pois).Error; err != nil {
+		return nil, err
+	}
+	return pois, nil
+}
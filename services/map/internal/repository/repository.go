@@ -1,13 +1,51 @@
 package repository
 
 import (
+	"errors"
+
 	"trailbox/services/map/internal/model"
 
 	"github.com/google/uuid"
 )
 
+// ErrNotFound se devuelve cuando no existe el mapa o track pedido.
+var ErrNotFound = errors.New("not found")
+
 type Repository interface {
-	SetRouteMap(routeID uuid.UUID, geoJSON string) error
+	// SetRouteMap crea o reemplaza el mapa de m.RouteID y agrega v al
+	// historial como la siguiente versión. Al volver, m.Version y v.Version
+	// tienen el número asignado.
+	SetRouteMap(m *model.Map, v *model.MapVersion) error
+	// UpdateStats guarda métricas recalculadas sin crear una versión.
+	UpdateStats(m *model.Map) error
 	GetByRouteID(routeID uuid.UUID) (*model.Map, error)
+	// DeleteRouteMap borra el mapa y todo su historial.
+	DeleteRouteMap(routeID uuid.UUID) error
 	List() ([]model.Map, error)
+
+	// SetRouteListed guarda si la ruta es pública; puede llamarse antes de
+	// que tenga geometría.
+	SetRouteListed(routeID uuid.UUID, listed bool) error
+	ListUnlistedRoutes() ([]uuid.UUID, error)
+	IsRouteListed(routeID uuid.UUID) (bool, error)
+
+	// SetPrivacyZones reemplaza las zonas de userID.
+	SetPrivacyZones(userID uuid.UUID, zones []model.PrivacyZone) error
+	ListPrivacyZones() ([]model.PrivacyZone, error)
+
+	// ListVersions devuelve el historial sin la geometría, de la más nueva a
+	// la más vieja.
+	ListVersions(routeID uuid.UUID) ([]model.MapVersion, error)
+	GetVersion(routeID uuid.UUID, version int) (*model.MapVersion, error)
+
+	CreatePOI(p *model.POI) error
+	GetPOI(id uuid.UUID) (*model.POI, error)
+	UpdatePOI(p *model.POI) error
+	DeletePOI(id uuid.UUID) error
+	// ListPOIsInBBox filtra por caja y, si types no está vacío, por tipo.
+	ListPOIsInBBox(minLat, minLon, maxLat, maxLon float64, types []model.POIType) ([]model.POI, error)
+
+	SetWorkoutTrack(workoutID, userID uuid.UUID, geoJSON string) error
+	GetWorkoutTrack(workoutID uuid.UUID) (*model.Track, error)
+	ListWorkoutTracks() ([]model.Track, error)
 }
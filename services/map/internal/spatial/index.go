@@ -0,0 +1,275 @@
+package spatial
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+
+	"trailbox/services/map/internal/geo"
+)
+
+const metersPerDegree = 111320.0
+
+// Match es una ruta encontrada por una búsqueda espacial.
+type Match struct {
+	Entry     *Entry
+	DistanceM float64   // distancia desde el punto buscado; 0 en búsquedas por caja
+	Nearest   geo.Point // punto de la ruta más cercano al buscado
+}
+
+// Index guarda las rutas en un R-tree en memoria. Es seguro para uso
+// concurrente; las búsquedas no bloquean a las escrituras más de lo que
+// tarda reconstruir el árbol.
+type Index struct {
+	mu      sync.RWMutex
+	entries map[string]*Entry
+	tree    *rtree
+}
+
+func NewIndex() *Index {
+	return &Index{entries: map[string]*Entry{}, tree: &rtree{}}
+}
+
+// NewEntry arma la entrada de una ruta a partir de sus líneas, sin lo que
+// cae dentro de hide (las zonas de privacidad del dueño): teselas, búsqueda
+// y planificador solo ven lo que queda. geoJSON solo se usa para calcular la
+// versión, que también cambia con las zonas. Devuelve nil si no queda nada.
+func NewEntry(routeID, name, geoJSON string, lines [][]geo.Point, hide []geo.Circle) *Entry {
+	lines = geo.HideLines(lines, hide)
+	if len(lines) == 0 {
+		return nil
+	}
+	s := geo.ComputeStats(lines, 2)
+	h := fnv.New64a()
+	h.Write([]byte(geoJSON))
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+	for _, z := range hide {
+		fmt.Fprintf(h, "\x00%.6f,%.6f,%.0f", z.Center.Lat, z.Center.Lon, z.RadiusM)
+	}
+	return &Entry{
+		RouteID: routeID,
+		Name:    name,
+		BBox:    s.BBox,
+		Lines:   lines,
+		LengthM: s.DistanceM,
+		Version: h.Sum64(),
+	}
+}
+
+// Replace reemplaza todo el contenido del índice y devuelve las cajas de las
+// rutas que cambiaron, aparecieron o desaparecieron.
+func (ix *Index) Replace(entries []*Entry) []geo.BBox {
+	m := make(map[string]*Entry, len(entries))
+	for _, e := range entries {
+		m[e.RouteID] = e
+	}
+	tree := buildTree(entries)
+
+	ix.mu.Lock()
+	old := ix.entries
+	ix.entries, ix.tree = m, tree
+	ix.mu.Unlock()
+
+	var changed []geo.BBox
+	for id, e := range m {
+		prev, ok := old[id]
+		if !ok {
+			changed = append(changed, e.BBox)
+		} else if prev.Version != e.Version {
+			changed = append(changed, prev.BBox, e.BBox)
+		}
+	}
+	for id, prev := range old {
+		if _, ok := m[id]; !ok {
+			changed = append(changed, prev.BBox)
+		}
+	}
+	return changed
+}
+
+// Upsert agrega o reemplaza una ruta y reconstruye el árbol. Devuelve la caja
+// anterior de la ruta, si ya estaba indexada.
+func (ix *Index) Upsert(e *Entry) (geo.BBox, bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	prev, existed := ix.entries[e.RouteID]
+	ix.entries[e.RouteID] = e
+	all := make([]*Entry, 0, len(ix.entries))
+	for _, v := range ix.entries {
+		all = append(all, v)
+	}
+	ix.tree = buildTree(all)
+	if !existed {
+		return geo.BBox{}, false
+	}
+	return prev.BBox, true
+}
+
+// Remove quita una ruta y reconstruye el árbol. Devuelve su caja, si estaba
+// indexada.
+func (ix *Index) Remove(routeID string) (geo.BBox, bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	prev, ok := ix.entries[routeID]
+	if !ok {
+		return geo.BBox{}, false
+	}
+	delete(ix.entries, routeID)
+	all := make([]*Entry, 0, len(ix.entries))
+	for _, v := range ix.entries {
+		all = append(all, v)
+	}
+	ix.tree = buildTree(all)
+	return prev.BBox, true
+}
+
+// Intersecting devuelve las rutas con algún tramo dentro de la caja, sin
+// orden ni límite.
+func (ix *Index) Intersecting(box geo.BBox) []*Entry {
+	var out []*Entry
+	ix.mu.RLock()
+	ix.tree.search(box, func(e *Entry) {
+		if linesIntersect(e.Lines, box) {
+			out = append(out, e)
+		}
+	})
+	ix.mu.RUnlock()
+	return out
+}
+
+// Entries devuelve todas las rutas indexadas, sin orden.
+func (ix *Index) Entries() []*Entry {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	out := make([]*Entry, 0, len(ix.entries))
+	for _, e := range ix.entries {
+		out = append(out, e)
+	}
+	return out
+}
+
+// Len devuelve la cantidad de rutas indexadas.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.entries)
+}
+
+// Near devuelve las rutas que pasan a menos de radiusM del punto, ordenadas
+// por distancia.
+func (ix *Index) Near(lat, lon, radiusM float64, limit int) []Match {
+	dLat := radiusM / metersPerDegree
+	dLon := radiusM / (metersPerDegree * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+	box := geo.BBox{MinLon: lon - dLon, MinLat: lat - dLat, MaxLon: lon + dLon, MaxLat: lat + dLat}
+	origin := geo.Point{Lat: lat, Lon: lon}
+
+	var out []Match
+	ix.mu.RLock()
+	ix.tree.search(box, func(e *Entry) {
+		d, nearest := distanceToLines(origin, e.Lines)
+		if d <= radiusM {
+			out = append(out, Match{Entry: e, DistanceM: d, Nearest: nearest})
+		}
+	})
+	ix.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].DistanceM < out[j].DistanceM })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// InBBox devuelve las rutas con al menos un tramo dentro de la caja,
+// ordenadas de la más larga a la más corta.
+func (ix *Index) InBBox(box geo.BBox, limit int) []Match {
+	var out []Match
+	ix.mu.RLock()
+	ix.tree.search(box, func(e *Entry) {
+		if linesIntersect(e.Lines, box) {
+			out = append(out, Match{Entry: e, Nearest: e.Lines[0][0]})
+		}
+	})
+	ix.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Entry.LengthM != out[j].Entry.LengthM {
+			return out[i].Entry.LengthM > out[j].Entry.LengthM
+		}
+		return out[i].Entry.RouteID < out[j].Entry.RouteID
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// distanceToLines proyecta a un plano local alrededor del origen
+// (equirectangular), suficiente para radios de decenas de kilómetros.
+func distanceToLines(origin geo.Point, lines [][]geo.Point) (float64, geo.Point) {
+	cosLat := math.Cos(origin.Lat * math.Pi / 180)
+	toXY := func(p geo.Point) (float64, float64) {
+		return (p.Lon - origin.Lon) * cosLat * metersPerDegree, (p.Lat - origin.Lat) * metersPerDegree
+	}
+
+	best, nearest := math.Inf(1), geo.Point{}
+	for _, line := range lines {
+		for i := 0; i+1 < len(line); i++ {
+			ax, ay := toXY(line[i])
+			bx, by := toXY(line[i+1])
+			t := 0.0
+			if dx, dy := bx-ax, by-ay; dx != 0 || dy != 0 {
+				t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/(dx*dx+dy*dy)))
+			}
+			px, py := ax+t*(bx-ax), ay+t*(by-ay)
+			if d := math.Hypot(px, py); d < best {
+				best = d
+				nearest = geo.Point{
+					Lon: line[i].Lon + t*(line[i+1].Lon-line[i].Lon),
+					Lat: line[i].Lat + t*(line[i+1].Lat-line[i].Lat),
+				}
+			}
+		}
+	}
+	return best, nearest
+}
+
+func linesIntersect(lines [][]geo.Point, box geo.BBox) bool {
+	for _, line := range lines {
+		for i := 0; i+1 < len(line); i++ {
+			if segmentIntersects(line[i], line[i+1], box) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// segmentIntersects recorta el segmento contra la caja (Liang-Barsky).
+func segmentIntersects(a, b geo.Point, box geo.BBox) bool {
+	dx, dy := b.Lon-a.Lon, b.Lat-a.Lat
+	t0, t1 := 0.0, 1.0
+	clip := func(p, q float64) bool {
+		if p == 0 {
+			return q >= 0
+		}
+		r := q / p
+		if p < 0 {
+			if r > t1 {
+				return false
+			}
+			t0 = math.Max(t0, r)
+		} else {
+			if r < t0 {
+				return false
+			}
+			t1 = math.Min(t1, r)
+		}
+		return true
+	}
+	return clip(-dx, a.Lon-box.MinLon) && clip(dx, box.MaxLon-a.Lon) &&
+		clip(-dy, a.Lat-box.MinLat) && clip(dy, box.MaxLat-a.Lat)
+}
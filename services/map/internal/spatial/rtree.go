@@ -0,0 +1,111 @@
+package spatial
+
+import (
+	"math"
+	"sort"
+
+	"trailbox/services/map/internal/geo"
+)
+
+// Capacidad de cada nodo del R-tree.
+const nodeCapacity = 16
+
+// Entry es una ruta indexada con su geometría.
+type Entry struct {
+	RouteID string
+	Name    string
+	BBox    geo.BBox
+	Lines   [][]geo.Point
+	LengthM float64
+	Version uint64 // hash de la geometría y el nombre; detecta cambios al refrescar
+}
+
+type node struct {
+	box      geo.BBox
+	children []*node
+	entry    *Entry // solo en las hojas
+}
+
+// rtree es un R-tree estático empaquetado con Sort-Tile-Recursive. No admite
+// inserciones: el Index lo reconstruye completo cuando cambia una ruta.
+type rtree struct {
+	root *node
+}
+
+func buildTree(entries []*Entry) *rtree {
+	if len(entries) == 0 {
+		return &rtree{}
+	}
+	level := make([]*node, 0, len(entries))
+	for _, e := range entries {
+		level = append(level, &node{box: e.BBox, entry: e})
+	}
+	for len(level) > 1 {
+		level = packLevel(level)
+	}
+	return &rtree{root: level[0]}
+}
+
+// packLevel agrupa los nodos en padres de nodeCapacity hijos: se ordenan por
+// longitud, se cortan en franjas verticales y cada franja se ordena por
+// latitud.
+func packLevel(nodes []*node) []*node {
+	parents := int(math.Ceil(float64(len(nodes)) / nodeCapacity))
+	slices := int(math.Ceil(math.Sqrt(float64(parents))))
+	perSlice := slices * nodeCapacity
+
+	sort.Slice(nodes, func(i, j int) bool { return centerLon(nodes[i].box) < centerLon(nodes[j].box) })
+
+	out := make([]*node, 0, parents)
+	for start := 0; start < len(nodes); start += perSlice {
+		end := min(start+perSlice, len(nodes))
+		slice := nodes[start:end]
+		sort.Slice(slice, func(i, j int) bool { return centerLat(slice[i].box) < centerLat(slice[j].box) })
+		for k := 0; k < len(slice); k += nodeCapacity {
+			children := slice[k:min(k+nodeCapacity, len(slice))]
+			parent := &node{box: children[0].box, children: append([]*node(nil), children...)}
+			for _, c := range children[1:] {
+				parent.box = union(parent.box, c.box)
+			}
+			out = append(out, parent)
+		}
+	}
+	return out
+}
+
+// search llama a fn con cada entrada cuya caja intersecta box.
+func (t *rtree) search(box geo.BBox, fn func(*Entry)) {
+	if t.root == nil {
+		return
+	}
+	stack := []*node{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !intersects(n.box, box) {
+			continue
+		}
+		if n.entry != nil {
+			fn(n.entry)
+			continue
+		}
+		stack = append(stack, n.children...)
+	}
+}
+
+func centerLon(b geo.BBox) float64 { return (b.MinLon + b.MaxLon) / 2 }
+func centerLat(b geo.BBox) float64 { return (b.MinLat + b.MaxLat) / 2 }
+
+func union(a, b geo.BBox) geo.BBox {
+	return geo.BBox{
+		MinLon: math.Min(a.MinLon, b.MinLon),
+		MinLat: math.Min(a.MinLat, b.MinLat),
+		MaxLon: math.Max(a.MaxLon, b.MaxLon),
+		MaxLat: math.Max(a.MaxLat, b.MaxLat),
+	}
+}
+
+func intersects(a, b geo.BBox) bool {
+	return a.MinLon <= b.MaxLon && b.MinLon <= a.MaxLon &&
+		a.MinLat <= b.MaxLat && b.MinLat <= a.MaxLat
+}
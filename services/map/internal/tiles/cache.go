@@ -0,0 +1,89 @@
+package tiles
+
+import (
+	"container/list"
+	"sync"
+
+	"trailbox/services/map/internal/geo"
+)
+
+// DefaultCacheSize es la cantidad de teselas que se guardan en memoria.
+const DefaultCacheSize = 4096
+
+type key struct{ z, x, y int }
+
+type cacheEntry struct {
+	key  key
+	box  geo.BBox
+	data []byte
+}
+
+// Cache es un LRU de teselas ya codificadas. Invalidate borra solo las que
+// cruzan la zona que cambió.
+type Cache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // frente = más reciente
+	items map[key]*list.Element
+}
+
+func NewCache(size int) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &Cache{size: size, order: list.New(), items: map[key]*list.Element{}}
+}
+
+func (c *Cache) Get(z, x, y int) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key{z, x, y}]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).data, true
+}
+
+func (c *Cache) Put(z, x, y int, data []byte) {
+	k := key{z, x, y}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[k]; ok {
+		el.Value.(*cacheEntry).data = data
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[k] = c.order.PushFront(&cacheEntry{key: k, box: Bounds(z, x, y), data: data})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Invalidate borra las teselas que intersectan alguna de las cajas.
+func (c *Cache) Invalidate(boxes ...geo.BBox) {
+	if len(boxes) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		e := el.Value.(*cacheEntry)
+		for _, b := range boxes {
+			if intersects(e.box, b) {
+				c.order.Remove(el)
+				delete(c.items, e.key)
+				break
+			}
+		}
+		el = next
+	}
+}
+
+func intersects(a, b geo.BBox) bool {
+	return a.MinLon <= b.MaxLon && b.MinLon <= a.MaxLon &&
+		a.MinLat <= b.MaxLat && b.MinLat <= a.MaxLat
+}
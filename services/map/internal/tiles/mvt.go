@@ -0,0 +1,191 @@
+package tiles
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Codificador mínimo de Mapbox Vector Tile 2.1: una capa con features
+// LineString y atributos string/double. Los números de campo son los de
+// vector_tile.proto.
+const (
+	tileLayers = 3
+
+	layerName     = 1
+	layerFeatures = 2
+	layerKeys     = 3
+	layerValues   = 4
+	layerExtent   = 5
+	layerVersion  = 15
+
+	featureTags     = 2
+	featureType     = 3
+	featureGeometry = 4
+
+	valueString = 1
+	valueDouble = 3
+
+	geomLineString = 2
+
+	cmdMoveTo = 1
+	cmdLineTo = 2
+)
+
+// Feature es una línea (o varias partes) en coordenadas de tesela.
+type Feature struct {
+	Parts      [][][2]int32
+	Properties []Property
+}
+
+// Property es un atributo del feature; Value debe ser string o float64.
+type Property struct {
+	Key   string
+	Value interface{}
+}
+
+// layer acumula claves y valores sin repetir, como pide la especificación.
+type layer struct {
+	name     string
+	extent   uint32
+	keys     []string
+	keyIdx   map[string]uint32
+	values   [][]byte
+	valueIdx map[string]uint32
+	features [][]byte
+}
+
+func newLayer(name string, extent uint32) *layer {
+	return &layer{name: name, extent: extent, keyIdx: map[string]uint32{}, valueIdx: map[string]uint32{}}
+}
+
+func (l *layer) key(k string) uint32 {
+	if i, ok := l.keyIdx[k]; ok {
+		return i
+	}
+	i := uint32(len(l.keys))
+	l.keys = append(l.keys, k)
+	l.keyIdx[k] = i
+	return i
+}
+
+func (l *layer) value(v interface{}) (uint32, bool) {
+	var b []byte
+	switch val := v.(type) {
+	case string:
+		b = protowire.AppendTag(b, valueString, protowire.BytesType)
+		b = protowire.AppendString(b, val)
+	case float64:
+		b = protowire.AppendTag(b, valueDouble, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(val))
+	default:
+		return 0, false
+	}
+	if i, ok := l.valueIdx[string(b)]; ok {
+		return i, true
+	}
+	i := uint32(len(l.values))
+	l.values = append(l.values, b)
+	l.valueIdx[string(b)] = i
+	return i, true
+}
+
+func (l *layer) add(f Feature) {
+	geom := encodeGeometry(f.Parts)
+	if len(geom) == 0 {
+		return
+	}
+	var tags []uint64
+	for _, p := range f.Properties {
+		if vi, ok := l.value(p.Value); ok {
+			tags = append(tags, uint64(l.key(p.Key)), uint64(vi))
+		}
+	}
+
+	var b []byte
+	b = appendPacked(b, featureTags, tags)
+	b = protowire.AppendTag(b, featureType, protowire.VarintType)
+	b = protowire.AppendVarint(b, geomLineString)
+	b = appendPacked(b, featureGeometry, geom)
+	l.features = append(l.features, b)
+}
+
+func (l *layer) encode() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, layerVersion, protowire.VarintType)
+	b = protowire.AppendVarint(b, 2)
+	b = protowire.AppendTag(b, layerName, protowire.BytesType)
+	b = protowire.AppendString(b, l.name)
+	for _, f := range l.features {
+		b = protowire.AppendTag(b, layerFeatures, protowire.BytesType)
+		b = protowire.AppendBytes(b, f)
+	}
+	for _, k := range l.keys {
+		b = protowire.AppendTag(b, layerKeys, protowire.BytesType)
+		b = protowire.AppendString(b, k)
+	}
+	for _, v := range l.values {
+		b = protowire.AppendTag(b, layerValues, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	b = protowire.AppendTag(b, layerExtent, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(l.extent))
+	return b
+}
+
+// encodeTile arma el Tile con una sola capa; sin features devuelve vacío.
+func encodeTile(l *layer) []byte {
+	if len(l.features) == 0 {
+		return nil
+	}
+	var b []byte
+	b = protowire.AppendTag(b, tileLayers, protowire.BytesType)
+	return protowire.AppendBytes(b, l.encode())
+}
+
+// encodeGeometry genera MoveTo + LineTo por cada parte, con coordenadas
+// relativas al cursor y en zigzag. Descarta puntos repetidos y partes de
+// menos de dos puntos distintos.
+func encodeGeometry(parts [][][2]int32) []uint64 {
+	var out []uint64
+	var cx, cy int32
+	for _, part := range parts {
+		pts := make([][2]int32, 0, len(part))
+		for _, p := range part {
+			if len(pts) == 0 || pts[len(pts)-1] != p {
+				pts = append(pts, p)
+			}
+		}
+		if len(pts) < 2 {
+			continue
+		}
+		out = append(out, command(cmdMoveTo, 1), zigzag(pts[0][0]-cx), zigzag(pts[0][1]-cy))
+		cx, cy = pts[0][0], pts[0][1]
+		out = append(out, command(cmdLineTo, len(pts)-1))
+		for _, p := range pts[1:] {
+			out = append(out, zigzag(p[0]-cx), zigzag(p[1]-cy))
+			cx, cy = p[0], p[1]
+		}
+	}
+	return out
+}
+
+func command(id, count int) uint64 {
+	return uint64(id&0x7) | uint64(count)<<3
+}
+
+func zigzag(n int32) uint64 {
+	return uint64(uint32((n << 1) ^ (n >> 31)))
+}
+
+func appendPacked(b []byte, num protowire.Number, vals []uint64) []byte {
+	if len(vals) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, v := range vals {
+		packed = protowire.AppendVarint(packed, v)
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, packed)
+}
@@ -0,0 +1,86 @@
+package tiles
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "reescribe los archivos golden de testdata")
+
+func TestEncodeGeometry(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts [][][2]int32
+		want  []uint64
+	}{
+		// Ejemplo de LineString de la especificación MVT 2.1 (4.3.5.2).
+		{"spec line", [][][2]int32{{{2, 2}, {2, 10}, {10, 10}}}, []uint64{9, 4, 4, 18, 0, 16, 16, 0}},
+		// Segunda parte relativa al cursor que dejó la primera.
+		{"multi line", [][][2]int32{{{2, 2}, {2, 10}, {10, 10}}, {{1, 1}, {3, 5}}}, []uint64{9, 4, 4, 18, 0, 16, 16, 0, 9, 17, 17, 10, 4, 8}},
+		{"repeated points dropped", [][][2]int32{{{2, 2}, {2, 2}, {2, 10}}}, []uint64{9, 4, 4, 10, 0, 16}},
+		{"degenerate part skipped", [][][2]int32{{{5, 5}, {5, 5}}}, nil},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeGeometry(tt.parts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("encodeGeometry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZigzag(t *testing.T) {
+	for n, want := range map[int32]uint64{0: 0, -1: 1, 1: 2, -2: 3, 2: 4, 2147483647: 4294967294, -2147483648: 4294967295} {
+		if got := zigzag(n); got != want {
+			t.Errorf("zigzag(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestEncodeTileEmpty(t *testing.T) {
+	l := newLayer("routes", 4096)
+	l.add(Feature{Parts: [][][2]int32{{{1, 1}}}})
+	if got := encodeTile(l); got != nil {
+		t.Errorf("encodeTile() = %x, want nil for a layer without features", got)
+	}
+}
+
+func TestEncodeTileGolden(t *testing.T) {
+	l := newLayer("routes", 4096)
+	l.add(Feature{
+		Parts: [][][2]int32{{{2, 2}, {2, 10}, {10, 10}}},
+		Properties: []Property{
+			{Key: "route_id", Value: "r1"},
+			{Key: "distance_m", Value: 1500.0},
+			{Key: "ignored", Value: 3}, // solo string y float64
+		},
+	})
+	// Las claves y los valores repetidos se reutilizan.
+	l.add(Feature{
+		Parts:      [][][2]int32{{{0, 0}, {4096, 4096}}},
+		Properties: []Property{{Key: "route_id", Value: "r2"}, {Key: "distance_m", Value: 1500.0}},
+	})
+	if len(l.keys) != 2 || len(l.values) != 3 {
+		t.Fatalf("keys = %v, values = %d; want 2 keys and 3 values", l.keys, len(l.values))
+	}
+
+	got := encodeTile(l)
+	golden := filepath.Join("testdata", "two_lines.mvt")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encodeTile() = %x\nwant %x", got, want)
+	}
+}
@@ -0,0 +1,181 @@
+package tiles
+
+import (
+	"errors"
+	"math"
+
+	"trailbox/services/map/internal/geo"
+)
+
+const (
+	// Extent y buffer estándar de las teselas vectoriales.
+	Extent = 4096
+	buffer = 64
+
+	MaxZoom = 22
+
+	// LayerName es la capa que leen los estilos del frontend.
+	LayerName = "routes"
+)
+
+// ErrInvalidTile se devuelve para coordenadas fuera de rango.
+var ErrInvalidTile = errors.New("tile coordinates out of range")
+
+// Route es una ruta a dibujar en la tesela.
+type Route struct {
+	ID        string
+	Name      string
+	DistanceM float64
+	Lines     [][]geo.Point
+}
+
+// Validate comprueba que z/x/y exista en el esquema XYZ.
+func Validate(z, x, y int) error {
+	if z < 0 || z > MaxZoom {
+		return ErrInvalidTile
+	}
+	n := 1 << z
+	if x < 0 || y < 0 || x >= n || y >= n {
+		return ErrInvalidTile
+	}
+	return nil
+}
+
+// Bounds devuelve la caja lon/lat de la tesela ampliada con el buffer, para
+// buscar las rutas que la cruzan.
+func Bounds(z, x, y int) geo.BBox {
+	pad := float64(buffer) / Extent
+	n := math.Exp2(float64(z))
+	return geo.BBox{
+		MinLon: tileLon(float64(x)-pad, n),
+		MaxLon: tileLon(float64(x+1)+pad, n),
+		MinLat: tileLat(float64(y+1)+pad, n),
+		MaxLat: tileLat(float64(y)-pad, n),
+	}
+}
+
+func tileLon(x, n float64) float64 {
+	return math.Max(-180, math.Min(180, x/n*360-180))
+}
+
+func tileLat(y, n float64) float64 {
+	lat := math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+	return math.Max(-85.0511, math.Min(85.0511, lat))
+}
+
+// Render codifica las rutas que cruzan la tesela como MVT. Las líneas se
+// simplifican a medio píxel del zoom y se recortan al área con buffer.
+func Render(z, x, y int, routes []Route) []byte {
+	l := newLayer(LayerName, Extent)
+	n := math.Exp2(float64(z))
+	for _, r := range routes {
+		var parts [][][2]int32
+		for _, line := range r.Lines {
+			tol := geo.ToleranceForZoom(z, line[0].Lat) / 2
+			pts := geo.Simplify(line, tol)
+			proj := make([][2]float64, len(pts))
+			for i, p := range pts {
+				wx, wy := Project(p, n)
+				proj[i] = [2]float64{(wx - float64(x)) * Extent, (wy - float64(y)) * Extent}
+			}
+			parts = append(parts, clip(proj, -buffer, Extent+buffer)...)
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		l.add(Feature{
+			Parts: parts,
+			Properties: []Property{
+				{Key: "route_id", Value: r.ID},
+				{Key: "name", Value: r.Name},
+				{Key: "distance_m", Value: math.Round(r.DistanceM)},
+			},
+		})
+	}
+	return encodeTile(l)
+}
+
+// Project pasa lon/lat a coordenadas de mundo Web Mercator en unidades de
+// tesela del zoom (n = 2^z).
+func Project(p geo.Point, n float64) (float64, float64) {
+	lat := math.Max(-85.0511, math.Min(85.0511, p.Lat)) * math.Pi / 180
+	x := (p.Lon + 180) / 360 * n
+	y := (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2 * n
+	return x, y
+}
+
+// clip recorta la polilínea al cuadrado [min, max] y devuelve los tramos que
+// quedan dentro, ya redondeados a enteros.
+func clip(line [][2]float64, min, max float64) [][][2]int32 {
+	var (
+		parts   [][][2]int32
+		current [][2]int32
+	)
+	flush := func() {
+		if len(current) >= 2 {
+			parts = append(parts, current)
+		}
+		current = nil
+	}
+	round := func(p [2]float64) [2]int32 {
+		return [2]int32{int32(math.Round(p[0])), int32(math.Round(p[1]))}
+	}
+
+	for i := 0; i+1 < len(line); i++ {
+		a, b, ok := ClipSegment(line[i], line[i+1], min, max)
+		if !ok {
+			flush()
+			continue
+		}
+		if len(current) == 0 || current[len(current)-1] != round(a) {
+			flush()
+			current = append(current, round(a))
+		}
+		current = append(current, round(b))
+		// Si el segmento sale de la caja, el tramo termina aquí.
+		if b != line[i+1] {
+			flush()
+		}
+	}
+	flush()
+	return parts
+}
+
+// ClipSegment aplica Liang-Barsky al segmento ab y lo recorta al cuadrado
+// [min, max]; false si queda fuera.
+func ClipSegment(a, b [2]float64, min, max float64) ([2]float64, [2]float64, bool) {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t0, t1 := 0.0, 1.0
+	for _, e := range [][2]float64{
+		{-dx, a[0] - min}, {dx, max - a[0]},
+		{-dy, a[1] - min}, {dy, max - a[1]},
+	} {
+		p, q := e[0], e[1]
+		if p == 0 {
+			if q < 0 {
+				return a, b, false
+			}
+			continue
+		}
+		r := q / p
+		if p < 0 {
+			if r > t1 {
+				return a, b, false
+			}
+			t0 = math.Max(t0, r)
+		} else {
+			if r < t0 {
+				return a, b, false
+			}
+			t1 = math.Min(t1, r)
+		}
+	}
+	ca, cb := a, b
+	if t0 > 0 {
+		ca = [2]float64{a[0] + t0*dx, a[1] + t0*dy}
+	}
+	if t1 < 1 {
+		cb = [2]float64{a[0] + t1*dx, a[1] + t1*dy}
+	}
+	return ca, cb, true
+}
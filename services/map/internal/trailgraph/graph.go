@@ -0,0 +1,190 @@
+// Package trailgraph arma una red de senderos a partir de las geometrías de
+// las rutas guardadas y busca caminos sobre ella. Los vértices de rutas
+// distintas que quedan a menos de SnapM se funden en un mismo nodo, así que
+// dos rutas que comparten un tramo o se cruzan quedan conectadas.
+package trailgraph
+
+import (
+	"errors"
+	"math"
+
+	"trailbox/services/map/internal/geo"
+)
+
+const (
+	// SnapM es la distancia máxima entre vértices que se consideran el mismo
+	// punto del sendero.
+	SnapM = 15.0
+	// Las líneas se aclaran a puntos separados al menos segmentM/2 y se
+	// densifican a tramos de como mucho segmentM, para que los tramos
+	// compartidos caigan sobre los mismos nodos aunque cada ruta tenga sus
+	// vértices en otro sitio. No se simplifican con Douglas-Peucker: se
+	// perdería la altura de los puntos intermedios.
+	segmentM = 20.0
+
+	metersPerDegree = 111320.0
+)
+
+var (
+	// ErrNoTrailNearby indica que una parada está lejos de cualquier sendero.
+	ErrNoTrailNearby = errors.New("no trail near the requested point")
+	// ErrNoPath indica que las paradas están en senderos no conectados.
+	ErrNoPath = errors.New("no path between the requested points")
+)
+
+// Route es una ruta guardada que aporta sus líneas al grafo.
+type Route struct {
+	ID    string
+	Lines [][]geo.Point
+}
+
+type edge struct {
+	to    int32
+	distM float64
+	upM   float64 // subida yendo hacia to
+	route int32   // índice en Graph.routes
+}
+
+type cell struct{ lat, lon int32 }
+
+// Graph es inmutable una vez construido; se puede consultar desde varias
+// goroutines a la vez.
+type Graph struct {
+	nodes  []geo.Point
+	adj    [][]edge
+	routes []string
+	cells  map[cell][]int32
+}
+
+// Build arma el grafo con todas las rutas.
+func Build(routes []Route) *Graph {
+	g := &Graph{cells: map[cell][]int32{}}
+	for _, r := range routes {
+		ri := int32(len(g.routes))
+		g.routes = append(g.routes, r.ID)
+		for _, line := range r.Lines {
+			prev := int32(-1)
+			for _, p := range densify(thin(line, segmentM/2), segmentM) {
+				n := g.snap(p, prev)
+				if prev >= 0 && n != prev && !g.connected(prev, n) {
+					g.link(prev, n, ri)
+				}
+				prev = n
+			}
+		}
+	}
+	return g
+}
+
+// Len devuelve la cantidad de nodos.
+func (g *Graph) Len() int {
+	return len(g.nodes)
+}
+
+// snap devuelve el nodo a menos de SnapM de p o crea uno nuevo. El nodo
+// anterior de la misma línea no cuenta: si no, los nodos de una ruta irían
+// quedando atrás de sus puntos y no se engancharían con otras rutas.
+func (g *Graph) snap(p geo.Point, prev int32) int32 {
+	if n, _, ok := g.nearest(p, SnapM, prev); ok {
+		return n
+	}
+	n := int32(len(g.nodes))
+	g.nodes = append(g.nodes, p)
+	g.adj = append(g.adj, nil)
+	c := cellOf(p)
+	g.cells[c] = append(g.cells[c], n)
+	return n
+}
+
+func (g *Graph) connected(a, b int32) bool {
+	for _, e := range g.adj[a] {
+		if e.to == b {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Graph) link(a, b, route int32) {
+	pa, pb := g.nodes[a], g.nodes[b]
+	d := geo.Haversine(pa, pb)
+	var up, down float64
+	if pa.HasEle && pb.HasEle {
+		up, down = math.Max(0, pb.Ele-pa.Ele), math.Max(0, pa.Ele-pb.Ele)
+	}
+	g.adj[a] = append(g.adj[a], edge{to: b, distM: d, upM: up, route: route})
+	g.adj[b] = append(g.adj[b], edge{to: a, distM: d, upM: down, route: route})
+}
+
+// Nearest devuelve el nodo más cercano a p dentro de maxM.
+func (g *Graph) Nearest(p geo.Point, maxM float64) (int32, float64, bool) {
+	return g.nearest(p, maxM, -1)
+}
+
+func (g *Graph) nearest(p geo.Point, maxM float64, except int32) (int32, float64, bool) {
+	best, bestD := int32(-1), math.Inf(1)
+	dLat := int32(math.Ceil(maxM / cellM))
+	dLon := int32(math.Ceil(maxM / (cellM * math.Max(math.Cos(p.Lat*math.Pi/180), 0.01))))
+	c := cellOf(p)
+	for i := c.lat - dLat; i <= c.lat+dLat; i++ {
+		for j := c.lon - dLon; j <= c.lon+dLon; j++ {
+			for _, n := range g.cells[cell{i, j}] {
+				if n == except {
+					continue
+				}
+				if d := geo.Haversine(p, g.nodes[n]); d <= maxM && d < bestD {
+					best, bestD = n, d
+				}
+			}
+		}
+	}
+	return best, bestD, best >= 0
+}
+
+// Las celdas miden cellM en latitud; en longitud se estrechan hacia los
+// polos y Nearest lo compensa buscando en más columnas.
+const cellM = 50.0
+
+func cellOf(p geo.Point) cell {
+	deg := cellM / metersPerDegree
+	return cell{int32(math.Floor(p.Lat / deg)), int32(math.Floor(p.Lon / deg))}
+}
+
+// thin descarta los puntos a menos de minM del último que se conservó. El
+// último punto de la línea se conserva siempre.
+func thin(line []geo.Point, minM float64) []geo.Point {
+	if len(line) < 3 {
+		return line
+	}
+	out := []geo.Point{line[0]}
+	for _, p := range line[1 : len(line)-1] {
+		if geo.Haversine(out[len(out)-1], p) >= minM {
+			out = append(out, p)
+		}
+	}
+	return append(out, line[len(line)-1])
+}
+
+// densify agrega puntos intermedios para que ningún tramo mida más de maxM.
+func densify(line []geo.Point, maxM float64) []geo.Point {
+	if len(line) < 2 {
+		return line
+	}
+	out := []geo.Point{line[0]}
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		if steps := int(math.Ceil(geo.Haversine(a, b) / maxM)); steps > 1 {
+			for s := 1; s < steps; s++ {
+				t := float64(s) / float64(steps)
+				out = append(out, geo.Point{
+					Lon:    a.Lon + (b.Lon-a.Lon)*t,
+					Lat:    a.Lat + (b.Lat-a.Lat)*t,
+					Ele:    a.Ele + (b.Ele-a.Ele)*t,
+					HasEle: a.HasEle && b.HasEle,
+				})
+			}
+		}
+		out = append(out, b)
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package trailgraph
+
+import (
+	"container/heap"
+	"fmt"
+
+	"trailbox/services/map/internal/geo"
+)
+
+// Optimize elige qué minimiza el planificador.
+type Optimize int
+
+const (
+	OptimizeDistance  Optimize = iota
+	OptimizeElevation          // menos subida, ver climbPenalty
+)
+
+// climbPenalty es cuántos metros de llano "vale" un metro de subida al
+// optimizar por desnivel. Con un valor finito no se aceptan rodeos enormes
+// para ahorrarse una cuesta corta.
+const climbPenalty = 100.0
+
+// Path es el camino encontrado.
+type Path struct {
+	Points   []geo.Point
+	RouteIDs []string // rutas recorridas, en el orden en que se usan
+}
+
+// Plan busca el camino que pasa por las paradas en orden. Cada parada se
+// engancha al nodo más cercano a menos de maxSnapM.
+func (g *Graph) Plan(stops []geo.Point, opt Optimize, maxSnapM float64) (*Path, error) {
+	nodes := make([]int32, len(stops))
+	for i, p := range stops {
+		n, _, ok := g.Nearest(p, maxSnapM)
+		if !ok {
+			return nil, fmt.Errorf("%w: stop %d is more than %.0f m from any trail", ErrNoTrailNearby, i, maxSnapM)
+		}
+		nodes[i] = n
+	}
+
+	path := &Path{}
+	seen := map[int32]bool{}
+	for i := 1; i < len(nodes); i++ {
+		legNodes, legRoutes, err := g.astar(nodes[i-1], nodes[i], opt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: between stop %d and stop %d", err, i-1, i)
+		}
+		// Cada tramo empieza en el nodo con el que terminó el anterior.
+		if i > 1 {
+			legNodes = legNodes[1:]
+		}
+		for _, n := range legNodes {
+			path.Points = append(path.Points, g.nodes[n])
+		}
+		for _, r := range legRoutes {
+			if !seen[r] {
+				seen[r] = true
+				path.RouteIDs = append(path.RouteIDs, g.routes[r])
+			}
+		}
+	}
+	return path, nil
+}
+
+// astar devuelve los nodos del camino de from a to y las rutas de cada
+// arista usada. La heurística es la distancia en línea recta, que nunca
+// sobreestima en ninguno de los dos modos.
+func (g *Graph) astar(from, to int32, opt Optimize) ([]int32, []int32, error) {
+	if from == to {
+		return []int32{from}, nil, nil
+	}
+	goal := g.nodes[to]
+	cost := map[int32]float64{from: 0}
+	prev := map[int32]edge{} // arista por la que se llegó, con to = nodo previo
+	done := map[int32]bool{}
+	open := &queue{{node: from, f: geo.Haversine(g.nodes[from], goal)}}
+
+	for open.Len() > 0 {
+		cur := heap.Pop(open).(item).node
+		if cur == to {
+			break
+		}
+		if done[cur] {
+			continue
+		}
+		done[cur] = true
+		for _, e := range g.adj[cur] {
+			if done[e.to] {
+				continue
+			}
+			c := cost[cur] + e.distM
+			if opt == OptimizeElevation {
+				c += climbPenalty * e.upM
+			}
+			if old, ok := cost[e.to]; ok && old <= c {
+				continue
+			}
+			cost[e.to] = c
+			prev[e.to] = edge{to: cur, route: e.route}
+			heap.Push(open, item{node: e.to, f: c + geo.Haversine(g.nodes[e.to], goal)})
+		}
+	}
+	if _, ok := prev[to]; !ok {
+		return nil, nil, ErrNoPath
+	}
+
+	var nodes, routes []int32
+	for n := to; n != from; n = prev[n].to {
+		nodes = append(nodes, n)
+		routes = append(routes, prev[n].route)
+	}
+	nodes = append(nodes, from)
+	reverse(nodes)
+	reverse(routes)
+	return nodes, routes, nil
+}
+
+func reverse(s []int32) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+type item struct {
+	node int32
+	f    float64
+}
+
+// queue es una cola de prioridad por f = costo + heurística.
+type queue []item
+
+func (q queue) Len() int            { return len(q) }
+func (q queue) Less(i, j int) bool  { return q[i].f < q[j].f }
+func (q queue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *queue) Push(x interface{}) { *q = append(*q, x.(item)) }
+func (q *queue) Pop() interface{} {
+	old := *q
+	it := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return it
+}
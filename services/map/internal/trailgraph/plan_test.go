@@ -0,0 +1,97 @@
+package trailgraph
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"trailbox/services/map/internal/geo"
+)
+
+// En el ecuador 0.001° son ~111 m.
+func pt(lon, lat, ele float64) geo.Point {
+	return geo.Point{Lon: lon, Lat: lat, Ele: ele, HasEle: true}
+}
+
+func TestPlanJoinsCrossingRoutes(t *testing.T) {
+	g := Build([]Route{
+		{ID: "east", Lines: [][]geo.Point{{pt(0, 0, 0), pt(0.01, 0, 0)}}},
+		{ID: "north", Lines: [][]geo.Point{{pt(0.005, -0.005, 0), pt(0.005, 0.005, 0)}}},
+	})
+
+	path, err := g.Plan([]geo.Point{pt(0, 0, 0), pt(0.005, 0.005, 0)}, OptimizeDistance, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"east", "north"}; !reflect.DeepEqual(path.RouteIDs, want) {
+		t.Errorf("RouteIDs = %v, want %v", path.RouteIDs, want)
+	}
+	first, last := path.Points[0], path.Points[len(path.Points)-1]
+	if geo.Haversine(first, pt(0, 0, 0)) > SnapM || geo.Haversine(last, pt(0.005, 0.005, 0)) > SnapM {
+		t.Errorf("path goes from %v to %v", first, last)
+	}
+}
+
+func TestBuildMergesSharedSections(t *testing.T) {
+	// Mismo tramo con los vértices desfasados unos metros.
+	a := Build([]Route{{ID: "a", Lines: [][]geo.Point{{pt(0, 0, 0), pt(0.01, 0, 0)}}}})
+	ab := Build([]Route{
+		{ID: "a", Lines: [][]geo.Point{{pt(0, 0, 0), pt(0.01, 0, 0)}}},
+		{ID: "b", Lines: [][]geo.Point{{pt(0.00003, 0.00003, 0), pt(0.00997, 0.00003, 0)}}},
+	})
+	if ab.Len() != a.Len() {
+		t.Errorf("Len() = %d with the shared route, want %d", ab.Len(), a.Len())
+	}
+}
+
+func TestPlanOptimizeElevation(t *testing.T) {
+	// De P a Q: "hill" es directa con una subida de 50 m; "flat" da un rodeo
+	// de ~670 m más pero sin desnivel.
+	g := Build([]Route{
+		{ID: "hill", Lines: [][]geo.Point{{pt(0, 0, 0), pt(0.005, 0, 50), pt(0.01, 0, 0)}}},
+		{ID: "flat", Lines: [][]geo.Point{{pt(0, 0, 0), pt(0, 0.003, 0), pt(0.01, 0.003, 0), pt(0.01, 0, 0)}}},
+	})
+	stops := []geo.Point{pt(0, 0, 0), pt(0.01, 0, 0)}
+
+	tests := []struct {
+		opt  Optimize
+		want []string
+	}{
+		{OptimizeDistance, []string{"hill"}},
+		{OptimizeElevation, []string{"flat"}},
+	}
+	for _, tt := range tests {
+		path, err := g.Plan(stops, tt.opt, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(path.RouteIDs, tt.want) {
+			t.Errorf("Plan(opt=%d) used %v, want %v", tt.opt, path.RouteIDs, tt.want)
+		}
+	}
+}
+
+func TestPlanErrors(t *testing.T) {
+	g := Build([]Route{
+		{ID: "a", Lines: [][]geo.Point{{pt(0, 0, 0), pt(0.01, 0, 0)}}},
+		{ID: "far", Lines: [][]geo.Point{{pt(1, 1, 0), pt(1.01, 1, 0)}}},
+	})
+
+	if _, err := g.Plan([]geo.Point{pt(0, 0, 0), pt(1, 1, 0)}, OptimizeDistance, 50); !errors.Is(err, ErrNoPath) {
+		t.Errorf("disconnected stops: err = %v, want ErrNoPath", err)
+	}
+	if _, err := g.Plan([]geo.Point{pt(0, 0, 0), pt(0.5, 0.5, 0)}, OptimizeDistance, 50); !errors.Is(err, ErrNoTrailNearby) {
+		t.Errorf("stop off trail: err = %v, want ErrNoTrailNearby", err)
+	}
+}
+
+func TestPlanSameStop(t *testing.T) {
+	g := Build([]Route{{ID: "a", Lines: [][]geo.Point{{pt(0, 0, 0), pt(0.01, 0, 0)}}}})
+	path, err := g.Plan([]geo.Point{pt(0, 0, 0), pt(0, 0, 0)}, OptimizeDistance, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(path.Points) != 1 || len(path.RouteIDs) != 0 {
+		t.Errorf("path = %+v, want a single point", path)
+	}
+}
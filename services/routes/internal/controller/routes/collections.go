@@ -0,0 +1,392 @@
+package routes
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"trailbox/services/routes/internal/model"
+	"trailbox/services/routes/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotCollectionOwner se devuelve cuando alguien que no es el dueño intenta
+// modificar o borrar una colección.
+var ErrNotCollectionOwner = errors.New("only the collection owner can modify or delete it")
+
+const (
+	maxTitleLen                 = 120
+	maxCollectionDescriptionLen = 2000
+	maxCollectionRoutes         = 200
+)
+
+// CollectionView es una colección tal como la ve un usuario: RouteIDs y
+// Routes tienen solo las rutas que puede ver, en el orden de la colección.
+type CollectionView struct {
+	model.Collection
+	Routes []model.Route
+}
+
+// CreateCollection crea una colección de userID con las rutas de routeIDs en
+// ese orden. userID tiene que poder ver cada ruta.
+func (c *Controller) CreateCollection(userID string, in model.Collection, routeIDs []string) (*CollectionView, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
+	}
+	col := &model.Collection{ID: uuid.New(), UserID: uid, Visibility: model.VisibilityPublic}
+	if err := applyCollectionFields(col, in); err != nil {
+		return nil, err
+	}
+	if col.RouteIDs, err = c.checkCollectionRoutes(routeIDs, uid); err != nil {
+		return nil, err
+	}
+	if err := c.repo.CreateCollection(context.TODO(), col); err != nil {
+		return nil, err
+	}
+	return c.viewCollection(col, uid)
+}
+
+// GetCollection devuelve la colección si viewerID puede verla; si no,
+// ErrCollectionNotFound.
+func (c *Controller) GetCollection(id, viewerID string) (*CollectionView, error) {
+	viewer, err := parseViewer(viewerID)
+	if err != nil {
+		return nil, err
+	}
+	col, err := c.getCollection(id)
+	if err != nil {
+		return nil, err
+	}
+	if !canViewCollection(col, viewer) {
+		return nil, repository.ErrCollectionNotFound
+	}
+	return c.viewCollection(col, viewer)
+}
+
+// CollectionQuery son los parámetros de ListCollections. OwnerID vacío lista
+// las de todos.
+type CollectionQuery struct {
+	ViewerID  string
+	OwnerID   string
+	PageSize  int
+	PageToken string
+}
+
+// ListCollections lista de la más nueva a la más vieja las colecciones
+// públicas y las de quien pide; devuelve el token de la siguiente página.
+func (c *Controller) ListCollections(cq CollectionQuery) ([]CollectionView, string, error) {
+	var f repository.CollectionFilter
+	var err error
+	if f.ViewerID, err = parseViewer(cq.ViewerID); err != nil {
+		return nil, "", err
+	}
+	if cq.OwnerID != "" {
+		if f.OwnerID, err = uuid.Parse(cq.OwnerID); err != nil {
+			return nil, "", fmt.Errorf("%w: owner_id must be a valid UUID", ErrInvalidArgument)
+		}
+	}
+	if cq.PageToken != "" {
+		if f.AfterTime, f.AfterID, err = decodeCollectionToken(cq.PageToken); err != nil {
+			return nil, "", fmt.Errorf("%w: page_token is malformed", ErrInvalidArgument)
+		}
+	}
+	size := cq.PageSize
+	switch {
+	case size < 0:
+		return nil, "", fmt.Errorf("%w: page_size must not be negative", ErrInvalidArgument)
+	case size == 0:
+		size = defaultPageSize
+	case size > maxPageSize:
+		size = maxPageSize
+	}
+	f.Limit = size + 1
+	cols, err := c.repo.ListCollections(f)
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(cols) > size {
+		cols = cols[:size]
+		next = encodeCollectionToken(&cols[size-1])
+	}
+	views, err := c.viewCollections(cols, f.ViewerID)
+	if err != nil {
+		return nil, "", err
+	}
+	return views, next, nil
+}
+
+// UpdateCollection reemplaza título y descripción; una visibilidad vacía no
+// cambia. Las rutas se cambian con Add/Remove/ReorderCollection.
+func (c *Controller) UpdateCollection(id, userID string, in model.Collection) (*CollectionView, error) {
+	col, err := c.ownedCollection(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyCollectionFields(col, in); err != nil {
+		return nil, err
+	}
+	if err := c.repo.UpdateCollection(context.TODO(), col); err != nil {
+		return nil, err
+	}
+	return c.viewCollection(col, col.UserID)
+}
+
+// AddCollectionRoute agrega la ruta al final; si ya estaba no cambia nada.
+// El agregado se hace en la base para no perder rutas con pedidos a la vez.
+func (c *Controller) AddCollectionRoute(id, userID, routeID string) (*CollectionView, error) {
+	col, err := c.ownedCollection(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	added, err := c.checkCollectionRoutes([]string{routeID}, col.UserID)
+	if err != nil {
+		return nil, err
+	}
+	err = c.repo.AddCollectionRoute(context.TODO(), col.ID, added[0], maxCollectionRoutes)
+	if errors.Is(err, repository.ErrCollectionFull) {
+		return nil, fmt.Errorf("%w: a collection can have at most %d routes", ErrInvalidArgument, maxCollectionRoutes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.reloadCollection(col)
+}
+
+// RemoveCollectionRoute quita la ruta; si no estaba no cambia nada.
+func (c *Controller) RemoveCollectionRoute(id, userID, routeID string) (*CollectionView, error) {
+	col, err := c.ownedCollection(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	rid, err := uuid.Parse(routeID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidArgument)
+	}
+	if err := c.repo.RemoveCollectionRoute(context.TODO(), col.ID, rid); err != nil {
+		return nil, err
+	}
+	return c.reloadCollection(col)
+}
+
+// ReorderCollection pone las rutas en el orden de routeIDs, que tiene que
+// tener las mismas rutas que ve el dueño. Las que ya no puede ver (se
+// volvieron privadas) y las agregadas mientras tanto quedan al final.
+func (c *Controller) ReorderCollection(id, userID string, routeIDs []string) (*CollectionView, error) {
+	col, err := c.ownedCollection(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	view, err := c.viewCollection(col, col.UserID)
+	if err != nil {
+		return nil, err
+	}
+	visible := make(map[uuid.UUID]bool, len(view.RouteIDs))
+	for _, rid := range view.RouteIDs {
+		visible[rid] = true
+	}
+	errMismatch := fmt.Errorf("%w: route_ids must list the routes of the collection once each", ErrInvalidArgument)
+	if len(routeIDs) != len(visible) {
+		return nil, errMismatch
+	}
+	ids := make([]uuid.UUID, 0, len(col.RouteIDs))
+	for _, s := range routeIDs {
+		rid, err := uuid.Parse(s)
+		if err != nil || !visible[rid] {
+			return nil, errMismatch
+		}
+		delete(visible, rid)
+		ids = append(ids, rid)
+	}
+	if err := c.repo.ReorderCollectionRoutes(context.TODO(), col.ID, ids); err != nil {
+		return nil, err
+	}
+	return c.reloadCollection(col)
+}
+
+// DeleteCollection borra la colección; las rutas no se tocan.
+func (c *Controller) DeleteCollection(id, userID string) error {
+	col, err := c.ownedCollection(id, userID)
+	if err != nil {
+		return err
+	}
+	return c.repo.DeleteCollection(context.TODO(), col.ID)
+}
+
+// reloadCollection vuelve a leer la colección después de cambiar sus rutas,
+// con lo que hayan agregado otros pedidos.
+func (c *Controller) reloadCollection(col *model.Collection) (*CollectionView, error) {
+	fresh, err := c.repo.GetCollection(col.ID)
+	if err != nil {
+		return nil, err
+	}
+	return c.viewCollection(fresh, fresh.UserID)
+}
+
+func (c *Controller) getCollection(id string) (*model.Collection, error) {
+	cid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: id must be a valid UUID", ErrInvalidArgument)
+	}
+	return c.repo.GetCollection(cid)
+}
+
+// ownedCollection trae la colección y comprueba que userID sea su dueño.
+func (c *Controller) ownedCollection(id, userID string) (*model.Collection, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
+	}
+	col, err := c.getCollection(id)
+	if err != nil {
+		return nil, err
+	}
+	if col.UserID != uid {
+		return nil, ErrNotCollectionOwner
+	}
+	return col, nil
+}
+
+func canViewCollection(col *model.Collection, viewer uuid.UUID) bool {
+	return (viewer != uuid.Nil && col.UserID == viewer) ||
+		col.Visibility == model.VisibilityPublic || col.Visibility == model.VisibilityUnlisted
+}
+
+// checkCollectionRoutes valida los ids y que userID pueda ver cada ruta; una
+// ruta que no ve responde ErrNotFound, igual que GetRoute.
+func (c *Controller) checkCollectionRoutes(routeIDs []string, userID uuid.UUID) ([]uuid.UUID, error) {
+	if len(routeIDs) > maxCollectionRoutes {
+		return nil, fmt.Errorf("%w: a collection can have at most %d routes", ErrInvalidArgument, maxCollectionRoutes)
+	}
+	ids := make([]uuid.UUID, 0, len(routeIDs))
+	seen := map[uuid.UUID]bool{}
+	for _, s := range routeIDs {
+		rid, err := uuid.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: route ids must be valid UUIDs", ErrInvalidArgument)
+		}
+		if seen[rid] {
+			return nil, fmt.Errorf("%w: route %s is repeated", ErrInvalidArgument, rid)
+		}
+		seen[rid] = true
+		ids = append(ids, rid)
+	}
+	routes, err := c.repo.GetRoutes(ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) != len(ids) {
+		return nil, repository.ErrNotFound
+	}
+	for i := range routes {
+		ok, err := c.canView(&routes[i], userID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, repository.ErrNotFound
+		}
+	}
+	return ids, nil
+}
+
+func (c *Controller) viewCollection(col *model.Collection, viewer uuid.UUID) (*CollectionView, error) {
+	views, err := c.viewCollections([]model.Collection{*col}, viewer)
+	if err != nil {
+		return nil, err
+	}
+	return &views[0], nil
+}
+
+// viewCollections deja en cada colección solo las rutas que viewer puede
+// ver, con una consulta para todas.
+func (c *Controller) viewCollections(cols []model.Collection, viewer uuid.UUID) ([]CollectionView, error) {
+	var ids []uuid.UUID
+	for _, col := range cols {
+		ids = append(ids, col.RouteIDs...)
+	}
+	routes, err := c.repo.GetRoutes(ids)
+	if err != nil {
+		return nil, err
+	}
+	visible := make(map[uuid.UUID]*model.Route, len(routes))
+	for i := range routes {
+		ok, err := c.canView(&routes[i], viewer)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			visible[routes[i].ID] = &routes[i]
+		}
+	}
+	views := make([]CollectionView, len(cols))
+	for i, col := range cols {
+		views[i].Collection = col
+		views[i].RouteIDs = []uuid.UUID{}
+		views[i].Routes = []model.Route{}
+		for _, rid := range col.RouteIDs {
+			if r, ok := visible[rid]; ok {
+				views[i].RouteIDs = append(views[i].RouteIDs, rid)
+				views[i].Routes = append(views[i].Routes, *r)
+			}
+		}
+	}
+	return views, nil
+}
+
+// applyCollectionFields valida título, descripción y visibilidad y los copia
+// a dst. Una visibilidad vacía deja la de dst.
+func applyCollectionFields(dst *model.Collection, in model.Collection) error {
+	title := strings.TrimSpace(in.Title)
+	description := strings.TrimSpace(in.Description)
+	switch {
+	case title == "":
+		return fmt.Errorf("%w: title is required", ErrInvalidArgument)
+	case utf8.RuneCountInString(title) > maxTitleLen:
+		return fmt.Errorf("%w: title must be at most %d characters", ErrInvalidArgument, maxTitleLen)
+	case utf8.RuneCountInString(description) > maxCollectionDescriptionLen:
+		return fmt.Errorf("%w: description must be at most %d characters", ErrInvalidArgument, maxCollectionDescriptionLen)
+	}
+	switch in.Visibility {
+	case "", model.VisibilityPublic, model.VisibilityUnlisted, model.VisibilityPrivate:
+	case model.VisibilityShared:
+		return fmt.Errorf("%w: collections cannot be shared; use unlisted", ErrInvalidArgument)
+	default:
+		return fmt.Errorf("%w: unknown visibility %q", ErrInvalidArgument, in.Visibility)
+	}
+	dst.Title, dst.Description = title, description
+	if in.Visibility != "" {
+		dst.Visibility = in.Visibility
+	}
+	return nil
+}
+
+// El token de colecciones es base64("<created_at unix nanos>|<uuid>").
+func encodeCollectionToken(last *model.Collection) string {
+	raw := strconv.FormatInt(last.CreatedAt.UnixNano(), 10) + "|" + last.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCollectionToken(token string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, errors.New("expected two fields")
+	}
+	n, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	after, err := uuid.Parse(id)
+	return time.Unix(0, n), after, err
+}
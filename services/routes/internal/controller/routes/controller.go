@@ -2,6 +2,14 @@ package routes
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"trailbox/services/routes/internal/model"
 	"trailbox/services/routes/internal/repository"
@@ -9,6 +17,28 @@ import (
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrInvalidArgument marca los errores de validación de entrada.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrNotOwner se devuelve cuando alguien que no es el dueño intenta
+	// modificar o borrar una ruta.
+	ErrNotOwner = errors.New("only the route owner can modify or delete it")
+)
+
+// Límites de los campos de texto; name y region coinciden con los varchar de
+// la tabla.
+const (
+	maxNameLen        = 255
+	maxDescriptionLen = 5000
+	maxRegionLen      = 100
+	maxTags           = 20
+	maxTagLen         = 40
+	maxShares         = 100
+
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
 type Controller struct {
 	repo repository.Repository
 }
@@ -17,26 +47,424 @@ func NewController(r repository.Repository) *Controller {
 	return &Controller{repo: r}
 }
 
-func (c *Controller) AddRoute(userID, path string, duration, distance int) error {
+// AddRoute publica una ruta a nombre de userID. De in solo se usan los campos
+// editables.
+func (c *Controller) AddRoute(userID string, in model.Route) (*model.Route, error) {
 	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
+	}
+	r := &model.Route{ID: uuid.New(), UserID: uid, Visibility: model.VisibilityPublic}
+	if err := applyFields(r, in); err != nil {
+		return nil, err
+	}
+	if err := c.repo.CreateRoute(context.TODO(), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UpdateRoute reemplaza los campos editables. Solo puede hacerlo el dueño.
+func (c *Controller) UpdateRoute(id, userID string, in model.Route) (*model.Route, error) {
+	r, err := c.ownedRoute(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyFields(r, in); err != nil {
+		return nil, err
+	}
+	if err := c.repo.UpdateRoute(context.TODO(), r); err != nil {
+		return nil, err
+	}
+	return c.withShares(r)
+}
+
+// DeleteRoute borra la ruta. Solo puede hacerlo el dueño.
+func (c *Controller) DeleteRoute(id, userID string) error {
+	r, err := c.ownedRoute(id, userID)
+	if err != nil {
+		return err
+	}
+	return c.repo.DeleteRoute(context.TODO(), r.ID)
+}
+
+// GetRoute devuelve la ruta si viewerID puede verla (vacío = anónimo). Si no
+// puede se responde ErrNotFound, para no revelar que existe. Al dueño se le
+// devuelven también los accesos.
+func (c *Controller) GetRoute(id, viewerID string) (*model.Route, error) {
+	viewer, err := parseViewer(viewerID)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.getRoute(id)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := c.canView(r, viewer)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	if r.UserID == viewer {
+		return c.withShares(r)
+	}
+	return r, nil
+}
+
+// canView aplica la visibilidad: las unlisted se ven por id aunque no se
+// listen.
+func (c *Controller) canView(r *model.Route, viewer uuid.UUID) (bool, error) {
+	switch {
+	case viewer != uuid.Nil && r.UserID == viewer:
+		return true, nil
+	case r.Visibility == model.VisibilityPublic || r.Visibility == model.VisibilityUnlisted:
+		return true, nil
+	case r.Visibility == model.VisibilityShared && viewer != uuid.Nil:
+		return c.repo.IsSharedWith(r.ID, viewer)
+	}
+	return false, nil
+}
+
+// ShareRoute da acceso a granteeID. Solo puede hacerlo el dueño. El acceso se
+// guarda aunque la ruta todavía no sea shared; cuenta desde que lo sea.
+func (c *Controller) ShareRoute(id, userID, granteeID string) (*model.Route, error) {
+	r, grantee, err := c.shareArgs(id, userID, granteeID)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := c.repo.ListShares(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(shares) >= maxShares {
+		return nil, fmt.Errorf("%w: a route can be shared with at most %d users", ErrInvalidArgument, maxShares)
+	}
+	if err := c.repo.AddShare(context.TODO(), &model.RouteShare{RouteID: r.ID, UserID: grantee}); err != nil {
+		return nil, err
+	}
+	return c.withShares(r)
+}
+
+// UnshareRoute quita el acceso de granteeID. Solo puede hacerlo el dueño.
+func (c *Controller) UnshareRoute(id, userID, granteeID string) (*model.Route, error) {
+	r, grantee, err := c.shareArgs(id, userID, granteeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.repo.RemoveShare(context.TODO(), r.ID, grantee); err != nil {
+		return nil, err
+	}
+	return c.withShares(r)
+}
+
+func (c *Controller) shareArgs(id, userID, granteeID string) (*model.Route, uuid.UUID, error) {
+	grantee, err := uuid.Parse(granteeID)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("%w: grantee_id must be a valid UUID", ErrInvalidArgument)
+	}
+	r, err := c.ownedRoute(id, userID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	if grantee == r.UserID {
+		return nil, uuid.Nil, fmt.Errorf("%w: the owner already has access", ErrInvalidArgument)
+	}
+	return r, grantee, nil
+}
+
+func (c *Controller) withShares(r *model.Route) (*model.Route, error) {
+	shares, err := c.repo.ListShares(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	r.SharedWith = shares
+	return r, nil
+}
+
+// ListQuery son los parámetros de ListRoutes tal como llegan por gRPC.
+type ListQuery struct {
+	ViewerID  string // vacío = anónimo; solo ve rutas públicas
+	Query     string // ver query.go
+	IDs       []string
+	PageSize  int
+	PageToken string
+}
+
+// ListRoutes busca rutas; devuelve el token de la siguiente página.
+func (c *Controller) ListRoutes(lq ListQuery) ([]model.Route, string, error) {
+	q, err := parseQuery(lq.Query)
+	if err != nil {
+		return nil, "", err
+	}
+	f := q.filter
+	if f.ViewerID, err = parseViewer(lq.ViewerID); err != nil {
+		return nil, "", err
+	}
+	if q.starred {
+		if f.ViewerID == uuid.Nil {
+			return nil, "", fmt.Errorf("%w: starred:true needs a viewer", ErrInvalidArgument)
+		}
+		f.StarredBy = f.ViewerID
+	}
+	for _, id := range lq.IDs {
+		rid, err := uuid.Parse(id)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: ids must be valid UUIDs", ErrInvalidArgument)
+		}
+		f.IDs = append(f.IDs, rid)
+	}
+	if lq.PageToken != "" {
+		if err := decodePageToken(lq.PageToken, q.sortKey, &f); err != nil {
+			return nil, "", fmt.Errorf("%w: page_token is malformed or belongs to another sort", ErrInvalidArgument)
+		}
+	}
+
+	size := lq.PageSize
+	switch {
+	case size < 0:
+		return nil, "", fmt.Errorf("%w: page_size must not be negative", ErrInvalidArgument)
+	case size == 0:
+		size = defaultPageSize
+	case size > maxPageSize:
+		size = maxPageSize
+	}
+	// Se pide uno extra para saber si hay otra página.
+	f.Limit = size + 1
+
+	routes, err := c.repo.ListRoutes(f)
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(routes) > size {
+		routes = routes[:size]
+		next = encodePageToken(q.sortKey, f.Sort, &routes[size-1])
+	}
+	return routes, next, nil
+}
+
+// ListRouteIDs pagina los ids de todas las rutas por id. El token es el
+// último id devuelto.
+func (c *Controller) ListRouteIDs(pageSize int, pageToken string) ([]uuid.UUID, string, error) {
+	var after uuid.UUID
+	if pageToken != "" {
+		var err error
+		if after, err = uuid.Parse(pageToken); err != nil {
+			return nil, "", fmt.Errorf("%w: page_token is malformed", ErrInvalidArgument)
+		}
+	}
+	switch {
+	case pageSize < 0:
+		return nil, "", fmt.Errorf("%w: page_size must not be negative", ErrInvalidArgument)
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+	ids, err := c.repo.RouteIDs(after, pageSize+1)
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(ids) > pageSize {
+		ids = ids[:pageSize]
+		next = ids[pageSize-1].String()
+	}
+	return ids, next, nil
+}
+
+// SetRouteStats guarda los totales que calcula el gateway a partir de las
+// reseñas y los workouts de la ruta.
+func (c *Controller) SetRouteStats(id string, ratingAvg float64, ratingCount, workoutCount int) (*model.Route, error) {
+	rid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidArgument)
+	}
+	if ratingAvg < 0 || ratingAvg > 5 || math.IsNaN(ratingAvg) || ratingCount < 0 || workoutCount < 0 {
+		return nil, fmt.Errorf("%w: stats out of range", ErrInvalidArgument)
+	}
+	if err := c.repo.SetStats(context.TODO(), rid, ratingAvg, ratingCount, workoutCount); err != nil {
+		return nil, err
+	}
+	return c.repo.GetRoute(id)
+}
+
+// SetRouteGeometryStats guarda la distancia y el desnivel que mide el
+// servicio de mapas; sin hasElevation el desnivel no cambia.
+func (c *Controller) SetRouteGeometryStats(id string, distanceM float64, hasElevation bool, gainM, lossM float64) (*model.Route, error) {
+	rid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidArgument)
+	}
+	for _, v := range []float64{distanceM, gainM, lossM} {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%w: stats out of range", ErrInvalidArgument)
+		}
+	}
+	if err := c.repo.SetGeometryStats(context.TODO(), rid, distanceM, hasElevation, gainM, lossM); err != nil {
+		return nil, err
+	}
+	return c.repo.GetRoute(id)
+}
+
+// El token es opaco para el cliente: base64("<sort>|<valor>|<uuid>"). El
+// valor es la columna de orden de la última ruta (unix nanos para newest).
+func encodePageToken(sortKey string, col repository.Sort, last *model.Route) string {
+	var v string
+	switch col {
+	case repository.SortNewest:
+		v = strconv.FormatInt(last.CreatedAt.UnixNano(), 10)
+	case repository.SortDistance:
+		v = strconv.FormatFloat(last.DistanceM, 'g', -1, 64)
+	case repository.SortRating:
+		v = strconv.FormatFloat(last.RatingAvg, 'g', -1, 64)
+	case repository.SortPopularity:
+		v = strconv.Itoa(last.WorkoutCount)
+	}
+	raw := sortKey + "|" + v + "|" + last.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePageToken(token, sortKey string, f *repository.ListFilter) error {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
 	if err != nil {
 		return err
 	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return errors.New("expected three fields")
+	}
+	if parts[0] != sortKey {
+		return errors.New("sort mismatch")
+	}
+	if f.AfterID, err = uuid.Parse(parts[2]); err != nil {
+		return err
+	}
+	if f.Sort == repository.SortNewest {
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		f.AfterTime = time.Unix(0, n)
+		return nil
+	}
+	f.AfterValue, err = strconv.ParseFloat(parts[1], 64)
+	return err
+}
 
-	r := &model.Route{
-		ID:       uuid.New(),
-		Path:     path,
-		Duration: duration,
-		Distance: distance,
-		UserID:   uid,
+// ownedRoute trae la ruta y comprueba que userID sea su dueño.
+func (c *Controller) ownedRoute(id, userID string) (*model.Route, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
 	}
-	return c.repo.CreateRoute(context.TODO(), r)
+	r, err := c.getRoute(id)
+	if err != nil {
+		return nil, err
+	}
+	if r.UserID != uid {
+		return nil, ErrNotOwner
+	}
+	return r, nil
 }
 
-func (c *Controller) GetRoute(id string) (*model.Route, error) {
+func (c *Controller) getRoute(id string) (*model.Route, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("%w: id must be a valid UUID", ErrInvalidArgument)
+	}
 	return c.repo.GetRoute(id)
 }
 
-func (c *Controller) ListRoutes() ([]model.Route, error) {
-	return c.repo.ListRoutes()
+func parseViewer(viewerID string) (uuid.UUID, error) {
+	if viewerID == "" {
+		return uuid.Nil, nil
+	}
+	viewer, err := uuid.Parse(viewerID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: viewer_id must be a valid UUID", ErrInvalidArgument)
+	}
+	return viewer, nil
+}
+
+// applyFields valida los campos editables de in y los copia a dst. Los
+// textos se recortan y las etiquetas se pasan a minúsculas sin repetir. Una
+// visibilidad vacía deja la de dst.
+func applyFields(dst *model.Route, in model.Route) error {
+	name := strings.TrimSpace(in.Name)
+	description := strings.TrimSpace(in.Description)
+	region := strings.TrimSpace(in.Region)
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidArgument)
+	case utf8.RuneCountInString(name) > maxNameLen:
+		return fmt.Errorf("%w: name must be at most %d characters", ErrInvalidArgument, maxNameLen)
+	case utf8.RuneCountInString(description) > maxDescriptionLen:
+		return fmt.Errorf("%w: description must be at most %d characters", ErrInvalidArgument, maxDescriptionLen)
+	case utf8.RuneCountInString(region) > maxRegionLen:
+		return fmt.Errorf("%w: region must be at most %d characters", ErrInvalidArgument, maxRegionLen)
+	}
+	for _, v := range []float64{in.DistanceM, in.ElevationGainM, in.ElevationLossM} {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%w: distance and elevation must be non-negative numbers", ErrInvalidArgument)
+		}
+	}
+	if in.EstimatedDurationMin < 0 {
+		return fmt.Errorf("%w: estimated duration cannot be negative", ErrInvalidArgument)
+	}
+	switch in.Difficulty {
+	case "", model.DifficultyEasy, model.DifficultyModerate, model.DifficultyHard, model.DifficultyExpert:
+	default:
+		return fmt.Errorf("%w: unknown difficulty %q", ErrInvalidArgument, in.Difficulty)
+	}
+	switch in.Surface {
+	case "", model.SurfacePaved, model.SurfaceGravel, model.SurfaceDirt, model.SurfaceRocky, model.SurfaceMixed:
+	default:
+		return fmt.Errorf("%w: unknown surface %q", ErrInvalidArgument, in.Surface)
+	}
+	switch in.RouteType {
+	case "", model.RouteTypeLoop, model.RouteTypeOutAndBack, model.RouteTypePointToPoint:
+	default:
+		return fmt.Errorf("%w: unknown route type %q", ErrInvalidArgument, in.RouteType)
+	}
+	switch in.Visibility {
+	case "", model.VisibilityPublic, model.VisibilityUnlisted, model.VisibilityPrivate, model.VisibilityShared:
+	default:
+		return fmt.Errorf("%w: unknown visibility %q", ErrInvalidArgument, in.Visibility)
+	}
+	tags, err := normalizeTags(in.Tags)
+	if err != nil {
+		return err
+	}
+
+	dst.Name, dst.Description, dst.Region = name, description, region
+	dst.DistanceM, dst.ElevationGainM, dst.ElevationLossM = in.DistanceM, in.ElevationGainM, in.ElevationLossM
+	dst.EstimatedDurationMin = in.EstimatedDurationMin
+	dst.Difficulty, dst.Surface, dst.RouteType = in.Difficulty, in.Surface, in.RouteType
+	dst.Tags = tags
+	if in.Visibility != "" {
+		dst.Visibility = in.Visibility
+	}
+	return nil
+}
+
+func normalizeTags(in []string) (model.TagList, error) {
+	out := model.TagList{}
+	seen := map[string]bool{}
+	for _, t := range in {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if utf8.RuneCountInString(t) > maxTagLen {
+			return nil, fmt.Errorf("%w: tags must be at most %d characters", ErrInvalidArgument, maxTagLen)
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	if len(out) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags", ErrInvalidArgument, maxTags)
+	}
+	return out, nil
 }
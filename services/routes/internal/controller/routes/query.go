@@ -0,0 +1,238 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"trailbox/services/routes/internal/model"
+	"trailbox/services/routes/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// Lenguaje de búsqueda de ListRoutes. Los términos van separados por
+// espacios; un valor con espacios va entre comillas.
+//
+//	laguna "bosque de niebla"     texto libre: full-text en nombre y descripción
+//	distance:5..20                km por defecto; también 5km..20km o <8000m
+//	elevation:<800                metros de subida; también 1km..
+//	difficulty:easy,moderate      cualquiera de la lista
+//	tag:lago tag:familiar         todas (también tag:lago,familiar)
+//	owner:<uuid>
+//	starred:true                  solo las favoritas de quien pide
+//	sort:rating                   newest, distance, rating o popularity
+//
+// Los rangos aceptan a..b, a.., ..b, >a, >=a, <b, <=b o un valor exacto.
+// distance ordena de la más corta a la más larga y el resto de mayor a menor;
+// "-" delante del campo invierte el orden (sort:-distance).
+
+// sortFields asocia el nombre de sort: con la columna y si por defecto va
+// de mayor a menor.
+var sortFields = map[string]struct {
+	col  repository.Sort
+	desc bool
+}{
+	"newest":     {repository.SortNewest, true},
+	"distance":   {repository.SortDistance, false},
+	"rating":     {repository.SortRating, true},
+	"popularity": {repository.SortPopularity, true},
+}
+
+// query es el resultado de parseQuery; sortKey identifica el orden pedido
+// para no aceptar un page_token de otro orden.
+type query struct {
+	filter  repository.ListFilter
+	sortKey string
+	starred bool // el filtro necesita al viewer; lo completa ListRoutes
+}
+
+func parseQuery(s string) (*query, error) {
+	q := &query{sortKey: "newest"}
+	q.filter.Sort, q.filter.Descending = repository.SortNewest, true
+
+	terms, err := splitTerms(s)
+	if err != nil {
+		return nil, err
+	}
+	var text []string
+	for _, t := range terms {
+		key, value, ok := strings.Cut(t.raw, ":")
+		if !ok || t.quoted {
+			text = append(text, t.text())
+			continue
+		}
+		value = unquote(value)
+		if value == "" {
+			return nil, fmt.Errorf("%w: %s: missing value", ErrInvalidArgument, key)
+		}
+		switch strings.ToLower(key) {
+		case "distance":
+			if q.filter.DistanceM, err = parseRange(value, 1000); err != nil {
+				return nil, fmt.Errorf("%w: distance: %v", ErrInvalidArgument, err)
+			}
+		case "elevation":
+			if q.filter.ElevationGainM, err = parseRange(value, 1); err != nil {
+				return nil, fmt.Errorf("%w: elevation: %v", ErrInvalidArgument, err)
+			}
+		case "difficulty":
+			for _, d := range strings.Split(value, ",") {
+				switch d := model.Difficulty(strings.ToLower(strings.TrimSpace(d))); d {
+				case model.DifficultyEasy, model.DifficultyModerate, model.DifficultyHard, model.DifficultyExpert:
+					q.filter.Difficulties = append(q.filter.Difficulties, d)
+				default:
+					return nil, fmt.Errorf("%w: unknown difficulty %q", ErrInvalidArgument, d)
+				}
+			}
+		case "tag":
+			tags, err := normalizeTags(strings.Split(value, ","))
+			if err != nil {
+				return nil, err
+			}
+			q.filter.Tags = append(q.filter.Tags, tags...)
+		case "owner":
+			if q.filter.OwnerID, err = uuid.Parse(value); err != nil {
+				return nil, fmt.Errorf("%w: owner must be a valid UUID", ErrInvalidArgument)
+			}
+		case "starred":
+			if strings.ToLower(value) != "true" {
+				return nil, fmt.Errorf("%w: starred only accepts true", ErrInvalidArgument)
+			}
+			q.starred = true
+		case "sort":
+			name := strings.ToLower(value)
+			reverse := strings.HasPrefix(name, "-")
+			f, ok := sortFields[strings.TrimPrefix(name, "-")]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidArgument, value)
+			}
+			q.filter.Sort, q.filter.Descending = f.col, f.desc != reverse
+			q.sortKey = name
+		default:
+			return nil, fmt.Errorf("%w: unknown filter %q", ErrInvalidArgument, key)
+		}
+	}
+	q.filter.Text = strings.Join(text, " ")
+	return q, nil
+}
+
+type term struct {
+	raw    string
+	quoted bool // el término entero iba entre comillas
+}
+
+// text devuelve el término como lo espera websearch_to_tsquery: las frases
+// siguen entre comillas.
+func (t term) text() string {
+	if t.quoted {
+		return `"` + t.raw + `"`
+	}
+	return t.raw
+}
+
+// splitTerms separa por espacios respetando las comillas, también dentro de
+// un valor (tag:"alta montaña").
+func splitTerms(s string) ([]term, error) {
+	var terms []term
+	var cur strings.Builder
+	inQuotes, quoted := false, false
+	flush := func() {
+		if cur.Len() > 0 {
+			terms = append(terms, term{raw: cur.String(), quoted: quoted})
+		}
+		cur.Reset()
+		quoted = false
+	}
+	for _, r := range s {
+		switch {
+		case r == '"':
+			if !inQuotes && cur.Len() == 0 {
+				quoted = true
+			} else if !quoted {
+				cur.WriteRune(r)
+			}
+			inQuotes = !inQuotes
+		case !inQuotes && (r == ' ' || r == '\t' || r == '\n'):
+			flush()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("%w: unterminated quote in query", ErrInvalidArgument)
+	}
+	flush()
+	return terms, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	return strings.TrimSpace(s)
+}
+
+// parseRange lee un rango en metros. unitM es el valor de un número sin
+// sufijo: 1000 para distance (km) y 1 para elevation (m).
+func parseRange(s string, unitM float64) (repository.Range, error) {
+	var rg repository.Range
+	var err error
+	switch {
+	case strings.Contains(s, ".."):
+		lo, hi, _ := strings.Cut(s, "..")
+		if lo == "" && hi == "" {
+			return rg, fmt.Errorf("empty range")
+		}
+		if lo != "" {
+			rg.HasMin = true
+			if rg.Min, err = parseMeters(lo, unitM); err != nil {
+				return rg, err
+			}
+		}
+		if hi != "" {
+			rg.HasMax = true
+			if rg.Max, err = parseMeters(hi, unitM); err != nil {
+				return rg, err
+			}
+		}
+	case strings.HasPrefix(s, ">="):
+		rg.HasMin = true
+		rg.Min, err = parseMeters(s[2:], unitM)
+	case strings.HasPrefix(s, ">"):
+		rg.HasMin, rg.MinStrict = true, true
+		rg.Min, err = parseMeters(s[1:], unitM)
+	case strings.HasPrefix(s, "<="):
+		rg.HasMax = true
+		rg.Max, err = parseMeters(s[2:], unitM)
+	case strings.HasPrefix(s, "<"):
+		rg.HasMax, rg.MaxStrict = true, true
+		rg.Max, err = parseMeters(s[1:], unitM)
+	default:
+		rg.HasMin, rg.HasMax = true, true
+		rg.Min, err = parseMeters(s, unitM)
+		rg.Max = rg.Min
+	}
+	if err != nil {
+		return rg, err
+	}
+	if rg.HasMin && rg.HasMax && rg.Min > rg.Max {
+		return rg, fmt.Errorf("min is greater than max")
+	}
+	return rg, nil
+}
+
+func parseMeters(s string, unitM float64) (float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case strings.HasSuffix(s, "km"):
+		s, unitM = strings.TrimSuffix(s, "km"), 1000
+	case strings.HasSuffix(s, "m"):
+		s, unitM = strings.TrimSuffix(s, "m"), 1
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("%q is not a valid amount", s)
+	}
+	return v * unitM, nil
+}
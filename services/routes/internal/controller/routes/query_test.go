@@ -0,0 +1,220 @@
+package routes
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"trailbox/services/routes/internal/model"
+	"trailbox/services/routes/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+func TestSplitTerms(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []term
+	}{
+		{"", nil},
+		{"  laguna \t bosque\n", []term{{raw: "laguna"}, {raw: "bosque"}}},
+		{`laguna "bosque de niebla"`, []term{{raw: "laguna"}, {raw: "bosque de niebla", quoted: true}}},
+		{`tag:"alta montaña" sort:rating`, []term{{raw: `tag:"alta montaña"`}, {raw: "sort:rating"}}},
+		// Las comillas en medio de una palabra agrupan pero se conservan.
+		{`a"b c"d`, []term{{raw: `a"b c"d`}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := splitTerms(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitTerms(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := splitTerms(`laguna "sin cerrar`); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("unterminated quote: err = %v, want ErrInvalidArgument", err)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		in    string
+		unitM float64
+		want  repository.Range
+	}{
+		{"5..20", 1000, repository.Range{Min: 5000, Max: 20000, HasMin: true, HasMax: true}},
+		{"5km..20km", 1, repository.Range{Min: 5000, Max: 20000, HasMin: true, HasMax: true}},
+		{"800m..", 1000, repository.Range{Min: 800, HasMin: true}},
+		{"..1km", 1, repository.Range{Max: 1000, HasMax: true}},
+		{">=3", 1000, repository.Range{Min: 3000, HasMin: true}},
+		{">3", 1000, repository.Range{Min: 3000, HasMin: true, MinStrict: true}},
+		{"<=800", 1, repository.Range{Max: 800, HasMax: true}},
+		{"<8000m", 1000, repository.Range{Max: 8000, HasMax: true, MaxStrict: true}},
+		{"12", 1000, repository.Range{Min: 12000, Max: 12000, HasMin: true, HasMax: true}},
+		{"1.5KM", 1, repository.Range{Min: 1500, Max: 1500, HasMin: true, HasMax: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseRange(tt.in, tt.unitM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("parseRange(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	for _, in := range []string{"..", "20..5", "abc", "-3", ">", "5..x", "NaN", "Inf"} {
+		if _, err := parseRange(in, 1000); err == nil {
+			t.Errorf("parseRange(%q) accepted an invalid range", in)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	owner := uuid.MustParse("6f1c2a9e-3b4d-4e5f-8a7b-9c0d1e2f3a4b")
+
+	tests := []struct {
+		name    string
+		in      string
+		want    repository.ListFilter
+		sortKey string
+		starred bool
+	}{
+		{
+			name:    "empty",
+			want:    repository.ListFilter{Sort: repository.SortNewest, Descending: true},
+			sortKey: "newest",
+		},
+		{
+			name: "text and filters",
+			in:   `laguna "bosque de niebla" distance:5..20 difficulty:Easy,moderate tag:lago tag:Familiar,paseo`,
+			want: repository.ListFilter{
+				Text:         `laguna "bosque de niebla"`,
+				DistanceM:    repository.Range{Min: 5000, Max: 20000, HasMin: true, HasMax: true},
+				Difficulties: []model.Difficulty{model.DifficultyEasy, model.DifficultyModerate},
+				Tags:         []string{"lago", "familiar", "paseo"},
+				Sort:         repository.SortNewest,
+				Descending:   true,
+			},
+			sortKey: "newest",
+		},
+		{
+			// Un término entre comillas es texto aunque tenga ":".
+			name:    "quoted colon",
+			in:      `"hora: 6am" elevation:<800`,
+			want:    repository.ListFilter{Text: `"hora: 6am"`, ElevationGainM: repository.Range{Max: 800, HasMax: true, MaxStrict: true}, Sort: repository.SortNewest, Descending: true},
+			sortKey: "newest",
+		},
+		{
+			name:    "owner starred",
+			in:      "owner:" + owner.String() + " starred:TRUE",
+			want:    repository.ListFilter{OwnerID: owner, Sort: repository.SortNewest, Descending: true},
+			sortKey: "newest",
+			starred: true,
+		},
+		{
+			name:    "sort distance",
+			in:      "sort:distance",
+			want:    repository.ListFilter{Sort: repository.SortDistance},
+			sortKey: "distance",
+		},
+		{
+			name:    "sort reversed",
+			in:      "sort:-Rating",
+			want:    repository.ListFilter{Sort: repository.SortRating},
+			sortKey: "-rating",
+		},
+		{
+			name:    "sort reversed ascending",
+			in:      "sort:-distance",
+			want:    repository.ListFilter{Sort: repository.SortDistance, Descending: true},
+			sortKey: "-distance",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseQuery(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(q.filter, tt.want) {
+				t.Errorf("filter = %+v\nwant %+v", q.filter, tt.want)
+			}
+			if q.sortKey != tt.sortKey || q.starred != tt.starred {
+				t.Errorf("sortKey, starred = %q, %v; want %q, %v", q.sortKey, q.starred, tt.sortKey, tt.starred)
+			}
+		})
+	}
+}
+
+func TestParseQueryRejects(t *testing.T) {
+	for _, in := range []string{
+		"distance:",
+		"distance:20..5",
+		"elevation:mucho",
+		"difficulty:extreme",
+		"owner:alguien",
+		"starred:false",
+		"sort:shortest",
+		"color:verde",
+		`laguna "sin cerrar`,
+	} {
+		t.Run(in, func(t *testing.T) {
+			if _, err := parseQuery(in); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("parseQuery(%q) err = %v, want ErrInvalidArgument", in, err)
+			}
+		})
+	}
+}
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	last := &model.Route{
+		ID:           uuid.MustParse("0b8e7c1d-2a3f-4b5c-9d6e-7f8091a2b3c4"),
+		CreatedAt:    time.Date(2026, 3, 14, 9, 26, 53, 589793238, time.UTC),
+		DistanceM:    12345.678,
+		RatingAvg:    4.25,
+		WorkoutCount: 17,
+	}
+
+	tests := []struct {
+		sortKey string
+		col     repository.Sort
+		want    repository.ListFilter
+	}{
+		{"newest", repository.SortNewest, repository.ListFilter{AfterTime: last.CreatedAt}},
+		{"distance", repository.SortDistance, repository.ListFilter{AfterValue: 12345.678}},
+		{"-rating", repository.SortRating, repository.ListFilter{AfterValue: 4.25}},
+		{"popularity", repository.SortPopularity, repository.ListFilter{AfterValue: 17}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sortKey, func(t *testing.T) {
+			token := encodePageToken(tt.sortKey, tt.col, last)
+			f := repository.ListFilter{Sort: tt.col}
+			if err := decodePageToken(token, tt.sortKey, &f); err != nil {
+				t.Fatal(err)
+			}
+			if !f.AfterTime.Equal(tt.want.AfterTime) || f.AfterValue != tt.want.AfterValue || f.AfterID != last.ID {
+				t.Errorf("cursor = (%v, %v, %v), want (%v, %v, %v)",
+					f.AfterTime, f.AfterValue, f.AfterID, tt.want.AfterTime, tt.want.AfterValue, last.ID)
+			}
+
+			// Un token de otro orden no se acepta.
+			if err := decodePageToken(token, "other", &repository.ListFilter{Sort: tt.col}); err == nil {
+				t.Error("decodePageToken accepted a token for another sort")
+			}
+		})
+	}
+
+	for _, token := range []string{"%%%", "bmV3ZXN0", "bmV3ZXN0fDF8bm90LWEtdXVpZA"} {
+		if err := decodePageToken(token, "newest", &repository.ListFilter{}); err == nil {
+			t.Errorf("decodePageToken(%q) accepted a malformed token", token)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"trailbox/services/routes/internal/model"
+	"trailbox/services/routes/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// StarRoute marca la ruta como favorita de userID, que tiene que poder
+// verla. Repetirlo no cuenta dos veces.
+func (c *Controller) StarRoute(routeID, userID string) (*model.Route, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
+	}
+	r, err := c.getRoute(routeID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := c.canView(r, uid)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	if err := c.repo.AddStar(context.TODO(), r.ID, uid); err != nil {
+		return nil, err
+	}
+	return c.GetRoute(routeID, userID)
+}
+
+// UnstarRoute quita la estrella aunque userID ya no pueda ver la ruta. Si
+// todavía la ve responde la ruta; si no, solo su id.
+func (c *Controller) UnstarRoute(routeID, userID string) (*model.Route, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
+	}
+	r, err := c.getRoute(routeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.repo.RemoveStar(context.TODO(), r.ID, uid); err != nil {
+		return nil, err
+	}
+	ok, err := c.canView(r, uid)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &model.Route{ID: r.ID}, nil
+	}
+	return c.GetRoute(routeID, userID)
+}
@@ -0,0 +1,117 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	pb "trailbox/gen/routes"
+	routesctrl "trailbox/services/routes/internal/controller/routes"
+	"trailbox/services/routes/internal/model"
+)
+
+func (h *Handler) CreateCollection(ctx context.Context, req *pb.CreateCollectionRequest) (*pb.Collection, error) {
+	col, err := h.ctrl.CreateCollection(req.UserId, collectionFieldsFromProto(req.Collection), req.RouteIds)
+	if err != nil {
+		return nil, toStatus(err, "failed to create collection")
+	}
+	return collectionToProto(col, true), nil
+}
+
+func (h *Handler) GetCollection(ctx context.Context, req *pb.GetCollectionRequest) (*pb.Collection, error) {
+	col, err := h.ctrl.GetCollection(req.Id, req.ViewerId)
+	if err != nil {
+		return nil, toStatus(err, "failed to get collection")
+	}
+	return collectionToProto(col, true), nil
+}
+
+func (h *Handler) ListCollections(ctx context.Context, req *pb.ListCollectionsRequest) (*pb.ListCollectionsResponse, error) {
+	cols, next, err := h.ctrl.ListCollections(routesctrl.CollectionQuery{
+		ViewerID:  req.ViewerId,
+		OwnerID:   req.OwnerId,
+		PageSize:  int(req.PageSize),
+		PageToken: req.PageToken,
+	})
+	if err != nil {
+		return nil, toStatus(err, "failed to list collections")
+	}
+	resp := &pb.ListCollectionsResponse{NextPageToken: next}
+	for i := range cols {
+		resp.Collections = append(resp.Collections, collectionToProto(&cols[i], false))
+	}
+	return resp, nil
+}
+
+func (h *Handler) UpdateCollection(ctx context.Context, req *pb.UpdateCollectionRequest) (*pb.Collection, error) {
+	col, err := h.ctrl.UpdateCollection(req.Id, req.UserId, collectionFieldsFromProto(req.Collection))
+	if err != nil {
+		return nil, toStatus(err, "failed to update collection")
+	}
+	return collectionToProto(col, true), nil
+}
+
+func (h *Handler) AddCollectionRoute(ctx context.Context, req *pb.CollectionRouteRequest) (*pb.Collection, error) {
+	col, err := h.ctrl.AddCollectionRoute(req.Id, req.UserId, req.RouteId)
+	if err != nil {
+		return nil, toStatus(err, "failed to add route to collection")
+	}
+	return collectionToProto(col, true), nil
+}
+
+func (h *Handler) RemoveCollectionRoute(ctx context.Context, req *pb.CollectionRouteRequest) (*pb.Collection, error) {
+	col, err := h.ctrl.RemoveCollectionRoute(req.Id, req.UserId, req.RouteId)
+	if err != nil {
+		return nil, toStatus(err, "failed to remove route from collection")
+	}
+	return collectionToProto(col, true), nil
+}
+
+func (h *Handler) ReorderCollection(ctx context.Context, req *pb.ReorderCollectionRequest) (*pb.Collection, error) {
+	col, err := h.ctrl.ReorderCollection(req.Id, req.UserId, req.RouteIds)
+	if err != nil {
+		return nil, toStatus(err, "failed to reorder collection")
+	}
+	return collectionToProto(col, true), nil
+}
+
+func (h *Handler) DeleteCollection(ctx context.Context, req *pb.DeleteCollectionRequest) (*pb.DeleteCollectionResponse, error) {
+	if err := h.ctrl.DeleteCollection(req.Id, req.UserId); err != nil {
+		return nil, toStatus(err, "failed to delete collection")
+	}
+	return &pb.DeleteCollectionResponse{Ok: true}, nil
+}
+
+func collectionFieldsFromProto(f *pb.CollectionFields) model.Collection {
+	return model.Collection{
+		Title:       f.GetTitle(),
+		Description: f.GetDescription(),
+		Visibility:  visibilityFromProto[f.GetVisibility()],
+	}
+}
+
+// collectionToProto arma la respuesta; withRoutes agrega las rutas completas
+// además de sus ids.
+func collectionToProto(c *routesctrl.CollectionView, withRoutes bool) *pb.Collection {
+	resp := &pb.Collection{
+		Id:          c.ID.String(),
+		UserId:      c.UserID.String(),
+		Title:       c.Title,
+		Description: c.Description,
+		CreatedAt:   c.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   c.UpdatedAt.Format(time.RFC3339),
+	}
+	for pv, mv := range visibilityFromProto {
+		if mv == c.Visibility {
+			resp.Visibility = pv
+		}
+	}
+	for _, id := range c.RouteIDs {
+		resp.RouteIds = append(resp.RouteIds, id.String())
+	}
+	if withRoutes {
+		for i := range c.Routes {
+			resp.Routes = append(resp.Routes, routeToProto(&c.Routes[i]))
+		}
+	}
+	return resp
+}
@@ -2,13 +2,16 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
-	commonpb "trailbox/gen/common"
 	pb "trailbox/gen/routes"
 	routesctrl "trailbox/services/routes/internal/controller/routes"
+	"trailbox/services/routes/internal/model"
+	"trailbox/services/routes/internal/repository"
 )
 
 type Handler struct {
@@ -20,32 +23,218 @@ func New(ctrl *routesctrl.Controller) *Handler {
 	return &Handler{ctrl: ctrl}
 }
 
-func (h *Handler) GetRoute(ctx context.Context, req *commonpb.RouteId) (*pb.Route, error) {
-	route, err := h.ctrl.GetRoute(req.Id)
+func (h *Handler) GetRoute(ctx context.Context, req *pb.GetRouteRequest) (*pb.Route, error) {
+	route, err := h.ctrl.GetRoute(req.Id, req.ViewerId)
 	if err != nil {
-		return nil, status.Error(codes.NotFound, "route not found")
+		return nil, toStatus(err, "failed to get route")
 	}
-	return &pb.Route{
-		Id:            route.ID.String(),
-		Name:          route.Path,
-		DistanceKm:    float64(route.Distance),
-		ElevationGain: float64(route.Duration),
-	}, nil
+	return routeToProto(route), nil
 }
 
 func (h *Handler) ListRoutes(ctx context.Context, req *pb.ListRoutesRequest) (*pb.ListRoutesResponse, error) {
-	routes, err := h.ctrl.ListRoutes()
+	routes, next, err := h.ctrl.ListRoutes(routesctrl.ListQuery{
+		ViewerID:  req.ViewerId,
+		Query:     req.Query,
+		IDs:       req.Ids,
+		PageSize:  int(req.PageSize),
+		PageToken: req.PageToken,
+	})
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to list routes")
+		return nil, toStatus(err, "failed to list routes")
 	}
-	resp := &pb.ListRoutesResponse{}
-	for _, r := range routes {
-		resp.Routes = append(resp.Routes, &pb.Route{
-			Id:            r.ID.String(),
-			Name:          r.Path,
-			DistanceKm:    float64(r.Distance),
-			ElevationGain: float64(r.Duration),
-		})
+	resp := &pb.ListRoutesResponse{NextPageToken: next}
+	for i := range routes {
+		resp.Routes = append(resp.Routes, routeToProto(&routes[i]))
 	}
 	return resp, nil
 }
+
+func (h *Handler) ListRouteIds(ctx context.Context, req *pb.ListRouteIdsRequest) (*pb.ListRouteIdsResponse, error) {
+	ids, next, err := h.ctrl.ListRouteIDs(int(req.PageSize), req.PageToken)
+	if err != nil {
+		return nil, toStatus(err, "failed to list route ids")
+	}
+	resp := &pb.ListRouteIdsResponse{NextPageToken: next}
+	for _, id := range ids {
+		resp.Ids = append(resp.Ids, id.String())
+	}
+	return resp, nil
+}
+
+func (h *Handler) SetRouteStats(ctx context.Context, req *pb.SetRouteStatsRequest) (*pb.Route, error) {
+	route, err := h.ctrl.SetRouteStats(req.RouteId, req.RatingAvg, int(req.RatingCount), int(req.WorkoutCount))
+	if err != nil {
+		return nil, toStatus(err, "failed to set route stats")
+	}
+	return routeToProto(route), nil
+}
+
+func (h *Handler) SetRouteGeometryStats(ctx context.Context, req *pb.SetRouteGeometryStatsRequest) (*pb.Route, error) {
+	route, err := h.ctrl.SetRouteGeometryStats(req.RouteId, req.DistanceM, req.HasElevation, req.ElevationGainM, req.ElevationLossM)
+	if err != nil {
+		return nil, toStatus(err, "failed to set route geometry stats")
+	}
+	return routeToProto(route), nil
+}
+
+func (h *Handler) CreateRoute(ctx context.Context, req *pb.CreateRouteRequest) (*pb.Route, error) {
+	route, err := h.ctrl.AddRoute(req.UserId, fieldsFromProto(req.Route))
+	if err != nil {
+		return nil, toStatus(err, "failed to create route")
+	}
+	return routeToProto(route), nil
+}
+
+func (h *Handler) UpdateRoute(ctx context.Context, req *pb.UpdateRouteRequest) (*pb.Route, error) {
+	route, err := h.ctrl.UpdateRoute(req.Id, req.UserId, fieldsFromProto(req.Route))
+	if err != nil {
+		return nil, toStatus(err, "failed to update route")
+	}
+	return routeToProto(route), nil
+}
+
+func (h *Handler) DeleteRoute(ctx context.Context, req *pb.DeleteRouteRequest) (*pb.DeleteRouteResponse, error) {
+	if err := h.ctrl.DeleteRoute(req.Id, req.UserId); err != nil {
+		return nil, toStatus(err, "failed to delete route")
+	}
+	return &pb.DeleteRouteResponse{Ok: true}, nil
+}
+
+func (h *Handler) ShareRoute(ctx context.Context, req *pb.ShareRouteRequest) (*pb.Route, error) {
+	route, err := h.ctrl.ShareRoute(req.Id, req.UserId, req.GranteeId)
+	if err != nil {
+		return nil, toStatus(err, "failed to share route")
+	}
+	return routeToProto(route), nil
+}
+
+func (h *Handler) UnshareRoute(ctx context.Context, req *pb.ShareRouteRequest) (*pb.Route, error) {
+	route, err := h.ctrl.UnshareRoute(req.Id, req.UserId, req.GranteeId)
+	if err != nil {
+		return nil, toStatus(err, "failed to unshare route")
+	}
+	return routeToProto(route), nil
+}
+
+func (h *Handler) StarRoute(ctx context.Context, req *pb.StarRouteRequest) (*pb.Route, error) {
+	route, err := h.ctrl.StarRoute(req.RouteId, req.UserId)
+	if err != nil {
+		return nil, toStatus(err, "failed to star route")
+	}
+	return routeToProto(route), nil
+}
+
+func (h *Handler) UnstarRoute(ctx context.Context, req *pb.StarRouteRequest) (*pb.Route, error) {
+	route, err := h.ctrl.UnstarRoute(req.RouteId, req.UserId)
+	if err != nil {
+		return nil, toStatus(err, "failed to unstar route")
+	}
+	return routeToProto(route), nil
+}
+
+var difficultyFromProto = map[pb.RouteDifficulty]model.Difficulty{
+	pb.RouteDifficulty_ROUTE_DIFFICULTY_EASY:     model.DifficultyEasy,
+	pb.RouteDifficulty_ROUTE_DIFFICULTY_MODERATE: model.DifficultyModerate,
+	pb.RouteDifficulty_ROUTE_DIFFICULTY_HARD:     model.DifficultyHard,
+	pb.RouteDifficulty_ROUTE_DIFFICULTY_EXPERT:   model.DifficultyExpert,
+}
+
+var surfaceFromProto = map[pb.RouteSurface]model.Surface{
+	pb.RouteSurface_ROUTE_SURFACE_PAVED:  model.SurfacePaved,
+	pb.RouteSurface_ROUTE_SURFACE_GRAVEL: model.SurfaceGravel,
+	pb.RouteSurface_ROUTE_SURFACE_DIRT:   model.SurfaceDirt,
+	pb.RouteSurface_ROUTE_SURFACE_ROCKY:  model.SurfaceRocky,
+	pb.RouteSurface_ROUTE_SURFACE_MIXED:  model.SurfaceMixed,
+}
+
+var routeTypeFromProto = map[pb.RouteType]model.RouteType{
+	pb.RouteType_ROUTE_TYPE_LOOP:           model.RouteTypeLoop,
+	pb.RouteType_ROUTE_TYPE_OUT_AND_BACK:   model.RouteTypeOutAndBack,
+	pb.RouteType_ROUTE_TYPE_POINT_TO_POINT: model.RouteTypePointToPoint,
+}
+
+var visibilityFromProto = map[pb.RouteVisibility]model.Visibility{
+	pb.RouteVisibility_ROUTE_VISIBILITY_PUBLIC:   model.VisibilityPublic,
+	pb.RouteVisibility_ROUTE_VISIBILITY_UNLISTED: model.VisibilityUnlisted,
+	pb.RouteVisibility_ROUTE_VISIBILITY_PRIVATE:  model.VisibilityPrivate,
+	pb.RouteVisibility_ROUTE_VISIBILITY_SHARED:   model.VisibilityShared,
+}
+
+// fieldsFromProto arma los campos editables. UNSPECIFIED queda vacío, igual
+// que un valor que no está en los mapas.
+func fieldsFromProto(f *pb.RouteFields) model.Route {
+	return model.Route{
+		Name:                 f.GetName(),
+		Description:          f.GetDescription(),
+		DistanceM:            f.GetDistanceM(),
+		ElevationGainM:       f.GetElevationGainM(),
+		ElevationLossM:       f.GetElevationLossM(),
+		EstimatedDurationMin: int(f.GetEstimatedDurationMin()),
+		Difficulty:           difficultyFromProto[f.GetDifficulty()],
+		Surface:              surfaceFromProto[f.GetSurface()],
+		RouteType:            routeTypeFromProto[f.GetRouteType()],
+		Region:               f.GetRegion(),
+		Tags:                 f.GetTags(),
+		Visibility:           visibilityFromProto[f.GetVisibility()],
+	}
+}
+
+func routeToProto(r *model.Route) *pb.Route {
+	resp := &pb.Route{
+		Id:                   r.ID.String(),
+		Name:                 r.Name,
+		UserId:               r.UserID.String(),
+		Description:          r.Description,
+		DistanceM:            r.DistanceM,
+		ElevationGainM:       r.ElevationGainM,
+		ElevationLossM:       r.ElevationLossM,
+		EstimatedDurationMin: int32(r.EstimatedDurationMin),
+		Region:               r.Region,
+		Tags:                 r.Tags,
+		RatingAvg:            r.RatingAvg,
+		RatingCount:          int32(r.RatingCount),
+		WorkoutCount:         int32(r.WorkoutCount),
+		StarCount:            int32(r.StarCount),
+		CreatedAt:            r.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:            r.UpdatedAt.Format(time.RFC3339),
+	}
+	for pd, md := range difficultyFromProto {
+		if md == r.Difficulty {
+			resp.Difficulty = pd
+		}
+	}
+	for ps, ms := range surfaceFromProto {
+		if ms == r.Surface {
+			resp.Surface = ps
+		}
+	}
+	for pt, mt := range routeTypeFromProto {
+		if mt == r.RouteType {
+			resp.RouteType = pt
+		}
+	}
+	for pv, mv := range visibilityFromProto {
+		if mv == r.Visibility {
+			resp.Visibility = pv
+		}
+	}
+	for _, u := range r.SharedWith {
+		resp.SharedWith = append(resp.SharedWith, u.String())
+	}
+	return resp
+}
+
+func toStatus(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, routesctrl.ErrInvalidArgument):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, routesctrl.ErrNotOwner), errors.Is(err, routesctrl.ErrNotCollectionOwner):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, repository.ErrCollectionNotFound):
+		return status.Error(codes.NotFound, "collection not found")
+	case errors.Is(err, repository.ErrNotFound):
+		return status.Error(codes.NotFound, "route not found")
+	default:
+		return status.Error(codes.Internal, internalMsg)
+	}
+}
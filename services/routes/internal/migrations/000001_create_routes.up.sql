@@ -0,0 +1,13 @@
+-- Esquema original de rutas. En k8s el init de postgres ya crea el esquema
+-- final, así que todas las migraciones de rutas son idempotentes: se pueden
+-- correr sobre esa base sin cambiar nada.
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS routes (
+  id UUID PRIMARY KEY,
+  path TEXT NOT NULL,
+  duration INT NOT NULL,
+  distance INT NOT NULL,
+  user_id UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
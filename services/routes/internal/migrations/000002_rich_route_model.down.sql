@@ -0,0 +1,26 @@
+-- Vuelve al esquema anterior. Se pierden los campos nuevos y la distancia
+-- se redondea a km.
+BEGIN;
+
+ALTER TABLE routes ADD COLUMN distance INT NOT NULL DEFAULT 0;
+UPDATE routes SET distance = ROUND(distance_m / 1000.0);
+ALTER TABLE routes ALTER COLUMN distance DROP DEFAULT;
+
+ALTER TABLE routes
+  DROP COLUMN distance_m,
+  DROP COLUMN description,
+  DROP COLUMN elevation_gain_m,
+  DROP COLUMN elevation_loss_m,
+  DROP COLUMN difficulty,
+  DROP COLUMN surface,
+  DROP COLUMN route_type,
+  DROP COLUMN region,
+  DROP COLUMN tags,
+  DROP COLUMN updated_at;
+
+ALTER TABLE routes ALTER COLUMN estimated_duration_min DROP DEFAULT;
+ALTER TABLE routes RENAME COLUMN estimated_duration_min TO duration;
+ALTER TABLE routes ALTER COLUMN name TYPE TEXT;
+ALTER TABLE routes RENAME COLUMN name TO path;
+
+COMMIT;
@@ -0,0 +1,56 @@
+-- Modelo de ruta completo. Las filas existentes se convierten así:
+--   path     -> name
+--   duration -> estimated_duration_min (ya eran minutos)
+--   distance -> distance_m (eran km)
+-- El resto de los campos queda vacío / en 0 = desconocido. Los renombres y
+-- la conversión solo corren si siguen las columnas viejas (ver 000001).
+BEGIN;
+
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM information_schema.columns
+             WHERE table_schema = current_schema() AND table_name = 'routes' AND column_name = 'path') THEN
+    ALTER TABLE routes RENAME COLUMN path TO name;
+  END IF;
+  IF EXISTS (SELECT 1 FROM information_schema.columns
+             WHERE table_schema = current_schema() AND table_name = 'routes' AND column_name = 'duration') THEN
+    ALTER TABLE routes RENAME COLUMN duration TO estimated_duration_min;
+  END IF;
+  -- En el esquema final name es parte de la columna generada search y no
+  -- se le puede cambiar el tipo, aunque sea al mismo.
+  IF EXISTS (SELECT 1 FROM information_schema.columns
+             WHERE table_schema = current_schema() AND table_name = 'routes' AND column_name = 'name'
+               AND data_type = 'text') THEN
+    ALTER TABLE routes ALTER COLUMN name TYPE VARCHAR(255);
+  END IF;
+END $$;
+
+ALTER TABLE routes ALTER COLUMN estimated_duration_min SET DEFAULT 0;
+
+ALTER TABLE routes
+  ADD COLUMN IF NOT EXISTS distance_m DOUBLE PRECISION NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS elevation_gain_m DOUBLE PRECISION NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS elevation_loss_m DOUBLE PRECISION NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS difficulty VARCHAR(20) NOT NULL DEFAULT ''
+    CHECK (difficulty IN ('', 'easy', 'moderate', 'hard', 'expert')),
+  ADD COLUMN IF NOT EXISTS surface VARCHAR(20) NOT NULL DEFAULT ''
+    CHECK (surface IN ('', 'paved', 'gravel', 'dirt', 'rocky', 'mixed')),
+  ADD COLUMN IF NOT EXISTS route_type VARCHAR(20) NOT NULL DEFAULT ''
+    CHECK (route_type IN ('', 'loop', 'out_and_back', 'point_to_point')),
+  ADD COLUMN IF NOT EXISTS region VARCHAR(100) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '[]',
+  ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- Con la columna distance todavía está el esquema original: updated_at
+-- acaba de crearse.
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM information_schema.columns
+             WHERE table_schema = current_schema() AND table_name = 'routes' AND column_name = 'distance') THEN
+    UPDATE routes SET distance_m = distance * 1000.0, updated_at = created_at;
+    ALTER TABLE routes DROP COLUMN distance;
+  END IF;
+END $$;
+
+COMMIT;
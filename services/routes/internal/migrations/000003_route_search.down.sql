@@ -0,0 +1,18 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_routes_user_created;
+DROP INDEX IF EXISTS idx_routes_popularity;
+DROP INDEX IF EXISTS idx_routes_rating;
+DROP INDEX IF EXISTS idx_routes_elevation;
+DROP INDEX IF EXISTS idx_routes_distance;
+DROP INDEX IF EXISTS idx_routes_created;
+DROP INDEX IF EXISTS idx_routes_tags;
+DROP INDEX IF EXISTS idx_routes_search;
+
+ALTER TABLE routes
+  DROP COLUMN search,
+  DROP COLUMN workout_count,
+  DROP COLUMN rating_count,
+  DROP COLUMN rating_avg;
+
+COMMIT;
@@ -0,0 +1,23 @@
+-- Búsqueda y orden de ListRoutes: totales de reseñas/workouts (los mantiene
+-- el gateway), columna tsvector para full-text e índices para cada orden.
+BEGIN;
+
+ALTER TABLE routes
+  ADD COLUMN IF NOT EXISTS rating_avg DOUBLE PRECISION NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS rating_count INT NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS workout_count INT NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS search TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('spanish', name), 'A') ||
+    setweight(to_tsvector('spanish', description), 'B')
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_routes_search ON routes USING GIN (search);
+CREATE INDEX IF NOT EXISTS idx_routes_tags ON routes USING GIN (tags jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS idx_routes_created ON routes (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_routes_distance ON routes (distance_m, id);
+CREATE INDEX IF NOT EXISTS idx_routes_elevation ON routes (elevation_gain_m);
+CREATE INDEX IF NOT EXISTS idx_routes_rating ON routes (rating_avg DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_routes_popularity ON routes (workout_count DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_routes_user_created ON routes (user_id, created_at DESC, id DESC);
+
+COMMIT;
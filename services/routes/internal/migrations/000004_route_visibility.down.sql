@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS route_shares;
+ALTER TABLE routes DROP COLUMN visibility;
+
+COMMIT;
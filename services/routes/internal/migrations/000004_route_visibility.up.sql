@@ -0,0 +1,17 @@
+-- Visibilidad de las rutas y accesos de las rutas shared. Las rutas que ya
+-- existen quedan públicas, como hasta ahora.
+BEGIN;
+
+ALTER TABLE routes
+  ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'unlisted', 'private', 'shared'));
+
+CREATE TABLE IF NOT EXISTS route_shares (
+  route_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (route_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_route_shares_user ON route_shares (user_id);
+
+COMMIT;
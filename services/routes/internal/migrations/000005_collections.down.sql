@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS collection_routes;
+DROP TABLE IF EXISTS collections;
+DROP TABLE IF EXISTS route_stars;
+ALTER TABLE routes DROP COLUMN star_count;
+
+COMMIT;
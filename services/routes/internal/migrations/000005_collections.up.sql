@@ -0,0 +1,35 @@
+-- Rutas favoritas (estrellas) y colecciones ordenadas de rutas.
+BEGIN;
+
+ALTER TABLE routes ADD COLUMN IF NOT EXISTS star_count INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS route_stars (
+  route_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (route_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_route_stars_user ON route_stars (user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS collections (
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL,
+  title VARCHAR(120) NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  visibility VARCHAR(20) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'unlisted', 'private')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_collections_created ON collections (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_collections_user_created ON collections (user_id, created_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS collection_routes (
+  collection_id UUID NOT NULL,
+  route_id UUID NOT NULL,
+  position INT NOT NULL,
+  PRIMARY KEY (collection_id, route_id)
+);
+CREATE INDEX IF NOT EXISTS idx_collection_routes_route ON collection_routes (route_id);
+
+COMMIT;
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Collection es una lista ordenada de rutas armada por un usuario
+// ("Cumbres del verano 2026"). Usa la misma Visibility que las rutas, salvo
+// shared.
+type Collection struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null"`
+	Title       string     `gorm:"type:varchar(120);not null"`
+	Description string     `gorm:"type:text;not null;default:''"`
+	Visibility  Visibility `gorm:"type:varchar(20);not null;default:'public'"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime"`
+
+	// RouteIDs son las rutas en orden (tabla collection_routes).
+	RouteIDs []uuid.UUID `gorm:"-"`
+}
+
+// CollectionRoute es una ruta dentro de una colección; Position empieza en 0.
+type CollectionRoute struct {
+	CollectionID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	RouteID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Position     int       `gorm:"not null"`
+}
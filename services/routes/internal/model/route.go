@@ -1,17 +1,122 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// Route representa una ruta creada por un usuario.
+// Difficulty es el grado de dificultad de una ruta. Vacío = sin clasificar
+// (las rutas migradas del modelo anterior).
+type Difficulty string
+
+const (
+	DifficultyEasy     Difficulty = "easy"
+	DifficultyModerate Difficulty = "moderate"
+	DifficultyHard     Difficulty = "hard"
+	DifficultyExpert   Difficulty = "expert"
+)
+
+// Surface es el tipo de superficie predominante.
+type Surface string
+
+const (
+	SurfacePaved  Surface = "paved"
+	SurfaceGravel Surface = "gravel"
+	SurfaceDirt   Surface = "dirt"
+	SurfaceRocky  Surface = "rocky"
+	SurfaceMixed  Surface = "mixed"
+)
+
+// RouteType dice cómo se recorre la ruta.
+type RouteType string
+
+const (
+	RouteTypeLoop         RouteType = "loop"
+	RouteTypeOutAndBack   RouteType = "out_and_back"
+	RouteTypePointToPoint RouteType = "point_to_point"
+)
+
+// Visibility decide quién ve la ruta. El dueño siempre la ve.
+type Visibility string
+
+const (
+	VisibilityPublic   Visibility = "public"   // todos; aparece en búsquedas y mapas
+	VisibilityUnlisted Visibility = "unlisted" // quien tenga el enlace; no se lista
+	VisibilityPrivate  Visibility = "private"  // solo el dueño
+	VisibilityShared   Visibility = "shared"   // el dueño y los usuarios de route_shares
+)
+
+// TagList se guarda como JSONB (["montaña","lago"]).
+type TagList []string
+
+func (t TagList) Value() (driver.Value, error) {
+	if t == nil {
+		t = TagList{}
+	}
+	return json.Marshal(t)
+}
+
+func (t *TagList) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*t = TagList{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("failed to parse JSONB column")
+	}
+	return json.Unmarshal(data, t)
+}
+
+// Route representa una ruta creada por un usuario. Distancia y desnivel en
+// metros; 0 = desconocido. Los totales de reseñas y workouts los mantiene el
+// gateway (ver SetRouteStats) para poder ordenar por ellos; StarCount se
+// actualiza con cada estrella.
 type Route struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	Path      string    `gorm:"type:varchar(255);not null"`
-	Duration  int       `gorm:"not null"` // duración en minutos
-	Distance  int       `gorm:"not null"` // distancia en metros o km (según uses)
-	UserID    uuid.UUID `gorm:"type:uuid;not null"`
+	ID                   uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Name                 string     `gorm:"type:varchar(255);not null"`
+	Description          string     `gorm:"type:text;not null;default:''"`
+	DistanceM            float64    `gorm:"not null;default:0"`
+	ElevationGainM       float64    `gorm:"not null;default:0"`
+	ElevationLossM       float64    `gorm:"not null;default:0"`
+	EstimatedDurationMin int        `gorm:"not null;default:0"`
+	Difficulty           Difficulty `gorm:"type:varchar(20);not null;default:''"`
+	Surface              Surface    `gorm:"type:varchar(20);not null;default:''"`
+	RouteType            RouteType  `gorm:"type:varchar(20);not null;default:''"`
+	Region               string     `gorm:"type:varchar(100);not null;default:''"`
+	Tags                 TagList    `gorm:"type:jsonb;not null"`
+	Visibility           Visibility `gorm:"type:varchar(20);not null;default:'public'"`
+	UserID               uuid.UUID  `gorm:"type:uuid;not null"`
+	RatingAvg            float64    `gorm:"not null;default:0"`
+	RatingCount          int        `gorm:"not null;default:0"`
+	WorkoutCount         int        `gorm:"not null;default:0"`
+	StarCount            int        `gorm:"not null;default:0"`
+	CreatedAt            time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt            time.Time  `gorm:"autoUpdateTime"`
+
+	// SharedWith son los usuarios con acceso a una ruta shared. Se carga
+	// solo cuando quien pide es el dueño.
+	SharedWith []uuid.UUID `gorm:"-"`
+}
+
+// RouteShare da acceso a una ruta shared a otro usuario.
+type RouteShare struct {
+	RouteID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// RouteStar es una ruta marcada como favorita por un usuario.
+type RouteStar struct {
+	RouteID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"trailbox/services/routes/internal/model"
+	"trailbox/services/routes/internal/repository"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *Repository) CreateCollection(ctx context.Context, c *model.Collection) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(c).Error; err != nil {
+			return err
+		}
+		return insertCollectionRoutes(tx, c.ID, c.RouteIDs)
+	})
+}
+
+func (r *Repository) GetCollection(id uuid.UUID) (*model.Collection, error) {
+	var c model.Collection
+	err := r.db.First(&c, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, repository.ErrCollectionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	cols := []model.Collection{c}
+	if err := r.loadCollectionRoutes(cols); err != nil {
+		return nil, err
+	}
+	return &cols[0], nil
+}
+
+// ListCollections pagina por (created_at, id) con el índice de la tabla.
+func (r *Repository) ListCollections(f repository.CollectionFilter) ([]model.Collection, error) {
+	q := r.db.Model(&model.Collection{})
+	if f.ViewerID == uuid.Nil {
+		q = q.Where("visibility = ?", model.VisibilityPublic)
+	} else {
+		q = q.Where("(visibility = ? OR user_id = ?)", model.VisibilityPublic, f.ViewerID)
+	}
+	if f.OwnerID != uuid.Nil {
+		q = q.Where("user_id = ?", f.OwnerID)
+	}
+	if f.AfterID != uuid.Nil {
+		q = q.Where("(created_at, id) < (?, ?)", f.AfterTime, f.AfterID)
+	}
+	var cols []model.Collection
+	if err := q.Order("created_at DESC, id DESC").Limit(f.Limit).Find(&cols).Error; err != nil {
+		return nil, err
+	}
+	if err := r.loadCollectionRoutes(cols); err != nil {
+		return nil, err
+	}
+	return cols, nil
+}
+
+func (r *Repository) UpdateCollection(ctx context.Context, c *model.Collection) error {
+	c.UpdatedAt = time.Now()
+	res := r.db.WithContext(ctx).Model(&model.Collection{}).
+		Where("id = ?", c.ID).
+		Updates(map[string]interface{}{
+			"title":       c.Title,
+			"description": c.Description,
+			"visibility":  c.Visibility,
+			"updated_at":  c.UpdatedAt,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrCollectionNotFound
+	}
+	return nil
+}
+
+// Los cambios de rutas bloquean la fila de la colección (FOR UPDATE) para
+// que dos pedidos a la vez no se pisen.
+
+func (r *Repository) AddCollectionRoute(ctx context.Context, id, routeID uuid.UUID, max int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockCollection(tx, id); err != nil {
+			return err
+		}
+		var n, exists int64
+		if err := tx.Model(&model.CollectionRoute{}).Where("collection_id = ?", id).Count(&n).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&model.CollectionRoute{}).
+			Where("collection_id = ? AND route_id = ?", id, routeID).
+			Count(&exists).Error
+		if err != nil || exists > 0 {
+			return err
+		}
+		if int(n) >= max {
+			return repository.ErrCollectionFull
+		}
+		err = tx.Exec(`INSERT INTO collection_routes (collection_id, route_id, position)
+			SELECT ?, ?, COALESCE(MAX(position) + 1, 0) FROM collection_routes WHERE collection_id = ?`,
+			id, routeID, id).Error
+		if err != nil {
+			return err
+		}
+		return touchCollection(tx, id)
+	})
+}
+
+func (r *Repository) RemoveCollectionRoute(ctx context.Context, id, routeID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockCollection(tx, id); err != nil {
+			return err
+		}
+		res := tx.Delete(&model.CollectionRoute{}, "collection_id = ? AND route_id = ?", id, routeID)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return touchCollection(tx, id)
+	})
+}
+
+func (r *Repository) ReorderCollectionRoutes(ctx context.Context, id uuid.UUID, routeIDs []uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockCollection(tx, id); err != nil {
+			return err
+		}
+		var current []uuid.UUID
+		err := tx.Model(&model.CollectionRoute{}).
+			Where("collection_id = ?", id).
+			Order("position").
+			Pluck("route_id", &current).Error
+		if err != nil {
+			return err
+		}
+		inCollection := make(map[uuid.UUID]bool, len(current))
+		for _, rid := range current {
+			inCollection[rid] = true
+		}
+		ordered := make([]uuid.UUID, 0, len(current))
+		for _, rid := range routeIDs {
+			if inCollection[rid] {
+				ordered = append(ordered, rid)
+				delete(inCollection, rid)
+			}
+		}
+		for _, rid := range current {
+			if inCollection[rid] {
+				ordered = append(ordered, rid)
+			}
+		}
+		if err := tx.Delete(&model.CollectionRoute{}, "collection_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := insertCollectionRoutes(tx, id, ordered); err != nil {
+			return err
+		}
+		return touchCollection(tx, id)
+	})
+}
+
+func lockCollection(tx *gorm.DB, id uuid.UUID) error {
+	var c model.Collection
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&c, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return repository.ErrCollectionNotFound
+	}
+	return err
+}
+
+func touchCollection(tx *gorm.DB, id uuid.UUID) error {
+	return tx.Model(&model.Collection{}).Where("id = ?", id).Update("updated_at", time.Now()).Error
+}
+
+func (r *Repository) DeleteCollection(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&model.Collection{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return repository.ErrCollectionNotFound
+		}
+		return tx.Delete(&model.CollectionRoute{}, "collection_id = ?", id).Error
+	})
+}
+
+func insertCollectionRoutes(tx *gorm.DB, id uuid.UUID, routeIDs []uuid.UUID) error {
+	if len(routeIDs) == 0 {
+		return nil
+	}
+	rows := make([]model.CollectionRoute, len(routeIDs))
+	for i, rid := range routeIDs {
+		rows[i] = model.CollectionRoute{CollectionID: id, RouteID: rid, Position: i}
+	}
+	return tx.Create(&rows).Error
+}
+
+// loadCollectionRoutes llena RouteIDs de todas las colecciones con una sola
+// consulta.
+func (r *Repository) loadCollectionRoutes(cols []model.Collection) error {
+	if len(cols) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(cols))
+	byID := make(map[uuid.UUID]*model.Collection, len(cols))
+	for i := range cols {
+		ids[i] = cols[i].ID
+		byID[cols[i].ID] = &cols[i]
+		cols[i].RouteIDs = []uuid.UUID{}
+	}
+	var rows []model.CollectionRoute
+	err := r.db.Where("collection_id IN ?", ids).Order("collection_id, position").Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		c := byID[row.CollectionID]
+		c.RouteIDs = append(c.RouteIDs, row.RouteID)
+	}
+	return nil
+}
@@ -2,13 +2,22 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"trailbox/services/routes/internal/model"
 	"trailbox/services/routes/internal/repository"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// searchColumn es el tsvector de la búsqueda de texto. No está en el modelo;
+// se omite al leer para no traerlo en cada fila.
+const searchColumn = "search"
+
 type Repository struct {
 	db *gorm.DB
 }
@@ -23,16 +32,238 @@ func (r *Repository) CreateRoute(ctx context.Context, route *model.Route) error
 
 func (r *Repository) GetRoute(id string) (*model.Route, error) {
 	var route model.Route
-	if err := r.db.First(&route, "id = ?", id).Error; err != nil {
+	err := r.db.Omit(searchColumn).First(&route, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
 		return nil, err
 	}
 	return &route, nil
 }
 
-func (r *Repository) ListRoutes() ([]model.Route, error) {
+// ListRoutes filtra y pagina. La búsqueda de texto usa la columna search
+// (tsvector) y su índice GIN; cada orden tiene su índice (columna, id).
+func (r *Repository) ListRoutes(f repository.ListFilter) ([]model.Route, error) {
+	q := r.db.Model(&model.Route{}).Omit(searchColumn)
+	if f.ViewerID == uuid.Nil {
+		q = q.Where("visibility = ?", model.VisibilityPublic)
+	} else {
+		q = q.Where("(visibility = ? OR user_id = ? OR (visibility = ? AND EXISTS ("+
+			"SELECT 1 FROM route_shares s WHERE s.route_id = routes.id AND s.user_id = ?)))",
+			model.VisibilityPublic, f.ViewerID, model.VisibilityShared, f.ViewerID)
+	}
+	if f.StarredBy != uuid.Nil {
+		q = q.Where("EXISTS (SELECT 1 FROM route_stars st WHERE st.route_id = routes.id AND st.user_id = ?)", f.StarredBy)
+	}
+	if f.Text != "" {
+		q = q.Where("search @@ websearch_to_tsquery('spanish', ?)", f.Text)
+	}
+	if len(f.IDs) > 0 {
+		q = q.Where("id IN ?", f.IDs)
+	}
+	if f.OwnerID != uuid.Nil {
+		q = q.Where("user_id = ?", f.OwnerID)
+	}
+	q = whereRange(q, "distance_m", f.DistanceM)
+	q = whereRange(q, "elevation_gain_m", f.ElevationGainM)
+	if len(f.Difficulties) > 0 {
+		q = q.Where("difficulty IN ?", f.Difficulties)
+	}
+	if len(f.Tags) > 0 {
+		tags, err := json.Marshal(f.Tags)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where("tags @> ?::jsonb", string(tags))
+	}
+
+	col := string(f.Sort)
+	if col == "" {
+		col = string(repository.SortNewest)
+	}
+	order, cmp := col+" ASC, id ASC", ">"
+	if f.Descending {
+		order, cmp = col+" DESC, id DESC", "<"
+	}
+	if f.AfterID != uuid.Nil {
+		var after interface{} = f.AfterValue
+		if col == string(repository.SortNewest) {
+			after = f.AfterTime
+		}
+		q = q.Where("("+col+", id) "+cmp+" (?, ?)", after, f.AfterID)
+	}
+
 	var routes []model.Route
-	if err := r.db.Find(&routes).Error; err != nil {
+	if err := q.Order(order).Limit(f.Limit).Find(&routes).Error; err != nil {
 		return nil, err
 	}
 	return routes, nil
 }
+
+func (r *Repository) GetRoutes(ids []uuid.UUID) ([]model.Route, error) {
+	var routes []model.Route
+	if len(ids) == 0 {
+		return routes, nil
+	}
+	if err := r.db.Omit(searchColumn).Where("id IN ?", ids).Find(&routes).Error; err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+func whereRange(q *gorm.DB, col string, rg repository.Range) *gorm.DB {
+	if rg.HasMin {
+		op := " >= ?"
+		if rg.MinStrict {
+			op = " > ?"
+		}
+		q = q.Where(col+op, rg.Min)
+	}
+	if rg.HasMax {
+		op := " <= ?"
+		if rg.MaxStrict {
+			op = " < ?"
+		}
+		q = q.Where(col+op, rg.Max)
+	}
+	return q
+}
+
+func (r *Repository) UpdateRoute(ctx context.Context, route *model.Route) error {
+	route.UpdatedAt = time.Now()
+	res := r.db.WithContext(ctx).Model(&model.Route{}).
+		Where("id = ?", route.ID).
+		Updates(map[string]interface{}{
+			"name":                   route.Name,
+			"description":            route.Description,
+			"distance_m":             route.DistanceM,
+			"elevation_gain_m":       route.ElevationGainM,
+			"elevation_loss_m":       route.ElevationLossM,
+			"estimated_duration_min": route.EstimatedDurationMin,
+			"difficulty":             route.Difficulty,
+			"surface":                route.Surface,
+			"route_type":             route.RouteType,
+			"region":                 route.Region,
+			"tags":                   route.Tags,
+			"visibility":             route.Visibility,
+			"updated_at":             route.UpdatedAt,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *Repository) DeleteRoute(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&model.Route{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return repository.ErrNotFound
+		}
+		for _, m := range []interface{}{&model.RouteShare{}, &model.RouteStar{}, &model.CollectionRoute{}} {
+			if err := tx.Delete(m, "route_id = ?", id).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *Repository) RouteIDs(after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.Model(&model.Route{}).
+		Where("id > ?", after).
+		Order("id").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *Repository) SetStats(ctx context.Context, id uuid.UUID, ratingAvg float64, ratingCount, workoutCount int) error {
+	res := r.db.WithContext(ctx).Model(&model.Route{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"rating_avg":    ratingAvg,
+			"rating_count":  ratingCount,
+			"workout_count": workoutCount,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *Repository) SetGeometryStats(ctx context.Context, id uuid.UUID, distanceM float64, hasElevation bool, gainM, lossM float64) error {
+	cols := map[string]interface{}{"distance_m": distanceM}
+	if hasElevation {
+		cols["elevation_gain_m"] = gainM
+		cols["elevation_loss_m"] = lossM
+	}
+	res := r.db.WithContext(ctx).Model(&model.Route{}).
+		Where("id = ?", id).
+		UpdateColumns(cols)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *Repository) AddShare(ctx context.Context, share *model.RouteShare) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(share).Error
+}
+
+func (r *Repository) RemoveShare(ctx context.Context, routeID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Delete(&model.RouteShare{}, "route_id = ? AND user_id = ?", routeID, userID).Error
+}
+
+func (r *Repository) IsSharedWith(routeID, userID uuid.UUID) (bool, error) {
+	var n int64
+	err := r.db.Model(&model.RouteShare{}).
+		Where("route_id = ? AND user_id = ?", routeID, userID).Count(&n).Error
+	return n > 0, err
+}
+
+func (r *Repository) ListShares(routeID uuid.UUID) ([]uuid.UUID, error) {
+	var users []uuid.UUID
+	err := r.db.Model(&model.RouteShare{}).
+		Where("route_id = ?", routeID).Order("created_at, user_id").
+		Pluck("user_id", &users).Error
+	return users, err
+}
+
+func (r *Repository) AddStar(ctx context.Context, routeID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.RouteStar{RouteID: routeID, UserID: userID})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Model(&model.Route{}).Where("id = ?", routeID).
+			UpdateColumn("star_count", gorm.Expr("star_count + 1")).Error
+	})
+}
+
+func (r *Repository) RemoveStar(ctx context.Context, routeID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&model.RouteStar{}, "route_id = ? AND user_id = ?", routeID, userID)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Model(&model.Route{}).Where("id = ?", routeID).
+			UpdateColumn("star_count", gorm.Expr("GREATEST(star_count - 1, 0)")).Error
+	})
+}
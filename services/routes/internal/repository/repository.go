@@ -2,12 +2,124 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"trailbox/services/routes/internal/model"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound se devuelve cuando la ruta no existe.
+	ErrNotFound = errors.New("route not found")
+	// ErrCollectionNotFound se devuelve cuando la colección no existe.
+	ErrCollectionNotFound = errors.New("collection not found")
+	// ErrCollectionFull se devuelve cuando la colección ya tiene el máximo
+	// de rutas.
+	ErrCollectionFull = errors.New("collection is full")
+)
+
+// Sort es el campo por el que se ordena el listado. Siempre se desempata
+// por id.
+type Sort string
+
+const (
+	SortNewest     Sort = "created_at"
+	SortDistance   Sort = "distance_m"
+	SortRating     Sort = "rating_avg"
+	SortPopularity Sort = "workout_count"
 )
 
+// Range acota un valor numérico. Sin HasMin/HasMax no hay límite de ese
+// lado.
+type Range struct {
+	Min, Max             float64
+	HasMin, HasMax       bool
+	MinStrict, MaxStrict bool // > y < en lugar de >= y <=
+}
+
+// ListFilter restringe y pagina el listado de rutas. Los campos en cero no
+// filtran. La paginación es keyset sobre (columna de Sort, id).
+type ListFilter struct {
+	// ViewerID es quien pide (uuid.Nil = anónimo). Solo se listan las rutas
+	// públicas, las suyas y las shared a las que tiene acceso.
+	ViewerID       uuid.UUID
+	Text           string // full-text en nombre y descripción (websearch_to_tsquery)
+	IDs            []uuid.UUID
+	OwnerID        uuid.UUID
+	DistanceM      Range
+	ElevationGainM Range
+	Difficulties   []model.Difficulty
+	Tags           []string // la ruta tiene que tener todas
+	StarredBy      uuid.UUID
+	Sort           Sort
+	Descending     bool
+	Limit          int
+
+	// Cursor: valor de la columna de Sort e id de la última ruta devuelta.
+	// Para SortNewest se usa AfterTime; para el resto AfterValue.
+	AfterTime  time.Time
+	AfterValue float64
+	AfterID    uuid.UUID
+}
+
+// CollectionFilter pagina el listado de colecciones, de la más nueva a la
+// más vieja. ViewerID funciona como en ListFilter: las públicas y las suyas.
+type CollectionFilter struct {
+	ViewerID  uuid.UUID
+	OwnerID   uuid.UUID
+	Limit     int
+	AfterTime time.Time // cursor: created_at e id de la última devuelta
+	AfterID   uuid.UUID
+}
+
 type Repository interface {
 	CreateRoute(ctx context.Context, route *model.Route) error
 	GetRoute(id string) (*model.Route, error)
-	ListRoutes() ([]model.Route, error)
+	ListRoutes(f ListFilter) ([]model.Route, error)
+	// GetRoutes trae las rutas de ids que existan, en cualquier orden.
+	GetRoutes(ids []uuid.UUID) ([]model.Route, error)
+	// UpdateRoute guarda los campos editables; el dueño no cambia.
+	UpdateRoute(ctx context.Context, route *model.Route) error
+	// DeleteRoute borra la ruta con sus accesos, estrellas y su lugar en las
+	// colecciones.
+	DeleteRoute(ctx context.Context, id uuid.UUID) error
+	// RouteIDs devuelve hasta limit ids mayores que after, en orden, sin
+	// mirar la visibilidad.
+	RouteIDs(after uuid.UUID, limit int) ([]uuid.UUID, error)
+	// SetStats guarda los totales de reseñas y workouts sin tocar updated_at.
+	SetStats(ctx context.Context, id uuid.UUID, ratingAvg float64, ratingCount, workoutCount int) error
+	// SetGeometryStats guarda distancia y, si hasElevation, desnivel, sin
+	// tocar updated_at.
+	SetGeometryStats(ctx context.Context, id uuid.UUID, distanceM float64, hasElevation bool, gainM, lossM float64) error
+
+	// AddShare no falla si el acceso ya existía; RemoveShare tampoco si no
+	// existía.
+	AddShare(ctx context.Context, share *model.RouteShare) error
+	RemoveShare(ctx context.Context, routeID, userID uuid.UUID) error
+	IsSharedWith(routeID, userID uuid.UUID) (bool, error)
+	// ListShares devuelve los usuarios con acceso, del más antiguo al más
+	// nuevo.
+	ListShares(routeID uuid.UUID) ([]uuid.UUID, error)
+
+	// AddStar y RemoveStar mantienen star_count; repetirlos no cambia nada.
+	AddStar(ctx context.Context, routeID, userID uuid.UUID) error
+	RemoveStar(ctx context.Context, routeID, userID uuid.UUID) error
+
+	// CreateCollection guarda también c.RouteIDs.
+	CreateCollection(ctx context.Context, c *model.Collection) error
+	GetCollection(id uuid.UUID) (*model.Collection, error)
+	ListCollections(f CollectionFilter) ([]model.Collection, error)
+	// UpdateCollection guarda título, descripción y visibilidad.
+	UpdateCollection(ctx context.Context, c *model.Collection) error
+	// AddCollectionRoute agrega la ruta al final si no estaba; con max rutas
+	// devuelve ErrCollectionFull.
+	AddCollectionRoute(ctx context.Context, id, routeID uuid.UUID, max int) error
+	// RemoveCollectionRoute no falla si la ruta no estaba.
+	RemoveCollectionRoute(ctx context.Context, id, routeID uuid.UUID) error
+	// ReorderCollectionRoutes pone primero las rutas de routeIDs que sigan en
+	// la colección, en ese orden, y después el resto en su orden actual.
+	ReorderCollectionRoutes(ctx context.Context, id uuid.UUID, routeIDs []uuid.UUID) error
+	DeleteCollection(ctx context.Context, id uuid.UUID) error
 }
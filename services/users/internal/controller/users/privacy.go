@@ -0,0 +1,72 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"trailbox/services/users/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidArgument marca los errores de validación de entrada.
+var ErrInvalidArgument = errors.New("invalid argument")
+
+// Límites de las zonas de privacidad.
+const (
+	minZoneRadiusM  = 100.0
+	maxZoneRadiusM  = 2000.0
+	maxZonesPerUser = 10
+)
+
+func (c *Controller) CreatePrivacyZone(userID, name string, lat, lon, radiusM float64) (*model.PrivacyZone, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
+	}
+	switch {
+	case lat < -90 || lat > 90:
+		return nil, fmt.Errorf("%w: lat must be between -90 and 90", ErrInvalidArgument)
+	case lon < -180 || lon > 180:
+		return nil, fmt.Errorf("%w: lon must be between -180 and 180", ErrInvalidArgument)
+	case radiusM < minZoneRadiusM || radiusM > maxZoneRadiusM:
+		return nil, fmt.Errorf("%w: radius_m must be between %.0f and %.0f", ErrInvalidArgument, minZoneRadiusM, maxZoneRadiusM)
+	}
+	if _, err := c.repo.GetUser(userID); err != nil {
+		return nil, err
+	}
+	zones, err := c.repo.ListPrivacyZones(uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(zones) >= maxZonesPerUser {
+		return nil, fmt.Errorf("%w: at most %d privacy zones per user", ErrInvalidArgument, maxZonesPerUser)
+	}
+
+	z := &model.PrivacyZone{UserID: uid, Name: strings.TrimSpace(name), Lat: lat, Lon: lon, RadiusM: radiusM}
+	if err := c.repo.CreatePrivacyZone(z); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+func (c *Controller) ListPrivacyZones(userID string) ([]model.PrivacyZone, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
+	}
+	return c.repo.ListPrivacyZones(uid)
+}
+
+func (c *Controller) DeletePrivacyZone(id, userID string) error {
+	zid, err := uuid.Parse(id)
+	if err != nil {
+		return fmt.Errorf("%w: id must be a valid UUID", ErrInvalidArgument)
+	}
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidArgument)
+	}
+	return c.repo.DeletePrivacyZone(zid, uid)
+}
@@ -2,6 +2,8 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -9,6 +11,10 @@ import (
 	commonpb "trailbox/gen/common"
 	pb "trailbox/gen/users"
 	userctrl "trailbox/services/users/internal/controller/users"
+	"trailbox/services/users/internal/model"
+	"trailbox/services/users/internal/repository"
+
+	"gorm.io/gorm"
 )
 
 type Handler struct {
@@ -47,3 +53,54 @@ func (h *Handler) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.
 	}
 	return resp, nil
 }
+
+func (h *Handler) CreatePrivacyZone(ctx context.Context, req *pb.CreatePrivacyZoneRequest) (*pb.PrivacyZone, error) {
+	z, err := h.ctrl.CreatePrivacyZone(req.UserId, req.Name, req.Lat, req.Lon, req.RadiusM)
+	if err != nil {
+		return nil, toStatus(err, "failed to create privacy zone")
+	}
+	return zoneToProto(z), nil
+}
+
+func (h *Handler) ListPrivacyZones(ctx context.Context, req *pb.ListPrivacyZonesRequest) (*pb.ListPrivacyZonesResponse, error) {
+	zones, err := h.ctrl.ListPrivacyZones(req.UserId)
+	if err != nil {
+		return nil, toStatus(err, "failed to list privacy zones")
+	}
+	resp := &pb.ListPrivacyZonesResponse{Zones: make([]*pb.PrivacyZone, 0, len(zones))}
+	for i := range zones {
+		resp.Zones = append(resp.Zones, zoneToProto(&zones[i]))
+	}
+	return resp, nil
+}
+
+func (h *Handler) DeletePrivacyZone(ctx context.Context, req *pb.DeletePrivacyZoneRequest) (*pb.DeletePrivacyZoneResponse, error) {
+	if err := h.ctrl.DeletePrivacyZone(req.Id, req.UserId); err != nil {
+		return nil, toStatus(err, "failed to delete privacy zone")
+	}
+	return &pb.DeletePrivacyZoneResponse{Ok: true}, nil
+}
+
+func zoneToProto(z *model.PrivacyZone) *pb.PrivacyZone {
+	return &pb.PrivacyZone{
+		Id:        z.ID.String(),
+		UserId:    z.UserID.String(),
+		Name:      z.Name,
+		Lat:       z.Lat,
+		Lon:       z.Lon,
+		RadiusM:   z.RadiusM,
+		CreatedAt: z.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// toStatus traduce errores del controller a códigos gRPC.
+func toStatus(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, userctrl.ErrInvalidArgument):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, repository.ErrNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "not found")
+	default:
+		return status.Error(codes.Internal, internalMsg)
+	}
+}
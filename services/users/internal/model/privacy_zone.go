@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PrivacyZone es un círculo (p. ej. alrededor de casa) donde no se muestran
+// los tracks del usuario a otras personas.
+type PrivacyZone struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name      string    `gorm:"type:varchar(100);not null;default:''"`
+	Lat       float64   `gorm:"not null"`
+	Lon       float64   `gorm:"not null"`
+	RadiusM   float64   `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
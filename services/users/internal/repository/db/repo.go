@@ -4,7 +4,9 @@ import (
 	"context"
 
 	"trailbox/services/users/internal/model"
+	"trailbox/services/users/internal/repository"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -35,3 +37,27 @@ func (r *Repository) ListUsers() ([]model.User, error) {
 func (r *Repository) CreateUser(ctx context.Context, u *model.User) error {
 	return r.db.WithContext(ctx).Create(u).Error
 }
+
+func (r *Repository) CreatePrivacyZone(z *model.PrivacyZone) error {
+	z.ID = uuid.New()
+	return r.db.Create(z).Error
+}
+
+func (r *Repository) ListPrivacyZones(userID uuid.UUID) ([]model.PrivacyZone, error) {
+	var zones []model.PrivacyZone
+	if err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+func (r *Repository) DeletePrivacyZone(id, userID uuid.UUID) error {
+	res := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.PrivacyZone{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
@@ -2,11 +2,23 @@ package repository
 
 import (
 	"context"
+	"errors"
+
 	"trailbox/services/users/internal/model"
+
+	"github.com/google/uuid"
 )
 
+// ErrNotFound se devuelve cuando no existe el registro pedido.
+var ErrNotFound = errors.New("not found")
+
 type Repository interface {
 	CreateUser(ctx context.Context, u *model.User) error
 	GetUser(id string) (*model.User, error)
 	ListUsers() ([]model.User, error)
+
+	CreatePrivacyZone(z *model.PrivacyZone) error
+	ListPrivacyZones(userID uuid.UUID) ([]model.PrivacyZone, error)
+	// DeletePrivacyZone borra la zona solo si pertenece a userID.
+	DeletePrivacyZone(id, userID uuid.UUID) error
 }
@@ -1,42 +1,291 @@
 package workouts
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"trailbox/services/workouts/internal/model"
 	"trailbox/services/workouts/internal/repository"
 
 	"github.com/google/uuid"
 )
 
+// ErrInvalidWorkout marca los errores de validación de entrada.
+var ErrInvalidWorkout = errors.New("invalid workout")
+
+// Límites razonables para un solo entrenamiento.
+const (
+	maxDurationMinutes = 24 * 60
+	maxCalories        = 20000
+)
+
+// Tamaños de página de ListWorkouts.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
 type Controller struct {
 	repo repository.Repository
+	live *liveHub
 }
 
 func NewController(r repository.Repository) *Controller {
-	return &Controller{repo: r}
+	return &Controller{repo: r, live: newLiveHub()}
+}
+
+// WorkoutInput agrupa los campos editables de un workout.
+type WorkoutInput struct {
+	UserID    string
+	RouteID   string
+	Name      string
+	Exercises []model.Exercise
+	Duration  int // minutos
+	Calories  int
+	Date      string // RFC3339, vacío = ahora
+
+	DistanceM      float64
+	ElevationGainM float64
 }
 
 // Crear un nuevo workout
-func (c *Controller) AddWorkout(name string, exercises []string, duration int, userID, routeID uuid.UUID) error {
-	w := &model.Workout{
-		Name:      name,
-		Exercises: exercises,
-		Duration:  duration,
-		UserID:    userID,
-		RouteID:   routeID,
+func (c *Controller) AddWorkout(in WorkoutInput) (*model.Workout, error) {
+	w, err := buildWorkout(in)
+	if err != nil {
+		return nil, err
 	}
-	return c.repo.Create(w)
+	w.ID = uuid.New()
+	if err := c.repo.Create(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Reemplazar un workout existente
+func (c *Controller) UpdateWorkout(id string, in WorkoutInput) (*model.Workout, error) {
+	workoutID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: id must be a valid UUID", ErrInvalidWorkout)
+	}
+	w, err := buildWorkout(in)
+	if err != nil {
+		return nil, err
+	}
+	w.ID = workoutID
+	if err := c.repo.Update(w); err != nil {
+		return nil, err
+	}
+	return c.repo.GetByID(workoutID)
+}
+
+// Eliminar un workout
+func (c *Controller) DeleteWorkout(id string) error {
+	workoutID, err := uuid.Parse(id)
+	if err != nil {
+		return fmt.Errorf("%w: id must be a valid UUID", ErrInvalidWorkout)
+	}
+	return c.repo.Delete(workoutID)
+}
+
+// CountRouteWorkouts devuelve cuántos workouts se hicieron en la ruta.
+func (c *Controller) CountRouteWorkouts(routeID string) (int64, error) {
+	rid, err := uuid.Parse(routeID)
+	if err != nil {
+		return 0, fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidWorkout)
+	}
+	return c.repo.CountByRoute(rid)
 }
 
 // Obtener un workout por ID
 func (c *Controller) GetWorkout(id string) (*model.Workout, error) {
 	workoutID, err := uuid.Parse(id)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: id must be a valid UUID", ErrInvalidWorkout)
 	}
 	return c.repo.GetByID(workoutID)
 }
 
-// Listar todos los workouts
-func (c *Controller) ListWorkouts() ([]*model.Workout, error) {
-	return c.repo.List()
+// ListQuery son los filtros de ListWorkouts tal como llegan por gRPC.
+type ListQuery struct {
+	UserID    string
+	RouteID   string
+	From      string // RFC3339
+	To        string // RFC3339
+	PageSize  int
+	PageToken string
+	Ascending bool
+}
+
+// Listar workouts filtrados; devuelve el token de la siguiente página
+func (c *Controller) ListWorkouts(q ListQuery) ([]*model.Workout, string, error) {
+	f := repository.ListFilter{Ascending: q.Ascending}
+	var err error
+
+	if q.UserID != "" {
+		if f.UserID, err = uuid.Parse(q.UserID); err != nil {
+			return nil, "", fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidWorkout)
+		}
+	}
+	if q.RouteID != "" {
+		if f.RouteID, err = uuid.Parse(q.RouteID); err != nil {
+			return nil, "", fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidWorkout)
+		}
+	}
+	if q.From != "" {
+		if f.From, err = time.Parse(time.RFC3339, q.From); err != nil {
+			return nil, "", fmt.Errorf("%w: from must be RFC3339", ErrInvalidWorkout)
+		}
+	}
+	if q.To != "" {
+		if f.To, err = time.Parse(time.RFC3339, q.To); err != nil {
+			return nil, "", fmt.Errorf("%w: to must be RFC3339", ErrInvalidWorkout)
+		}
+	}
+	if q.PageToken != "" {
+		if f.AfterDate, f.AfterID, err = decodePageToken(q.PageToken, q.Ascending); err != nil {
+			return nil, "", fmt.Errorf("%w: page_token is malformed", ErrInvalidWorkout)
+		}
+	}
+
+	size := q.PageSize
+	switch {
+	case size < 0:
+		return nil, "", fmt.Errorf("%w: page_size must not be negative", ErrInvalidWorkout)
+	case size == 0:
+		size = defaultPageSize
+	case size > maxPageSize:
+		size = maxPageSize
+	}
+	// Se pide uno extra para saber si hay otra página.
+	f.Limit = size + 1
+
+	workouts, err := c.repo.List(f)
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(workouts) > size {
+		workouts = workouts[:size]
+		last := workouts[size-1]
+		next = encodePageToken(q.Ascending, last.Date, last.ID)
+	}
+	return workouts, next, nil
+}
+
+// Listar los workouts de un usuario ordenados por fecha
+func (c *Controller) ListUserWorkouts(userID string, ascending bool, pageSize int, pageToken string) ([]*model.Workout, string, error) {
+	if userID == "" {
+		return nil, "", fmt.Errorf("%w: user_id is required", ErrInvalidWorkout)
+	}
+	return c.ListWorkouts(ListQuery{
+		UserID:    userID,
+		PageSize:  pageSize,
+		PageToken: pageToken,
+		Ascending: ascending,
+	})
+}
+
+// El token es opaco para el cliente: base64("<asc|desc>|<unix nanos>|<uuid>").
+// Lleva el orden para no aceptar el token de un listado en el otro sentido.
+func encodePageToken(ascending bool, date time.Time, id uuid.UUID) string {
+	raw := sortOrder(ascending) + "|" + strconv.FormatInt(date.UnixNano(), 10) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePageToken(token string, ascending bool) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return time.Time{}, uuid.Nil, errors.New("expected three fields")
+	}
+	if parts[0] != sortOrder(ascending) {
+		return time.Time{}, uuid.Nil, errors.New("sort mismatch")
+	}
+	nanos, idStr := parts[1], parts[2]
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	return time.Unix(0, n), id, nil
+}
+
+func sortOrder(ascending bool) string {
+	if ascending {
+		return "asc"
+	}
+	return "desc"
+}
+
+// buildWorkout valida la entrada y arma el modelo (sin ID).
+func buildWorkout(in WorkoutInput) (*model.Workout, error) {
+	userID, err := uuid.Parse(in.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidWorkout)
+	}
+	routeID, err := uuid.Parse(in.RouteID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidWorkout)
+	}
+	if in.Duration <= 0 || in.Duration > maxDurationMinutes {
+		return nil, fmt.Errorf("%w: duration must be between 1 and %d minutes", ErrInvalidWorkout, maxDurationMinutes)
+	}
+	if in.Calories < 0 || in.Calories > maxCalories {
+		return nil, fmt.Errorf("%w: calories must be between 0 and %d", ErrInvalidWorkout, maxCalories)
+	}
+
+	if in.DistanceM < 0 || in.ElevationGainM < 0 {
+		return nil, fmt.Errorf("%w: distance_m and elevation_gain_m must not be negative", ErrInvalidWorkout)
+	}
+
+	date := time.Now()
+	if in.Date != "" {
+		date, err = time.Parse(time.RFC3339, in.Date)
+		if err != nil {
+			return nil, fmt.Errorf("%w: date must be RFC3339", ErrInvalidWorkout)
+		}
+	}
+
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		name = "Workout " + date.Format("2006-01-02")
+	}
+	if len(name) > 100 {
+		return nil, fmt.Errorf("%w: name must be at most 100 characters", ErrInvalidWorkout)
+	}
+
+	exercises := make(model.ExerciseList, 0, len(in.Exercises))
+	for i, ex := range in.Exercises {
+		ex.Name = strings.TrimSpace(ex.Name)
+		if ex.Name == "" {
+			return nil, fmt.Errorf("%w: exercises[%d].name is required", ErrInvalidWorkout, i)
+		}
+		if ex.Sets < 0 || ex.Reps < 0 || ex.WeightKg < 0 || ex.DurationSeconds < 0 {
+			return nil, fmt.Errorf("%w: exercises[%d] must not have negative values", ErrInvalidWorkout, i)
+		}
+		exercises = append(exercises, ex)
+	}
+
+	return &model.Workout{
+		Name:      name,
+		Exercises: exercises,
+		Duration:  in.Duration,
+		Calories:  in.Calories,
+		Date:      date,
+		UserID:    userID,
+		RouteID:   routeID,
+
+		DistanceM:      in.DistanceM,
+		ElevationGainM: in.ElevationGainM,
+	}, nil
 }
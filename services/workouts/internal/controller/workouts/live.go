@@ -0,0 +1,303 @@
+package workouts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"trailbox/services/workouts/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrAlreadyRecording se devuelve si el usuario ya tiene una grabación activa.
+var ErrAlreadyRecording = errors.New("user already has a workout in progress")
+
+const (
+	earthRadiusM = 6371008.8
+
+	// Desnivel mínimo entre puntos para contarlo; filtra el ruido del GPS.
+	elevationThresholdM = 3.0
+	maxRecordingPoints  = 100000
+	watcherBuffer       = 16
+
+	// Estimación de calorías (adulto de ~70 kg), igual que en la importación.
+	kcalPerKm          = 52.0
+	kcalPerMeterClimbM = 0.8
+)
+
+// liveHub guarda las grabaciones activas por usuario y sus espectadores. Vive
+// en memoria: en k8s las RPCs en vivo van a un Deployment de una sola réplica
+// (workouts-live), así que la grabación y sus espectadores siempre están en el
+// mismo proceso.
+type liveHub struct {
+	mu         sync.Mutex
+	recordings map[string]*Recording
+	watchers   map[string]map[chan model.LiveProgress]struct{}
+}
+
+func newLiveHub() *liveHub {
+	return &liveHub{
+		recordings: map[string]*Recording{},
+		watchers:   map[string]map[chan model.LiveProgress]struct{}{},
+	}
+}
+
+// publish no bloquea: si un espectador va atrasado pierde actualizaciones.
+func (h *liveHub) publish(p model.LiveProgress) {
+	for ch := range h.watchers[p.UserID] {
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+// finish entrega el evento final a todos los espectadores y cierra sus
+// canales. Si un buffer está lleno se descarta la actualización más vieja:
+// el final no se puede perder. Solo se envía con mu tomado, así que tras
+// vaciar un lugar el envío no bloquea.
+func (h *liveHub) finish(p model.LiveProgress) {
+	for ch := range h.watchers[p.UserID] {
+		select {
+		case ch <- p:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- p
+		}
+		close(ch)
+	}
+	delete(h.watchers, p.UserID)
+}
+
+// Recording acumula los puntos de una grabación en curso.
+type Recording struct {
+	ctrl     *Controller
+	points   []model.TrackPoint
+	progress model.LiveProgress
+	refEle   float64 // última altura contada para el desnivel
+	done     bool
+}
+
+// StartRecording abre una grabación para el usuario; solo puede haber una
+// activa por usuario.
+func (c *Controller) StartRecording(userID, routeID, name string) (*Recording, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidWorkout)
+	}
+	if _, err := uuid.Parse(routeID); err != nil {
+		return nil, fmt.Errorf("%w: route_id must be a valid UUID", ErrInvalidWorkout)
+	}
+
+	c.live.mu.Lock()
+	defer c.live.mu.Unlock()
+	if _, ok := c.live.recordings[userID]; ok {
+		return nil, ErrAlreadyRecording
+	}
+	r := &Recording{
+		ctrl: c,
+		progress: model.LiveProgress{
+			UserID:  userID,
+			RouteID: routeID,
+			Name:    name,
+		},
+	}
+	c.live.recordings[userID] = r
+	return r, nil
+}
+
+// Add suma un punto. Los puntos con coordenadas inválidas o anteriores al
+// último se ignoran.
+func (r *Recording) Add(p model.TrackPoint) error {
+	if p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 || (p.Lat == 0 && p.Lon == 0) {
+		return nil
+	}
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+
+	hub := r.ctrl.live
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if r.done {
+		return errors.New("recording already finished")
+	}
+	if len(r.points) >= maxRecordingPoints {
+		return fmt.Errorf("%w: too many track points (max %d)", ErrInvalidWorkout, maxRecordingPoints)
+	}
+
+	pr := &r.progress
+	if n := len(r.points); n > 0 {
+		prev := r.points[n-1]
+		if p.Time.Before(prev.Time) {
+			return nil
+		}
+		pr.DistanceM += haversine(prev, p)
+		if diff := p.Elevation - r.refEle; math.Abs(diff) >= elevationThresholdM {
+			if diff > 0 {
+				pr.ElevationGainM += diff
+			}
+			r.refEle = p.Elevation
+		}
+		pr.Elapsed = p.Time.Sub(r.points[0].Time)
+	} else {
+		r.refEle = p.Elevation
+	}
+	r.points = append(r.points, p)
+
+	pr.Last = p
+	pr.Points = len(r.points)
+	if km := pr.DistanceM / 1000; km > 0 {
+		pr.PaceMinPerKm = pr.Elapsed.Minutes() / km
+	}
+	hub.publish(*pr)
+	return nil
+}
+
+// Finish guarda el workout con los datos acumulados y devuelve el track en
+// GeoJSON.
+func (r *Recording) Finish() (*model.Workout, string, error) {
+	hub := r.ctrl.live
+	hub.mu.Lock()
+	if r.done {
+		hub.mu.Unlock()
+		return nil, "", errors.New("recording already finished")
+	}
+	r.done = true
+	delete(hub.recordings, r.progress.UserID)
+	points, pr := r.points, r.progress
+	hub.mu.Unlock()
+
+	if len(points) < 2 {
+		r.ctrl.publishFinal(pr, "")
+		return nil, "", fmt.Errorf("%w: at least two valid track points are required", ErrInvalidWorkout)
+	}
+
+	geoJSON, err := trackGeoJSON(points)
+	if err != nil {
+		r.ctrl.publishFinal(pr, "")
+		return nil, "", err
+	}
+
+	duration := int(math.Ceil(pr.Elapsed.Minutes()))
+	if duration < 1 {
+		duration = 1
+	}
+	w, err := r.ctrl.AddWorkout(WorkoutInput{
+		UserID:         pr.UserID,
+		RouteID:        pr.RouteID,
+		Name:           pr.Name,
+		Duration:       duration,
+		Calories:       int(math.Round(pr.DistanceM/1000*kcalPerKm + pr.ElevationGainM*kcalPerMeterClimbM)),
+		Date:           points[0].Time.UTC().Format(time.RFC3339),
+		DistanceM:      math.Round(pr.DistanceM),
+		ElevationGainM: math.Round(pr.ElevationGainM),
+	})
+	if err != nil {
+		r.ctrl.publishFinal(pr, "")
+		return nil, "", err
+	}
+	r.ctrl.publishFinal(pr, w.ID.String())
+	return w, geoJSON, nil
+}
+
+// Abort descarta la grabación sin guardar nada.
+func (r *Recording) Abort() {
+	hub := r.ctrl.live
+	hub.mu.Lock()
+	if r.done {
+		hub.mu.Unlock()
+		return
+	}
+	r.done = true
+	delete(hub.recordings, r.progress.UserID)
+	pr := r.progress
+	hub.mu.Unlock()
+	r.ctrl.publishFinal(pr, "")
+}
+
+// Progress devuelve el estado actual de la grabación.
+func (r *Recording) Progress() model.LiveProgress {
+	r.ctrl.live.mu.Lock()
+	defer r.ctrl.live.mu.Unlock()
+	return r.progress
+}
+
+func (c *Controller) publishFinal(p model.LiveProgress, workoutID string) {
+	p.Finished = true
+	p.WorkoutID = workoutID
+	c.live.mu.Lock()
+	c.live.finish(p)
+	c.live.mu.Unlock()
+}
+
+// WatchRecording suscribe a las actualizaciones de la grabación del usuario.
+// Si ya hay una en curso, el estado actual se envía de inmediato. El canal se
+// cierra después del evento final; la función devuelta cancela la
+// suscripción.
+func (c *Controller) WatchRecording(userID string) (<-chan model.LiveProgress, func(), error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidWorkout)
+	}
+
+	ch := make(chan model.LiveProgress, watcherBuffer)
+	hub := c.live
+	hub.mu.Lock()
+	if hub.watchers[userID] == nil {
+		hub.watchers[userID] = map[chan model.LiveProgress]struct{}{}
+	}
+	hub.watchers[userID][ch] = struct{}{}
+	if r, ok := hub.recordings[userID]; ok && len(r.points) > 0 {
+		ch <- r.progress
+	}
+	hub.mu.Unlock()
+
+	cancel := func() {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		delete(hub.watchers[userID], ch)
+		if len(hub.watchers[userID]) == 0 {
+			delete(hub.watchers, userID)
+		}
+	}
+	return ch, cancel, nil
+}
+
+func trackGeoJSON(points []model.TrackPoint) (string, error) {
+	coords := make([][]float64, 0, len(points))
+	for _, p := range points {
+		coords = append(coords, []float64{
+			math.Round(p.Lon*1e6) / 1e6,
+			math.Round(p.Lat*1e6) / 1e6,
+			math.Round(p.Elevation*10) / 10,
+		})
+	}
+	out, err := json.Marshal(map[string]interface{}{
+		"type": "Feature",
+		"properties": map[string]interface{}{
+			"start_time": points[0].Time.UTC().Format(time.RFC3339),
+		},
+		"geometry": map[string]interface{}{
+			"type":        "LineString",
+			"coordinates": coords,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func haversine(a, b model.TrackPoint) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusM * math.Asin(math.Sqrt(h))
+}
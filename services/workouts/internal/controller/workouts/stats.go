@@ -0,0 +1,118 @@
+package workouts
+
+import (
+	"fmt"
+	"time"
+
+	"trailbox/services/workouts/internal/model"
+	"trailbox/services/workouts/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// Periodos soportados por GetUserStats (valores de date_trunc).
+const (
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+const (
+	defaultStatsPeriods = 12
+	maxStatsPeriods     = 120
+)
+
+// UserStats es el resumen que devuelve GetUserStats.
+type UserStats struct {
+	Totals             []model.PeriodTotals
+	CurrentStreak      *model.Streak
+	LongestStreak      *model.Streak
+	LongestByDistance  *model.Record
+	LongestByDuration  *model.Record
+	MostCalories       *model.Record
+	FastestPaceByRoute []model.Record
+}
+
+// Calcular estadísticas de un usuario. routeDistances viene en metros,
+// indexado por route ID.
+func (c *Controller) GetUserStats(userID, period string, limit int, routeDistances map[string]float64) (*UserStats, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidWorkout)
+	}
+	if period != PeriodWeek && period != PeriodMonth {
+		return nil, fmt.Errorf("%w: period must be week or month", ErrInvalidWorkout)
+	}
+	switch {
+	case limit <= 0:
+		limit = defaultStatsPeriods
+	case limit > maxStatsPeriods:
+		limit = maxStatsPeriods
+	}
+
+	rd := make(repository.RouteDistances, len(routeDistances))
+	for id, d := range routeDistances {
+		rid, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: route_distances_m has an invalid route id %q", ErrInvalidWorkout, id)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("%w: route_distances_m must not be negative", ErrInvalidWorkout)
+		}
+		rd[rid] = d
+	}
+
+	stats := &UserStats{}
+	if stats.Totals, err = c.repo.PeriodTotals(uid, period, limit, rd); err != nil {
+		return nil, err
+	}
+
+	streaks, err := c.repo.Streaks(uid)
+	if err != nil {
+		return nil, err
+	}
+	stats.CurrentStreak, stats.LongestStreak = pickStreaks(streaks, time.Now())
+
+	if stats.LongestByDistance, err = c.repo.LongestByDistance(uid, rd); err != nil {
+		return nil, err
+	}
+	if stats.LongestByDuration, err = c.repo.LongestByDuration(uid); err != nil {
+		return nil, err
+	}
+	if stats.MostCalories, err = c.repo.MostCalories(uid); err != nil {
+		return nil, err
+	}
+	if stats.FastestPaceByRoute, err = c.repo.FastestPaceByRoute(uid, rd); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// StatsRouteIDs devuelve las rutas cuya distancia necesita GetUserStats: las
+// de los workouts del usuario que no guardan distance_m.
+func (c *Controller) StatsRouteIDs(userID string) ([]uuid.UUID, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user_id must be a valid UUID", ErrInvalidWorkout)
+	}
+	return c.repo.StatsRouteIDs(uid)
+}
+
+// pickStreaks recibe las rachas más recientes primero. La racha actual sigue
+// viva si terminó hoy o ayer.
+func pickStreaks(streaks []model.Streak, now time.Time) (current, longest *model.Streak) {
+	if len(streaks) == 0 {
+		return nil, nil
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	last := streaks[0]
+	end := time.Date(last.End.Year(), last.End.Month(), last.End.Day(), 0, 0, 0, 0, time.UTC)
+	if !end.Before(today.AddDate(0, 0, -1)) {
+		current = &streaks[0]
+	}
+	for i := range streaks {
+		if longest == nil || streaks[i].Days > longest.Days {
+			longest = &streaks[i]
+		}
+	}
+	return current, longest
+}
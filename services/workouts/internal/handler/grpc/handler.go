@@ -2,6 +2,9 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"time"
 
 	"google.golang.org/grpc/codes"
@@ -10,6 +13,8 @@ import (
 	commonpb "trailbox/gen/common"
 	pb "trailbox/gen/workouts"
 	wctrl "trailbox/services/workouts/internal/controller/workouts"
+	"trailbox/services/workouts/internal/model"
+	"trailbox/services/workouts/internal/repository"
 )
 
 type Handler struct {
@@ -21,36 +26,341 @@ func New(ctrl *wctrl.Controller) *Handler {
 	return &Handler{ctrl: ctrl}
 }
 
-func (h *Handler) GetWorkout(ctx context.Context, req *commonpb.UserId) (*pb.Workout, error) {
+func (h *Handler) GetWorkout(ctx context.Context, req *commonpb.WorkoutId) (*pb.Workout, error) {
 	w, err := h.ctrl.GetWorkout(req.Id)
 	if err != nil {
-		return nil, status.Error(codes.NotFound, "workout not found")
+		return nil, toStatus(err, "failed to get workout")
 	}
-	return &pb.Workout{
-		Id:       w.ID.String(),
-		UserId:   w.UserID.String(),
-		RouteId:  w.RouteID.String(),
-		Date:     w.Date.Format(time.RFC3339),
-		Duration: float64(w.Duration),
-		Calories: float64(w.Calories),
-	}, nil
+	return toProto(w), nil
 }
 
 func (h *Handler) ListWorkouts(ctx context.Context, req *pb.ListWorkoutsRequest) (*pb.ListWorkoutsResponse, error) {
-	workouts, err := h.ctrl.ListWorkouts()
+	workouts, next, err := h.ctrl.ListWorkouts(wctrl.ListQuery{
+		UserID:    req.UserId,
+		RouteID:   req.RouteId,
+		From:      req.From,
+		To:        req.To,
+		PageSize:  int(req.PageSize),
+		PageToken: req.PageToken,
+	})
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to list workouts")
+		return nil, toStatus(err, "failed to list workouts")
 	}
-	resp := &pb.ListWorkoutsResponse{}
+	resp := &pb.ListWorkoutsResponse{NextPageToken: next}
 	for _, w := range workouts {
-		resp.Workouts = append(resp.Workouts, &pb.Workout{
-			Id:       w.ID.String(),
-			UserId:   w.UserID.String(),
-			RouteId:  w.RouteID.String(),
-			Date:     w.Date.Format(time.RFC3339),
-			Duration: float64(w.Duration),
-			Calories: float64(w.Calories),
+		resp.Workouts = append(resp.Workouts, toProto(w))
+	}
+	return resp, nil
+}
+
+func (h *Handler) ListUserWorkouts(ctx context.Context, req *pb.ListUserWorkoutsRequest) (*pb.ListWorkoutsResponse, error) {
+	workouts, next, err := h.ctrl.ListUserWorkouts(
+		req.UserId,
+		req.Order == pb.SortOrder_SORT_ORDER_DATE_ASC,
+		int(req.PageSize),
+		req.PageToken,
+	)
+	if err != nil {
+		return nil, toStatus(err, "failed to list user workouts")
+	}
+	resp := &pb.ListWorkoutsResponse{NextPageToken: next}
+	for _, w := range workouts {
+		resp.Workouts = append(resp.Workouts, toProto(w))
+	}
+	return resp, nil
+}
+
+func (h *Handler) CreateWorkout(ctx context.Context, req *pb.CreateWorkoutRequest) (*pb.Workout, error) {
+	w, err := h.ctrl.AddWorkout(wctrl.WorkoutInput{
+		UserID:    req.UserId,
+		RouteID:   req.RouteId,
+		Name:      req.Name,
+		Exercises: exercisesFromProto(req.Exercises),
+		Duration:  int(req.Duration),
+		Calories:  int(req.Calories),
+		Date:      req.Date,
+
+		DistanceM:      req.DistanceM,
+		ElevationGainM: req.ElevationGainM,
+	})
+	if err != nil {
+		return nil, toStatus(err, "failed to create workout")
+	}
+	return toProto(w), nil
+}
+
+func (h *Handler) UpdateWorkout(ctx context.Context, req *pb.UpdateWorkoutRequest) (*pb.Workout, error) {
+	w, err := h.ctrl.UpdateWorkout(req.Id, wctrl.WorkoutInput{
+		UserID:    req.UserId,
+		RouteID:   req.RouteId,
+		Name:      req.Name,
+		Exercises: exercisesFromProto(req.Exercises),
+		Duration:  int(req.Duration),
+		Calories:  int(req.Calories),
+		Date:      req.Date,
+
+		DistanceM:      req.DistanceM,
+		ElevationGainM: req.ElevationGainM,
+	})
+	if err != nil {
+		return nil, toStatus(err, "failed to update workout")
+	}
+	return toProto(w), nil
+}
+
+func (h *Handler) DeleteWorkout(ctx context.Context, req *pb.DeleteWorkoutRequest) (*pb.DeleteWorkoutResponse, error) {
+	if err := h.ctrl.DeleteWorkout(req.Id); err != nil {
+		return nil, toStatus(err, "failed to delete workout")
+	}
+	return &pb.DeleteWorkoutResponse{Ok: true}, nil
+}
+
+func (h *Handler) CountRouteWorkouts(ctx context.Context, req *commonpb.RouteId) (*pb.RouteWorkoutCount, error) {
+	n, err := h.ctrl.CountRouteWorkouts(req.Id)
+	if err != nil {
+		return nil, toStatus(err, "failed to count route workouts")
+	}
+	return &pb.RouteWorkoutCount{RouteId: req.Id, Count: int32(n)}, nil
+}
+
+func (h *Handler) ListStatsRouteIds(ctx context.Context, req *commonpb.UserId) (*pb.StatsRouteIds, error) {
+	ids, err := h.ctrl.StatsRouteIDs(req.Id)
+	if err != nil {
+		return nil, toStatus(err, "failed to list stats routes")
+	}
+	resp := &pb.StatsRouteIds{RouteIds: make([]string, 0, len(ids))}
+	for _, id := range ids {
+		resp.RouteIds = append(resp.RouteIds, id.String())
+	}
+	return resp, nil
+}
+
+func (h *Handler) GetUserStats(ctx context.Context, req *pb.GetUserStatsRequest) (*pb.GetUserStatsResponse, error) {
+	period := wctrl.PeriodWeek
+	if req.Period == pb.StatsPeriod_STATS_PERIOD_MONTH {
+		period = wctrl.PeriodMonth
+	}
+	stats, err := h.ctrl.GetUserStats(req.UserId, period, int(req.Limit), req.RouteDistancesM)
+	if err != nil {
+		return nil, toStatus(err, "failed to compute stats")
+	}
+
+	resp := &pb.GetUserStatsResponse{
+		UserId:          req.UserId,
+		Period:          req.Period,
+		CurrentStreak:   streakToProto(stats.CurrentStreak),
+		LongestStreak:   streakToProto(stats.LongestStreak),
+		LongestDistance: recordToProto(stats.LongestByDistance),
+		LongestDuration: recordToProto(stats.LongestByDuration),
+		MostCalories:    recordToProto(stats.MostCalories),
+	}
+	for _, t := range stats.Totals {
+		resp.Totals = append(resp.Totals, &pb.PeriodTotals{
+			PeriodStart:  t.PeriodStart.Format(time.RFC3339),
+			WorkoutCount: int32(t.WorkoutCount),
+			DistanceM:    t.DistanceM,
+			Duration:     float64(t.Duration),
+			Calories:     float64(t.Calories),
 		})
 	}
+	for i := range stats.FastestPaceByRoute {
+		resp.FastestPaceByRoute = append(resp.FastestPaceByRoute, recordToProto(&stats.FastestPaceByRoute[i]))
+	}
 	return resp, nil
 }
+
+// RecordWorkout acumula los puntos del stream y guarda el workout cuando el
+// cliente cierra el envío. Si el stream se corta, la grabación se descarta.
+func (h *Handler) RecordWorkout(stream pb.Workouts_RecordWorkoutServer) error {
+	var rec *wctrl.Recording
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if rec != nil {
+				rec.Abort()
+			}
+			return err
+		}
+
+		pt, err := trackPointFromProto(p)
+		if err != nil {
+			if rec != nil {
+				rec.Abort()
+			}
+			return toStatus(err, "invalid track point")
+		}
+		if rec == nil {
+			rec, err = h.ctrl.StartRecording(p.UserId, p.RouteId, p.Name)
+			if err != nil {
+				return toStatus(err, "failed to start recording")
+			}
+		}
+		if err := rec.Add(pt); err != nil {
+			rec.Abort()
+			return toStatus(err, "failed to record track point")
+		}
+	}
+	if rec == nil {
+		return status.Error(codes.InvalidArgument, "no track points received")
+	}
+
+	w, geoJSON, err := rec.Finish()
+	if err != nil {
+		return toStatus(err, "failed to save recorded workout")
+	}
+	progress := rec.Progress()
+	return stream.SendAndClose(&pb.RecordWorkoutResponse{
+		Workout:      toProto(w),
+		GeoJson:      geoJSON,
+		Points:       int32(progress.Points),
+		PaceMinPerKm: progress.PaceMinPerKm,
+	})
+}
+
+// WatchWorkout envía el progreso de la grabación del usuario hasta que
+// termina o el espectador se desconecta. Si todavía no hay grabación, espera
+// a que empiece.
+func (h *Handler) WatchWorkout(req *pb.WatchWorkoutRequest, stream pb.Workouts_WatchWorkoutServer) error {
+	updates, cancel, err := h.ctrl.WatchRecording(req.UserId)
+	if err != nil {
+		return toStatus(err, "failed to watch workout")
+	}
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case p, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(progressToProto(p)); err != nil {
+				return err
+			}
+			if p.Finished {
+				return nil
+			}
+		}
+	}
+}
+
+func trackPointFromProto(p *pb.TrackPoint) (model.TrackPoint, error) {
+	pt := model.TrackPoint{
+		Lat:       p.GetLat(),
+		Lon:       p.GetLon(),
+		Elevation: p.GetElevation(),
+		HeartRate: int(p.GetHeartRate()),
+	}
+	if p.GetTimestamp() != "" {
+		ts, err := time.Parse(time.RFC3339, p.GetTimestamp())
+		if err != nil {
+			return pt, fmt.Errorf("%w: timestamp must be RFC3339", wctrl.ErrInvalidWorkout)
+		}
+		pt.Time = ts
+	}
+	return pt, nil
+}
+
+func progressToProto(p model.LiveProgress) *pb.WorkoutProgress {
+	out := &pb.WorkoutProgress{
+		UserId:         p.UserID,
+		RouteId:        p.RouteID,
+		Name:           p.Name,
+		Lat:            p.Last.Lat,
+		Lon:            p.Last.Lon,
+		Elevation:      p.Last.Elevation,
+		HeartRate:      int32(p.Last.HeartRate),
+		Points:         int32(p.Points),
+		DistanceM:      p.DistanceM,
+		ElevationGainM: p.ElevationGainM,
+		ElapsedSeconds: p.Elapsed.Seconds(),
+		PaceMinPerKm:   p.PaceMinPerKm,
+		Finished:       p.Finished,
+		WorkoutId:      p.WorkoutID,
+	}
+	if !p.Last.Time.IsZero() {
+		out.Timestamp = p.Last.Time.Format(time.RFC3339)
+	}
+	return out
+}
+
+func streakToProto(s *model.Streak) *pb.Streak {
+	if s == nil {
+		return nil
+	}
+	return &pb.Streak{
+		Days:  int32(s.Days),
+		Start: s.Start.Format("2006-01-02"),
+		End:   s.End.Format("2006-01-02"),
+	}
+}
+
+func recordToProto(r *model.Record) *pb.PersonalRecord {
+	if r == nil {
+		return nil
+	}
+	return &pb.PersonalRecord{
+		WorkoutId: r.WorkoutID.String(),
+		RouteId:   r.RouteID.String(),
+		Date:      r.Date.Format(time.RFC3339),
+		Value:     r.Value,
+	}
+}
+
+func toProto(w *model.Workout) *pb.Workout {
+	out := &pb.Workout{
+		Id:        w.ID.String(),
+		UserId:    w.UserID.String(),
+		RouteId:   w.RouteID.String(),
+		Date:      w.Date.Format(time.RFC3339),
+		Duration:  float64(w.Duration),
+		Calories:  float64(w.Calories),
+		Name:      w.Name,
+		CreatedAt: w.CreatedAt.Format(time.RFC3339),
+
+		DistanceM:      w.DistanceM,
+		ElevationGainM: w.ElevationGainM,
+	}
+	for _, ex := range w.Exercises {
+		out.Exercises = append(out.Exercises, &pb.Exercise{
+			Name:            ex.Name,
+			Sets:            int32(ex.Sets),
+			Reps:            int32(ex.Reps),
+			WeightKg:        ex.WeightKg,
+			DurationSeconds: int32(ex.DurationSeconds),
+		})
+	}
+	return out
+}
+
+func exercisesFromProto(in []*pb.Exercise) []model.Exercise {
+	out := make([]model.Exercise, 0, len(in))
+	for _, ex := range in {
+		out = append(out, model.Exercise{
+			Name:            ex.GetName(),
+			Sets:            int(ex.GetSets()),
+			Reps:            int(ex.GetReps()),
+			WeightKg:        ex.GetWeightKg(),
+			DurationSeconds: int(ex.GetDurationSeconds()),
+		})
+	}
+	return out
+}
+
+// toStatus traduce errores del controller a códigos gRPC.
+func toStatus(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, wctrl.ErrInvalidWorkout):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, repository.ErrNotFound):
+		return status.Error(codes.NotFound, "workout not found")
+	case errors.Is(err, wctrl.ErrAlreadyRecording):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, internalMsg)
+	}
+}
@@ -0,0 +1,15 @@
+-- Esquema original de workouts. IF NOT EXISTS porque en k8s la tabla ya la
+-- crea el init de postgres.
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS workouts (
+  id UUID PRIMARY KEY,
+  name TEXT NOT NULL,
+  exercises JSONB NOT NULL,
+  duration INT NOT NULL,
+  calories INT NOT NULL,
+  date TIMESTAMPTZ NOT NULL,
+  user_id UUID NOT NULL,
+  route_id UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_workouts_date;
+DROP INDEX IF EXISTS idx_workouts_route_date;
+DROP INDEX IF EXISTS idx_workouts_user_date;
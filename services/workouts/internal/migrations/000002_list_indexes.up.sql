@@ -0,0 +1,4 @@
+-- Índices para ListWorkouts (filtros + paginación keyset por date, id)
+CREATE INDEX IF NOT EXISTS idx_workouts_user_date ON workouts (user_id, date DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_workouts_route_date ON workouts (route_id, date DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_workouts_date ON workouts (date DESC, id DESC);
@@ -0,0 +1,3 @@
+ALTER TABLE workouts
+  DROP COLUMN IF EXISTS elevation_gain_m,
+  DROP COLUMN IF EXISTS distance_m;
@@ -0,0 +1,5 @@
+-- Distancia y desnivel medidos por GPS (importaciones y grabaciones en vivo).
+-- 0 = desconocido; las estadísticas usan entonces la distancia de la ruta.
+ALTER TABLE workouts
+  ADD COLUMN IF NOT EXISTS distance_m DOUBLE PRECISION NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS elevation_gain_m DOUBLE PRECISION NOT NULL DEFAULT 0;
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// TrackPoint es un punto recibido durante una grabación en vivo.
+type TrackPoint struct {
+	Lat       float64
+	Lon       float64
+	Elevation float64
+	HeartRate int
+	Time      time.Time
+}
+
+// LiveProgress es el estado de una grabación después de cada punto.
+type LiveProgress struct {
+	UserID         string
+	RouteID        string
+	Name           string
+	Last           TrackPoint
+	Points         int
+	DistanceM      float64
+	ElevationGainM float64
+	Elapsed        time.Duration
+	PaceMinPerKm   float64
+	Finished       bool
+	WorkoutID      string // solo al terminar; vacío si se canceló
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PeriodTotals acumula los workouts de una semana o mes.
+type PeriodTotals struct {
+	PeriodStart  time.Time
+	WorkoutCount int
+	DistanceM    float64
+	Duration     int // minutos
+	Calories     int
+}
+
+// Streak es una racha de días consecutivos con al menos un workout.
+type Streak struct {
+	Start time.Time
+	End   time.Time
+	Days  int
+}
+
+// Record apunta al workout que tiene la mejor marca en alguna métrica.
+type Record struct {
+	WorkoutID uuid.UUID
+	RouteID   uuid.UUID
+	Date      time.Time
+	Value     float64
+}
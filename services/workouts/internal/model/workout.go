@@ -9,30 +9,75 @@ import (
 	"github.com/google/uuid"
 )
 
-type StringArray []string
+// Exercise es un ejercicio dentro de un workout. Solo Name es obligatorio.
+type Exercise struct {
+	Name            string  `json:"name"`
+	Sets            int     `json:"sets,omitempty"`
+	Reps            int     `json:"reps,omitempty"`
+	WeightKg        float64 `json:"weight_kg,omitempty"`
+	DurationSeconds int     `json:"duration_seconds,omitempty"`
+}
+
+// ExerciseList se guarda como JSONB. Al leer acepta tanto objetos como el
+// formato anterior de solo nombres (["Calentamiento","Trail Run"]).
+type ExerciseList []Exercise
 
-func (a StringArray) Value() (driver.Value, error) {
+func (a ExerciseList) Value() (driver.Value, error) {
+	if a == nil {
+		a = ExerciseList{}
+	}
 	return json.Marshal(a)
 }
 
-func (a *StringArray) Scan(value interface{}) error {
-	bytes, ok := value.([]byte)
-	if !ok {
+func (a *ExerciseList) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*a = ExerciseList{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
 		return fmt.Errorf("failed to parse JSONB column")
 	}
-	return json.Unmarshal(bytes, a)
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	list := make(ExerciseList, 0, len(raw))
+	for _, item := range raw {
+		var name string
+		if err := json.Unmarshal(item, &name); err == nil {
+			list = append(list, Exercise{Name: name})
+			continue
+		}
+		var ex Exercise
+		if err := json.Unmarshal(item, &ex); err != nil {
+			return err
+		}
+		list = append(list, ex)
+	}
+	*a = list
+	return nil
 }
 
 type Workout struct {
-	ID        uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	Name      string      `gorm:"type:varchar(100);not null"`
-	Exercises StringArray `gorm:"type:jsonb"`
-	Duration  int         `gorm:"not null"`
-	Calories  int         `gorm:"not null"` // 👈 nuevo campo
-	Date      time.Time   `gorm:"not null"` // 👈 nuevo campo
-	UserID    uuid.UUID   `gorm:"type:uuid;not null"`
-	RouteID   uuid.UUID   `gorm:"type:uuid;not null"`
-	CreatedAt time.Time   `gorm:"autoCreateTime"`
+	ID        uuid.UUID    `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Name      string       `gorm:"type:varchar(100);not null"`
+	Exercises ExerciseList `gorm:"type:jsonb"`
+	Duration  int          `gorm:"not null"`
+	Calories  int          `gorm:"not null"` // 👈 nuevo campo
+	Date      time.Time    `gorm:"not null"` // 👈 nuevo campo
+	UserID    uuid.UUID    `gorm:"type:uuid;not null"`
+	RouteID   uuid.UUID    `gorm:"type:uuid;not null"`
+	CreatedAt time.Time    `gorm:"autoCreateTime"`
+
+	// Medidos del track GPS; 0 = desconocido (se usa la distancia de la ruta)
+	DistanceM      float64 `gorm:"not null;default:0"`
+	ElevationGainM float64 `gorm:"not null;default:0"`
 }
 
 // TableName overrides the default singular table name so it matches the
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"errors"
+
 	"trailbox/services/workouts/internal/model"
 	"trailbox/services/workouts/internal/repository"
 
@@ -27,16 +29,87 @@ func (r *DBRepository) Create(w *model.Workout) error {
 func (r *DBRepository) GetByID(id uuid.UUID) (*model.Workout, error) {
 	var workout model.Workout
 	if err := r.db.First(&workout, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrNotFound
+		}
 		return nil, err
 	}
 	return &workout, nil
 }
 
-// Listar todos
-func (r *DBRepository) List() ([]*model.Workout, error) {
+// Listar con filtros; usa los índices (user_id|route_id, date, id)
+func (r *DBRepository) List(f repository.ListFilter) ([]*model.Workout, error) {
+	q := r.db.Model(&model.Workout{})
+	if f.UserID != uuid.Nil {
+		q = q.Where("user_id = ?", f.UserID)
+	}
+	if f.RouteID != uuid.Nil {
+		q = q.Where("route_id = ?", f.RouteID)
+	}
+	if !f.From.IsZero() {
+		q = q.Where("date >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		q = q.Where("date < ?", f.To)
+	}
+	order, cmp := "date DESC, id DESC", "<"
+	if f.Ascending {
+		order, cmp = "date ASC, id ASC", ">"
+	}
+	if f.AfterID != uuid.Nil {
+		q = q.Where("(date, id) "+cmp+" (?, ?)", f.AfterDate, f.AfterID)
+	}
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+
 	var workouts []*model.Workout
-	if err := r.db.Find(&workouts).Error; err != nil {
+	if err := q.Order(order).Find(&workouts).Error; err != nil {
 		return nil, err
 	}
 	return workouts, nil
 }
+
+// Actualizar los campos editables de un workout
+func (r *DBRepository) Update(w *model.Workout) error {
+	res := r.db.Model(&model.Workout{}).
+		Where("id = ?", w.ID).
+		Updates(map[string]interface{}{
+			"name":      w.Name,
+			"exercises": w.Exercises,
+			"duration":  w.Duration,
+			"calories":  w.Calories,
+			"date":      w.Date,
+			"user_id":   w.UserID,
+			"route_id":  w.RouteID,
+
+			"distance_m":       w.DistanceM,
+			"elevation_gain_m": w.ElevationGainM,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// Eliminar por ID
+func (r *DBRepository) Delete(id uuid.UUID) error {
+	res := r.db.Delete(&model.Workout{}, "id = ?", id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// Contar los workouts de una ruta; usa el índice (route_id, date, id)
+func (r *DBRepository) CountByRoute(routeID uuid.UUID) (int64, error) {
+	var n int64
+	err := r.db.Model(&model.Workout{}).Where("route_id = ?", routeID).Count(&n).Error
+	return n, err
+}
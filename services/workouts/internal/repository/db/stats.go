@@ -0,0 +1,157 @@
+package db
+
+import (
+	"strings"
+
+	"trailbox/services/workouts/internal/model"
+	"trailbox/services/workouts/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// workoutDistance es la distancia del workout en metros: la medida por GPS
+// si existe, si no la de su ruta.
+const workoutDistance = "COALESCE(NULLIF(w.distance_m, 0), rd.distance_m)"
+
+// routeDistancesCTE arma el CTE "rd(route_id, distance_m)" con las
+// distancias que llegan del gateway, para poder hacer JOIN en SQL.
+func routeDistancesCTE(rd repository.RouteDistances) (string, []interface{}) {
+	if len(rd) == 0 {
+		return "rd(route_id, distance_m) AS (SELECT NULL::uuid, NULL::float8 WHERE false)", nil
+	}
+	var b strings.Builder
+	args := make([]interface{}, 0, 2*len(rd))
+	b.WriteString("rd(route_id, distance_m) AS (VALUES ")
+	first := true
+	for id, d := range rd {
+		if !first {
+			b.WriteString(", ")
+		}
+		first = false
+		b.WriteString("(?::uuid, ?::float8)")
+		args = append(args, id, d)
+	}
+	b.WriteString(")")
+	return b.String(), args
+}
+
+// Totales por semana o mes, más recientes primero
+func (r *DBRepository) PeriodTotals(userID uuid.UUID, period string, limit int, rd repository.RouteDistances) ([]model.PeriodTotals, error) {
+	cte, args := routeDistancesCTE(rd)
+	query := "WITH " + cte + `
+		SELECT date_trunc(?, w.date) AS period_start,
+		       COUNT(*) AS workout_count,
+		       COALESCE(SUM(` + workoutDistance + `), 0) AS distance_m,
+		       SUM(w.duration) AS duration,
+		       SUM(w.calories) AS calories
+		FROM workouts w
+		LEFT JOIN rd ON rd.route_id = w.route_id
+		WHERE w.user_id = ?
+		GROUP BY 1
+		ORDER BY 1 DESC
+		LIMIT ?`
+	args = append(args, period, userID, limit)
+
+	var totals []model.PeriodTotals
+	if err := r.db.Raw(query, args...).Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+// Rachas de días consecutivos (gaps and islands), la más reciente primero
+func (r *DBRepository) Streaks(userID uuid.UUID) ([]model.Streak, error) {
+	query := `
+		WITH days AS (
+			SELECT DISTINCT date::date AS d FROM workouts WHERE user_id = ?
+		), islands AS (
+			SELECT d, d - (ROW_NUMBER() OVER (ORDER BY d))::int AS grp FROM days
+		)
+		SELECT MIN(d) AS start, MAX(d) AS "end", COUNT(*) AS days
+		FROM islands
+		GROUP BY grp
+		ORDER BY MAX(d) DESC`
+
+	var streaks []model.Streak
+	if err := r.db.Raw(query, userID).Scan(&streaks).Error; err != nil {
+		return nil, err
+	}
+	return streaks, nil
+}
+
+// Workout más largo por distancia
+func (r *DBRepository) LongestByDistance(userID uuid.UUID, rd repository.RouteDistances) (*model.Record, error) {
+	cte, args := routeDistancesCTE(rd)
+	query := "WITH " + cte + `
+		SELECT w.id AS workout_id, w.route_id, w.date, ` + workoutDistance + ` AS value
+		FROM workouts w
+		LEFT JOIN rd ON rd.route_id = w.route_id
+		WHERE w.user_id = ? AND ` + workoutDistance + ` IS NOT NULL
+		ORDER BY value DESC, w.date ASC
+		LIMIT 1`
+	return r.singleRecord(query, append(args, userID)...)
+}
+
+// Workout de mayor duración
+func (r *DBRepository) LongestByDuration(userID uuid.UUID) (*model.Record, error) {
+	query := `
+		SELECT id AS workout_id, route_id, date, duration AS value
+		FROM workouts
+		WHERE user_id = ?
+		ORDER BY duration DESC, date ASC
+		LIMIT 1`
+	return r.singleRecord(query, userID)
+}
+
+// Workout con más calorías
+func (r *DBRepository) MostCalories(userID uuid.UUID) (*model.Record, error) {
+	query := `
+		SELECT id AS workout_id, route_id, date, calories AS value
+		FROM workouts
+		WHERE user_id = ?
+		ORDER BY calories DESC, date ASC
+		LIMIT 1`
+	return r.singleRecord(query, userID)
+}
+
+// Mejor ritmo (min/km) por ruta
+func (r *DBRepository) FastestPaceByRoute(userID uuid.UUID, rd repository.RouteDistances) ([]model.Record, error) {
+	cte, args := routeDistancesCTE(rd)
+	query := "WITH " + cte + `
+		SELECT DISTINCT ON (w.route_id)
+		       w.id AS workout_id, w.route_id, w.date,
+		       w.duration / (` + workoutDistance + ` / 1000.0) AS value
+		FROM workouts w
+		LEFT JOIN rd ON rd.route_id = w.route_id
+		WHERE w.user_id = ? AND ` + workoutDistance + ` > 0
+		ORDER BY w.route_id, value ASC, w.date ASC`
+	args = append(args, userID)
+
+	var records []model.Record
+	if err := r.db.Raw(query, args...).Scan(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// singleRecord devuelve nil, nil cuando la consulta no tiene filas.
+func (r *DBRepository) singleRecord(query string, args ...interface{}) (*model.Record, error) {
+	var records []model.Record
+	if err := r.db.Raw(query, args...).Scan(&records).Error; err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return &records[0], nil
+}
+
+// Rutas de los workouts del usuario sin distancia propia
+func (r *DBRepository) StatsRouteIDs(userID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.Model(&model.Workout{}).
+		Distinct("route_id").
+		Where("user_id = ? AND COALESCE(distance_m, 0) = 0", userID).
+		Pluck("route_id", &ids).Error
+	return ids, err
+}
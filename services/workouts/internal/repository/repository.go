@@ -1,13 +1,51 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
 	"trailbox/services/workouts/internal/model"
 
 	"github.com/google/uuid"
 )
 
+// ErrNotFound se devuelve cuando el workout solicitado no existe.
+var ErrNotFound = errors.New("workout not found")
+
+// ListFilter restringe y pagina el listado de workouts. Los campos en cero
+// no filtran. La paginación es keyset sobre (date, id), descendente salvo
+// que Ascending esté activo.
+type ListFilter struct {
+	UserID    uuid.UUID
+	RouteID   uuid.UUID
+	From      time.Time // inclusive
+	To        time.Time // exclusive
+	Limit     int
+	Ascending bool
+
+	// Cursor: último (date, id) devuelto en la página anterior.
+	AfterDate time.Time
+	AfterID   uuid.UUID
+}
+
+// RouteDistances asocia cada ruta con su distancia en metros. Las rutas viven
+// en otro servicio, así que quien llama provee los valores.
+type RouteDistances map[uuid.UUID]float64
+
 type Repository interface {
 	Create(w *model.Workout) error
 	GetByID(id uuid.UUID) (*model.Workout, error)
-	List() ([]*model.Workout, error)
+	List(f ListFilter) ([]*model.Workout, error)
+	Update(w *model.Workout) error
+	Delete(id uuid.UUID) error
+	CountByRoute(routeID uuid.UUID) (int64, error)
+
+	// Estadísticas
+	PeriodTotals(userID uuid.UUID, period string, limit int, rd RouteDistances) ([]model.PeriodTotals, error)
+	Streaks(userID uuid.UUID) ([]model.Streak, error)
+	LongestByDistance(userID uuid.UUID, rd RouteDistances) (*model.Record, error)
+	LongestByDuration(userID uuid.UUID) (*model.Record, error)
+	MostCalories(userID uuid.UUID) (*model.Record, error)
+	FastestPaceByRoute(userID uuid.UUID, rd RouteDistances) ([]model.Record, error)
+	StatsRouteIDs(userID uuid.UUID) ([]uuid.UUID, error)
 }